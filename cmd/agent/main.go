@@ -1,22 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	_ "embed"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/parallel"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/llm"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
 	"github.com/LouYuanbo1/crawleragent/param"
 
 	service "github.com/LouYuanbo1/crawleragent/internal/service/agent"
-
-	"github.com/cloudwego/eino/components/prompt"
-	"github.com/cloudwego/eino/schema"
+	parallelservice "github.com/LouYuanbo1/crawleragent/internal/service/parallel"
+	tracking "github.com/LouYuanbo1/crawleragent/internal/service/tracking"
 )
 
 //使用go:embed嵌入appconfig.json文件
@@ -29,7 +37,16 @@ import (
 //go:embed appconfig/appconfig.json
 var appConfig []byte
 
+// 用法: go run ./cmd/agent [-session <会话ID>]
+// 会话保存在storage.backend对应的存储中(ES的agent_sessions索引或storage.dir下的文件),
+// -sessions列出会话, -show <会话ID>输出会话的全部轮次和检索上下文, -delete <会话ID>删除会话
 func main() {
+	resume := flag.String("session", "", "继续之前的会话,为空时开始新的会话")
+	listSessions := flag.Bool("sessions", false, "列出保存的会话后退出")
+	showSession := flag.String("show", "", "以JSON输出会话的全部轮次(问题、意图、检索到的文档、回答)后退出")
+	deleteSession := flag.String("delete", "", "删除会话后退出")
+	flag.Parse()
+
 	appcfg, err := config.ParseConfig(appConfig)
 	if err != nil {
 		log.Fatalf("解析配置失败: %v", err)
@@ -39,115 +56,112 @@ func main() {
 
 	ctx := context.Background()
 
-	typedClient, err := es.InitTypedEsClient(appcfg, 3)
+	jobStore, err := store.InitStore[*model.BossJobDoc](appcfg, 3)
 	if err != nil {
-		log.Fatalf("failed to initialize Elasticsearch client: %s", err)
+		log.Fatalf("初始化文档存储失败: %v", err)
 	}
+	defer jobStore.Close()
 
 	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
 	if err != nil {
 		log.Fatalf("初始化Embedder失败: %v", err)
 	}
 
+	//启动时探测一次嵌入模型的向量维度,校验知识库索引的映射,避免检索时维度不一致
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+	if err := jobStore.EnsureIndex(ctx, dims); err != nil {
+		log.Fatalf("校验索引失败: %v", err)
+	}
+
 	llm, err := llm.InitLLM(ctx, appcfg)
 	if err != nil {
 		log.Fatalf("初始化LLM失败: %v", err)
 	}
 
-	//定义搜索模式的提示模板
-
-	searchModePrompt := prompt.FromMessages(
-		schema.FString,
-		schema.SystemMessage(`
-
-		角色：你是一位专业的职业顾问，擅长根据用户背景和需求匹配合适的工作岗位，并能灵活利用知识库资源。
-
-		任务：根据用户提供的求职需求，结合ES知识库中的岗位信息，为用户推荐最匹配的工作岗位。当知识库中无相关结果时，转而推荐优质招聘平台。
-
-		输入信息：
-
-		用户需求：包括但不限于行业偏好、工作地点、薪资期望、工作经验、技能要求、学历背景等
-		ES知识库内容：从企业知识库中检索到的相关岗位信息（可能为空）
-		处理逻辑：
-
-		优先使用知识库：仔细分析Elasticsearch知识库返回的岗位数据，根据用户需求进行精准匹配
-		匹配维度：考虑岗位职责、任职要求、薪资范围、工作地点、发展空间等关键因素
-		知识库为空时：当知识库未返回任何相关岗位时，立即切换到推荐招聘网站模式
-		推荐原则：始终以用户需求为中心，提供实用、可操作的建议
-		输出格式：
-
-		当知识库有结果时：
-		【精准岗位推荐】
-		根据您的需求，为您推荐以下岗位：
-		🔹 [岗位名称] - [公司名称]
-		• 工作地点：[地点]
-		• 薪资范围：[薪资]
-		• 核心要求：[2-3个关键要求]
-		• 网址：[岗位详情链接]
-		• 匹配理由：[说明为何匹配用户需求]
-		💡 建议：[1-2条具体求职建议]
-
-		当知识库为空时：
-		【招聘平台推荐】
-		不要编造任何数据,不要进行任何假设。
-		直接回答:当前知识库中暂无完全匹配的岗位，建议您通过以下专业招聘平台自主搜索：
-		综合类平台：
-		• 智联招聘（www.zhaopin.com）- 覆盖全行业，岗位数量丰富
-		• 前程无忧（www.51job.com）- 企业质量高，适合中高端求职
-		垂直类平台：
-		• 拉勾网（www.lagou.com）- 专注互联网/科技行业
-		• 猎聘（www.liepin.com）- 高端职位和猎头服务
-		新兴平台：
-		• BOSS直聘（www.zhipin.com）- 直接与招聘方沟通，效率高
-		• 脉脉（www.maimai.cn）- 职场社交+内推机会
-		💡 使用建议：建议在搜索时使用关键词组合（如"行业+职位+地点"），并完善个人简历以提高匹配度。
-		注意事项：
-
-		保持推荐的专业性和实用性
-		避免推荐明显不匹配的岗位
-		当知识库结果较少时，可适当补充招聘网站建议
-		用简洁清晰的语言表达，避免过于技术化的术语
-		始终以帮助用户成功求职为目标
-		`),
-		schema.SystemMessage(`以下是根据您的查询检索到的相关岗位信息：\n{referenceDocs}\n\n请严格展示这些岗位编号和信息,不要编造或添加任何额外信息。如果知识库为空,则直接回答:当前知识库中暂无完全匹配的岗位。`),
-		schema.UserMessage("{query}"),
-	)
-
-	//定义聊天模式的提示模板
-	chatModePrompt := prompt.FromMessages(
-		schema.FString,
-		schema.SystemMessage(`
-		角色：你是一个专业的职业顾问，擅长根据用户背景和需求匹配合适的工作岗位，并于用户交流职业规划，倾听用户求助时的烦恼，提供专业的建议并鼓励用户。
-		任务：与用户进行互动，倾听用户的问题、需求和建议，根据用户的背景和需求提供专业的职业规划建议。
-		`),
-		schema.SystemMessage(`以下是根据您经过网络查询得到的信息：\n{duckDuckGoResults}\n\n请结合这些信息回答用户的请求。`),
-		schema.UserMessage("{query}"),
-	)
-
-	//初始化Agent
-	params := &param.Agent{
-		IndexName: (&model.BossJobDoc{}).GetIndex(),
-		Prompt: map[param.PromptType]*prompt.DefaultChatTemplate{
-			param.PromptEsRAGMode: searchModePrompt,
-			param.PromptChatMode:  chatModePrompt,
-		},
+	//初始化Agent,使用求职顾问的提示模板和检索配置
+	params := service.JobAgentParam()
+	//agent.tools开启工具调用模式,知识库没有合适的岗位时模型可以换条件检索或按需爬取
+	params.Tools.Mode = appcfg.Agent.Tools
+	//只在对话时启动浏览器,列出、查看和删除会话不需要
+	if appcfg.Agent.Crawl && !*listSessions && *showSession == "" && *deleteSession == "" {
+		crawler, tracker, err := initCrawlTools(ctx, appcfg, jobStore, embedder, &params.Tools)
+		if err != nil {
+			log.Fatalf("初始化按需爬取失败: %v", err)
+		}
+		//先关闭浏览器,再关闭Tracker的历史存储
+		defer tracker.Close()
+		defer crawler.Close()
+	}
+	//会话保存在存储中,重启后可以通过-session继续之前的会话
+	sessionStore, err := store.InitStore[*model.SessionDoc](appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化会话存储失败: %v", err)
+	}
+	defer sessionStore.Close()
+	//会话索引没有向量字段,不需要维度
+	if err := sessionStore.EnsureIndex(ctx, 0); err != nil {
+		log.Fatalf("创建会话索引失败: %v", err)
 	}
 	agent, err := service.InitAgentService(ctx,
 		llm,
-		typedClient,
+		jobStore,
+		nil,
 		embedder,
+		service.InitStoreMemory(sessionStore),
 		params)
 	if err != nil {
 		log.Fatalf("初始化Agent失败: %v", err)
 	}
+	switch {
+	case *listSessions:
+		sessions, err := agent.ListSessions(ctx)
+		if err != nil {
+			log.Fatalf("列出会话失败: %v", err)
+		}
+		for _, session := range sessions {
+			fmt.Printf("%s\t%s\t%d轮\t%s\n", session.SessionId, session.Updated.Format(time.DateTime), len(session.Turns), session.Title)
+		}
+		return
+	case *showSession != "":
+		session, err := agent.GetSession(ctx, *showSession)
+		if err != nil {
+			log.Fatalf("读取会话失败: %v", err)
+		}
+		if session == nil {
+			log.Fatalf("会话不存在: %s", *showSession)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(session); err != nil {
+			log.Fatalf("输出会话失败: %v", err)
+		}
+		return
+	case *deleteSession != "":
+		if err := agent.DeleteSession(ctx, *deleteSession); err != nil {
+			log.Fatalf("删除会话失败: %v", err)
+		}
+		fmt.Printf("已删除会话: %s\n", *deleteSession)
+		return
+	}
 	fmt.Println("欢迎使用CrawlerAgent!")
-	fmt.Println("注意:当请求以'查询模式'或'搜索模式:'开头时,会使用Es知识库,否则会默认为聊天模式。")
+	fmt.Println("注意:智能体会自动判断请求需要查询知识库、网络搜索、两者都需要还是直接回答。")
+	fmt.Println("也可以用前缀指定: '查询模式'/'搜索模式'使用知识库, '联网模式'使用网络搜索, '混合模式'两者都用, '聊天模式'直接回答。")
 	fmt.Println("知识库内容越多,描述越完善,推荐结果越准确。")
+	fmt.Println("同一个会话中的请求共享对话记录,可以追问(如'第二个岗位的公司规模呢?'),输入'new'开始新的对话。")
+	sessionID := *resume
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+	fmt.Printf("当前会话: %s (之后可以通过 -session %s 继续)\n", sessionID, sessionID)
 	fmt.Println("请输入您的请求:")
-	query := ""
-	for {
-		//读取用户输入
-		fmt.Scanln(&query)
+	//按行读取用户输入,请求中可以包含空格
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		query := strings.TrimSpace(scanner.Text())
 		fmt.Printf("\n")
 
 		switch query {
@@ -156,11 +170,79 @@ func main() {
 		case "exit", "e", "quit", "q":
 			fmt.Println("感谢使用CrawlerAgent!")
 			return
+		case "new", "n":
+			sessionID = newSessionID()
+			fmt.Printf("已开始新的对话: %s\n", sessionID)
+			continue
 		}
 		//调用Agent,使用流式输出
-		err = agent.Stream(ctx, query)
+		resp, err := agent.Stream(ctx, service.Request{SessionID: sessionID, Query: query}, os.Stdout)
 		if err != nil {
 			log.Fatalf("调用Agent失败: %v", err)
 		}
+		fmt.Printf("\n\n")
+		printReferences(resp)
+	}
+}
+
+// printReferences 在回答后列出检索到的岗位和网络搜索结果,以及本轮的路由和耗时
+func printReferences(resp *service.Response) {
+	if len(resp.Documents) > 0 {
+		fmt.Println("参考文档:")
+		for i, doc := range resp.Documents {
+			cited := ""
+			if doc.Cited {
+				cited = " (已引用)"
+			}
+			fmt.Printf("  [文档%d] %s (%s, 得分 %.4f) %s%s\n", i+1, doc.Title, doc.Id, doc.Score, doc.Url, cited)
+		}
+	}
+	if len(resp.WebResults) > 0 {
+		fmt.Println("网络搜索结果:")
+		for _, url := range resp.WebResults {
+			fmt.Printf("  %s\n", url)
+		}
+	}
+	if len(resp.ToolCalls) > 0 {
+		fmt.Println("工具调用:")
+		for _, call := range resp.ToolCalls {
+			status := "成功"
+			if call.Error != "" {
+				status = "失败: " + call.Error
+			}
+			fmt.Printf("  %s %s (%dms, %s)\n", call.Name, call.Arguments, call.Ms, status)
+		}
 	}
+	fmt.Printf("意图: %s, 耗时: %dms\n\n", resp.Intent, resp.Timing.TotalMs)
+}
+
+// initCrawlTools 启动rod浏览器,监听Boss直聘的岗位列表接口并写入知识库,作为工具调用模式的按需爬取工具
+// 爬到的岗位与cmd/rod一样经过变更跟踪,保留已有文档的首次出现时间和版本;
+// 按需爬取只覆盖部分岗位,退出时只关闭Tracker,不标记过期也不占用运行序号
+func initCrawlTools(ctx context.Context, appcfg *config.Config, jobStore store.Store[*model.BossJobDoc], embedder embedding.Embedder, tools *param.Tools) (parallel.ParallelCrawler, tracking.Tracker[*model.BossJobDoc], error) {
+	tracker, err := tracking.InitTracker(ctx, appcfg, jobStore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("初始化变更跟踪失败: %w", err)
+	}
+	//按需爬取逐个执行,一个浏览器即可
+	crawler, err := parallel.InitRodBrowserPoolCrawler(appcfg, 1)
+	if err != nil {
+		tracker.Close()
+		return nil, nil, err
+	}
+	crawlService := parallelservice.InitRodParallelService[*entity.RowBossJobData](crawler, jobStore, embedder)
+	crawlService.Sink().AddTransform(tracker.Transform)
+	listener := &param.ListenerConfig{
+		UrlPatterns: []string{service.BossJobListPattern},
+		ListenerCh:  make(chan *types.NetworkResponse, 100),
+	}
+	crawlService.ProcessRespChanWithIndexDocs(ctx, listener, entity.ParseBossJobList)
+	tools.Crawler = crawlService
+	tools.CrawlTemplates = []*param.CrawlTemplate{service.BossCrawlTemplate(listener)}
+	tools.CrawlTimeout = time.Duration(appcfg.Agent.CrawlTimeoutSeconds) * time.Second
+	return crawler, tracker, nil
+}
+
+func newSessionID() string {
+	return fmt.Sprintf("cli-%s", time.Now().Format("20060102-150405.000"))
 }
@@ -3,17 +3,18 @@ package main
 import (
 	"context"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"log"
 
 	"github.com/LouYuanbo1/crawleragent/internal/config"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/parallel"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
 	service "github.com/LouYuanbo1/crawleragent/internal/service/parallel"
+	tracking "github.com/LouYuanbo1/crawleragent/internal/service/tracking"
 	"github.com/LouYuanbo1/crawleragent/param"
 )
 
@@ -53,14 +54,29 @@ func main() {
 	// 当你不知道使用哪个Context，或者没有可用的Context时，可以使用它作为起点。
 	// 它永远不会被取消，没有超时时间，也没有值。
 	ctx := context.Background()
+	//初始化Embedding模型
+	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化Embedder失败: %v", err)
+	}
+
+	//启动时探测一次嵌入模型的向量维度,用于创建索引映射并校验已有索引
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+
 	//运行前确保es服务启动完成
-	//初始化Elasticsearch客户端
-	esJobClient, err := es.InitTypedEsClient(appcfg, 3)
+	//初始化文档存储(storage.backend为elasticsearch时需要es服务)
+	jobStore, err := store.InitStore[*model.BossJobDoc](appcfg, 3)
 	if err != nil {
-		log.Fatalf("初始化Elasticsearch客户端失败: %v", err)
+		log.Fatalf("初始化文档存储失败: %v", err)
 	}
+	defer jobStore.Close()
 	//创建索引并设置映射
-	esJobClient.CreateIndexWithMapping(ctx)
+	if err := jobStore.EnsureIndex(ctx, dims); err != nil {
+		log.Fatalf("创建索引失败: %v", err)
+	}
 
 	//初始化Rod爬虫
 	/*
@@ -76,15 +92,17 @@ func main() {
 
 	//defer parallelCrawler.Close()
 
-	//初始化Embedding模型
-	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
-	if err != nil {
-		log.Fatalf("初始化Embedder失败: %v", err)
-	}
-
 	//初始化爬虫服务
 	//这里的crawler.InitCrawlerService函数用于初始化爬虫服务,将滚动爬虫、Elasticsearch客户端和Embedding模型组合起来
-	serviceParallel := service.InitRodParallelService(parallelCrawler, esJobClient, embedder)
+	serviceParallel := service.InitRodParallelService[*entity.RowBossJobData](parallelCrawler, jobStore, embedder)
+
+	//开启变更跟踪(tracking.enabled)时,比较内容哈希并记录首次/最近出现和最近变化的时间,
+	//内容变化时旧版本写入历史索引,连续多次运行没有爬到的文档标记为过期
+	tracker, err := tracking.InitTracker(ctx, appcfg, jobStore)
+	if err != nil {
+		log.Fatalf("初始化变更跟踪失败: %v", err)
+	}
+	serviceParallel.Sink().AddTransform(tracker.Transform)
 
 	respChanBoss := make(chan *types.NetworkResponse, 100)
 	respChanCnblogs := make(chan *types.NetworkResponse, 100)
@@ -156,46 +174,7 @@ func main() {
 		*/
 	}
 	//开始滚动爬取
-	serviceParallel.ProcessRespChanWithIndexDocs(ctx, listenerBoss, func(body []byte) ([]*entity.RowBossJobData, error) {
-		var jsonData struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-			ZpData  struct {
-				HasMore    bool                    `json:"hasMore"`
-				JobResList []entity.RowBossJobData `json:"jobList"`
-			} `json:"zpData"`
-		}
-
-		if err := json.Unmarshal(body, &jsonData); err != nil {
-			return nil, fmt.Errorf("JSON解析失败: %v", err)
-		}
-
-		if jsonData.Code != 0 {
-			return nil, fmt.Errorf("API返回错误: %d - %s", jsonData.Code, jsonData.Message)
-		}
-
-		results := make([]*entity.RowBossJobData, 0, len(jsonData.ZpData.JobResList))
-		for _, job := range jsonData.ZpData.JobResList {
-			results = append(results, &entity.RowBossJobData{
-				EncryptJobId:     job.EncryptJobId,
-				SecurityId:       job.SecurityId,
-				JobName:          job.JobName,
-				SalaryDesc:       job.SalaryDesc,
-				BrandName:        job.BrandName,
-				BrandScaleName:   job.BrandScaleName,
-				CityName:         job.CityName,
-				AreaDistrict:     job.AreaDistrict,
-				BusinessDistrict: job.BusinessDistrict,
-				JobLabels:        job.JobLabels,
-				Skills:           job.Skills,
-				JobExperience:    job.JobExperience,
-				JobDegree:        job.JobDegree,
-				WelfareList:      job.WelfareList,
-			})
-		}
-		return results, nil
-	},
-	)
+	serviceParallel.ProcessRespChanWithIndexDocs(ctx, listenerBoss, entity.ParseBossJobList)
 
 	serviceParallel.ProcessRespChan(ctx, listenerCnblogs)
 
@@ -208,16 +187,25 @@ func main() {
 
 	parallelCrawler.Close()
 
-	count, err := esJobClient.CountDocs(ctx)
+	//爬取结束后标记过期文档
+	if err := tracker.Finish(ctx); err != nil {
+		log.Printf("变更跟踪失败: %v", err)
+	}
+	count, err := jobStore.Count(ctx)
 	if err != nil {
 		log.Fatalf("查询索引文档数量失败: %v", err)
 	}
 	//打印索引中的文档数量
 	fmt.Printf("索引中的文档数量: %d\n", count)
+	//开启词嵌入缓存时,打印缓存命中统计
+	embedding.LogCacheStats(embedder)
 
-	err = esJobClient.ToExcel(ctx, "C:/Users/15325/Desktop/boss_jobs.xlsx", []string{"salaryDesc"}, 1000)
-	if err != nil {
-		log.Fatalf("导出索引文档到Excel失败: %v", err)
+	//导出Excel依赖ES的滚动查询,仅在使用Elasticsearch存储时可用
+	if esJobClient, ok := store.AsEs(jobStore); ok {
+		err = esJobClient.ToExcel(ctx, "C:/Users/15325/Desktop/boss_jobs.xlsx", []string{"salaryDesc"}, 1000)
+		if err != nil {
+			log.Fatalf("导出索引文档到Excel失败: %v", err)
+		}
 	}
 
 }
@@ -9,12 +9,14 @@ import (
 
 	"github.com/LouYuanbo1/crawleragent/internal/config"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/chrome"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
 	"github.com/LouYuanbo1/crawleragent/param"
 
 	service "github.com/LouYuanbo1/crawleragent/internal/service/chrome"
+	tracking "github.com/LouYuanbo1/crawleragent/internal/service/tracking"
 )
 
 //使用go:embed嵌入appconfig.json文件
@@ -48,29 +50,46 @@ func main() {
 	// 当你不知道使用哪个Context，或者没有可用的Context时，可以使用它作为起点。
 	// 它永远不会被取消，没有超时时间，也没有值。
 	ctx := context.Background()
+	//初始化Embedding模型
+	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化Embedder失败: %v", err)
+	}
+
+	//启动时探测一次嵌入模型的向量维度,用于创建索引映射并校验已有索引
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+
 	//运行前确保es服务启动完成
-	//初始化Elasticsearch客户端
-	esJobClient, err := es.InitTypedEsClient(appcfg, 3)
+	//初始化文档存储(storage.backend为elasticsearch时需要es服务)
+	jobStore, err := store.InitStore[*model.BossJobDoc](appcfg, 3)
 	if err != nil {
-		log.Fatalf("初始化Elasticsearch客户端失败: %v", err)
+		log.Fatalf("初始化文档存储失败: %v", err)
 	}
+	defer jobStore.Close()
 	//创建索引并设置映射
-	esJobClient.CreateIndexWithMapping(ctx)
+	if err := jobStore.EnsureIndex(ctx, dims); err != nil {
+		log.Fatalf("创建索引失败: %v", err)
+	}
 
 	//初始化Chromedp爬虫
 
 	scrollCrawler := chrome.InitChromedpCrawler(ctx, appcfg)
 	defer scrollCrawler.Close()
 
-	//初始化Embedding模型
-	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
-	if err != nil {
-		log.Fatalf("初始化Embedder失败: %v", err)
-	}
-
 	//初始化爬虫服务
 	//这里的crawler.InitCrawlerService函数用于初始化爬虫服务,将滚动爬虫、Elasticsearch客户端和Embedding模型组合起来
-	service := service.InitChromedpService(scrollCrawler, esJobClient, embedder)
+	service := service.InitChromedpService[*entity.RowBossJobData](scrollCrawler, jobStore, embedder)
+
+	//开启变更跟踪(tracking.enabled)时,比较内容哈希并记录首次/最近出现和最近变化的时间,
+	//内容变化时旧版本写入历史索引,连续多次运行没有爬到的文档标记为过期
+	tracker, err := tracking.InitTracker(ctx, appcfg, jobStore)
+	if err != nil {
+		log.Fatalf("初始化变更跟踪失败: %v", err)
+	}
+	service.Sink().AddTransform(tracker.Transform)
 
 	//这里的handler func(body []byte) ([]*entity.RowBossJobData, error)
 	//函数是滚动爬虫的回调函数,用于解析Boss直聘的岗位数据api返回的json数据,
@@ -132,9 +151,15 @@ func main() {
 	if err != nil {
 		log.Fatalf("滚动策略失败: %v", err)
 	}
-	count, err := esJobClient.CountDocs(ctx)
+	//爬取结束后标记过期文档
+	if err := tracker.Finish(ctx); err != nil {
+		log.Printf("变更跟踪失败: %v", err)
+	}
+	count, err := jobStore.Count(ctx)
 	//打印索引中的文档数量
 	fmt.Printf("索引中的文档数量: %d\n", count)
+	//开启词嵌入缓存时,打印缓存命中统计
+	embedding.LogCacheStats(embedder)
 
 	if err != nil {
 		log.Fatalf("滚动爬取失败: %v", err)
@@ -7,10 +7,16 @@ import (
 	"log"
 
 	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/chunking"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/collector"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/extractor"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	chunk "github.com/LouYuanbo1/crawleragent/internal/service/chunk"
 	service "github.com/LouYuanbo1/crawleragent/internal/service/colly"
+	tracking "github.com/LouYuanbo1/crawleragent/internal/service/tracking"
 
 	"github.com/gocolly/colly/v2"
 )
@@ -28,21 +34,51 @@ func main() {
 
 	ctx := context.Background()
 	collyCollector := collector.InitCollyCrawler(appcfg)
-	esJobClient, err := es.InitTypedEsClient(appcfg, 3)
-	if err != nil {
-		log.Fatalf("初始化Elasticsearch客户端失败: %v", err)
-	}
 	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
 	if err != nil {
 		log.Fatalf("初始化Embedder失败: %v", err)
 	}
-	service := service.InitCollyService(collyCollector, esJobClient, embedder, 8, 1)
+	//启动时探测一次嵌入模型的向量维度,用于创建索引映射并校验已有索引
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+	//通用网页使用WebPageDoc保存,索引为web_pages
+	pageStore, err := store.InitStore[*model.WebPageDoc](appcfg, 3)
+	if err != nil {
+		log.Fatalf("初始化文档存储失败: %v", err)
+	}
+	defer pageStore.Close()
+	//创建索引并设置映射
+	if err := pageStore.EnsureIndex(ctx, dims); err != nil {
+		log.Fatalf("创建索引失败: %v", err)
+	}
+	service := service.InitCollyService[*entity.RowWebPageData](collyCollector, pageStore, embedder, 8, 1)
+
+	//开启变更跟踪(tracking.enabled)时,比较内容哈希并记录首次/最近出现和最近变化的时间,
+	//内容变化时旧版本写入历史索引,连续多次运行没有爬到的文档标记为过期
+	tracker, err := tracking.InitTracker(ctx, appcfg, pageStore)
+	if err != nil {
+		log.Fatalf("初始化变更跟踪失败: %v", err)
+	}
+	service.Sink().AddTransform(tracker.Transform)
 	collyCollector.OnResponse(func(r *colly.Response) {
 		fmt.Printf("访问: %s\n状态码: %d\n", r.Request.URL, r.StatusCode)
-		fmt.Println("响应头:", r.Headers)
 		fmt.Println("响应体长度:", len(r.Body))
-		fmt.Println("响应体:", string(r.Body))
 	})
+	//长网页正文按Markdown标题分块(每块最多800字符,重叠100字符),分块写入doc_chunks索引,
+	//Agent传入分块存储后会检索分块并聚合回原网页
+	chunkStore, err := store.InitStore[*model.ChunkDoc](appcfg, 3)
+	if err != nil {
+		log.Fatalf("初始化文档存储失败: %v", err)
+	}
+	defer chunkStore.Close()
+	if err := chunkStore.EnsureIndex(ctx, dims); err != nil {
+		log.Fatalf("创建分块索引失败: %v", err)
+	}
+	service.SetChunkIndexer(chunk.InitChunkIndexer[*model.WebPageDoc](chunking.InitHeadingChunker(800, 100), chunkStore, embedder))
+	//使用内置的正文抽取器,将页面转换为Markdown正文(标题、作者、发布时间、外链),无需为每个网站编写解析函数
+	service.HandleHTML(ctx, "html", extractor.FromHTMLElement)
 	//service.RecursiveCrawling("a[href*=https://www.bilibili.com/video/]")
 
 	if err := service.Visit("https://pkg.go.dev/net/http"); err != nil {
@@ -50,4 +86,10 @@ func main() {
 	}
 
 	service.Wait()
+	//爬取结束后标记过期文档
+	if err := tracker.Finish(ctx); err != nil {
+		log.Printf("变更跟踪失败: %v", err)
+	}
+	//开启词嵌入缓存时,打印缓存命中统计
+	embedding.LogCacheStats(embedder)
 }
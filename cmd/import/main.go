@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/chunking"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/export"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	chunk "github.com/LouYuanbo1/crawleragent/internal/service/chunk"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
+	tracking "github.com/LouYuanbo1/crawleragent/internal/service/tracking"
+)
+
+//使用go:embed嵌入appconfig.json文件
+//下方注释重要,不能删除
+//在实际使用时，注意与文件名的对应，Github上保存的appconfig_example.json文件为样例，以实际为准,比如我这里是appconfig.json
+//When using it in practice, pay attention to the correspondence between the filename and the actual filename.
+//The appconfig_example.json file saved on GitHub is just an example;
+//use your own file, for example, mine is appconfig.json.
+
+//go:embed appconfig/appconfig.json
+var appConfig []byte
+
+// 批量导入: 读取JSONL或CSV文件(包括导出功能生成的文件),转换为文档、生成词嵌入后写入存储,
+// 用于在环境之间迁移数据或用外部数据集初始化知识库
+// 用法: go run ./cmd/import -index boss_jobs -file boss_jobs.csv [-map 职位=jobName,公司=brandName] [-reembed]
+func main() {
+	index := flag.String("index", "boss_jobs", "导入的索引: boss_jobs, web_pages")
+	file := flag.String("file", "", "导入的文件,按扩展名识别格式: .csv, .jsonl")
+	format := flag.String("format", "", "文件格式(csv, jsonl),为空时按扩展名识别")
+	mapping := flag.String("map", "", "源文件列名到文档字段的映射,如 职位=jobName,公司=brandName")
+	reembed := flag.Bool("reembed", false, "文件中已有维度匹配的向量时也重新生成词嵌入")
+	batchSize := flag.Int("batch-size", 200, "每批嵌入和写入的文档数")
+	flag.Parse()
+	if *file == "" {
+		log.Fatalf("请通过-file指定导入的文件")
+	}
+	columnMapping, err := parseMapping(*mapping)
+	if err != nil {
+		log.Fatalf("解析-map失败: %v", err)
+	}
+
+	appcfg, err := config.ParseConfig(appConfig)
+	if err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	ctx := context.Background()
+	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化Embedder失败: %v", err)
+	}
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+
+	opts := importOptions{
+		file:    *file,
+		read:    export.ReadOptions{Format: export.Format(*format), Mapping: columnMapping, BatchSize: *batchSize},
+		dims:    dims,
+		reembed: *reembed,
+	}
+	switch *index {
+	case (&model.BossJobDoc{}).GetIndex():
+		err = importFile[*model.BossJobDoc](ctx, appcfg, embedder, opts)
+	case (&model.WebPageDoc{}).GetIndex():
+		err = importFile[*model.WebPageDoc](ctx, appcfg, embedder, opts)
+	default:
+		log.Fatalf("不支持导入的索引: %s", *index)
+	}
+	if err != nil {
+		log.Fatalf("导入失败: %v", err)
+	}
+}
+
+type importOptions struct {
+	file    string
+	read    export.ReadOptions
+	dims    int
+	reembed bool
+}
+
+func parseMapping(text string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(text, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			return nil, fmt.Errorf("无效的映射 %q, 格式为 源列名=文档字段", pair)
+		}
+		mapping[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return mapping, nil
+}
+
+// importFile 读取文件并交给与爬虫相同的Sink处理: 变更跟踪 → 校验 → 词嵌入 → 写入文档存储(网页还会写入分块)
+func importFile[D model.Document](ctx context.Context, appcfg *config.Config, embedder embedding.Embedder, opts importOptions) error {
+	docStore, err := store.InitStore[D](appcfg, 3)
+	if err != nil {
+		return err
+	}
+	defer docStore.Close()
+	if err := docStore.EnsureIndex(ctx, opts.dims); err != nil {
+		return err
+	}
+	//嵌入失败的文档不带向量写入,之后重新爬取或迁移时会补上向量
+	pipelineCfg := embedding.DefaultPipelineConfig()
+	pipelineCfg.Policy = embedding.FailureIndexWithoutVector
+	docSink := sink.InitSinkWithConfig(embedder, docStore, pipelineCfg)
+	//文件中带有维度一致的向量时(如包含embedding列的JSONL导出)直接使用
+	if !opts.reembed {
+		docSink.ReuseEmbedding(func(doc D) bool { return len(doc.GetEmbedding()) == opts.dims })
+	}
+
+	//开启变更跟踪时,没有跟踪信息的行与爬取的文档一样记录版本和历史;导入的只是部分数据,不标记过期也不占用运行序号
+	tracker, err := tracking.InitTracker(ctx, appcfg, docStore)
+	if err != nil {
+		return fmt.Errorf("初始化变更跟踪失败: %w", err)
+	}
+	defer tracker.Close()
+	docSink.AddTransform(trackUntracked(tracker))
+
+	//网页与cmd/colly一样按Markdown标题分块写入doc_chunks索引
+	var schemaDoc D
+	if _, ok := any(schemaDoc).(*model.WebPageDoc); ok {
+		chunkStore, err := store.InitStore[*model.ChunkDoc](appcfg, 3)
+		if err != nil {
+			return err
+		}
+		defer chunkStore.Close()
+		if err := chunkStore.EnsureIndex(ctx, opts.dims); err != nil {
+			return fmt.Errorf("创建分块索引失败: %w", err)
+		}
+		chunkIndexer := chunk.InitChunkIndexer[D](chunking.InitHeadingChunker(800, 100), chunkStore, embedder)
+		docSink.AddWriter(chunk.Writer(chunkIndexer, 60*time.Second))
+	}
+
+	var imported, skipped, reused int
+	docSink.AddWriter(sink.WriterFunc[D](func(ctx context.Context, docs []D) error {
+		imported += len(docs)
+		return nil
+	}))
+	read, err := export.Read(opts.file, opts.read, func(docs []D) error {
+		batch := make([]D, 0, len(docs))
+		for _, doc := range docs {
+			//没有ID的行无法去重和更新,跳过
+			if doc.GetID() == "" || requireContent(doc) != nil {
+				skipped++
+				continue
+			}
+			//之前导出的岗位文件可能没有薪资范围列,按薪资描述补上
+			if job, ok := any(doc).(*model.BossJobDoc); ok && job.SalaryMax == 0 {
+				job.SetSalaryRange()
+			}
+			if !opts.reembed && len(doc.GetEmbedding()) == opts.dims {
+				reused++
+			}
+			batch = append(batch, doc)
+		}
+		return docSink.Put(ctx, batch)
+	})
+	if err != nil {
+		return err
+	}
+	if err := docSink.Flush(ctx); err != nil {
+		return err
+	}
+	if err := docStore.Flush(ctx); err != nil {
+		return err
+	}
+	log.Printf("从 %s 读取 %d 行, 导入 %s %d 个文档(复用向量 %d 个), 跳过 %d 个缺少ID或内容的文档",
+		opts.file, read, docStore.Name(), imported, reused, skipped)
+	return nil
+}
+
+// trackUntracked 只对没有跟踪信息的行做变更跟踪;导出文件中带有contentHash的行保留原有的版本、首次出现时间和过期标记,
+// 否则迁移到新环境后所有文档都会变成第1版
+func trackUntracked[D model.Document](tracker tracking.Tracker[D]) sink.Transform[D] {
+	return func(ctx context.Context, docs []D) ([]D, error) {
+		untracked := make([]D, 0, len(docs))
+		for _, doc := range docs {
+			if trackable, ok := any(doc).(model.Trackable); !ok || trackable.GetTracking().ContentHash == "" {
+				untracked = append(untracked, doc)
+			}
+		}
+		//Transform原地补充跟踪信息,返回的仍是同一批文档
+		if _, err := tracker.Transform(ctx, untracked); err != nil {
+			return nil, err
+		}
+		return docs, nil
+	}
+}
+
+// requireContent 校验文档有实际内容: 词嵌入字符串带有字段标签,永远不为空,所以按文档类型检查主要字段
+func requireContent[D model.Document](doc D) error {
+	switch doc := any(doc).(type) {
+	case *model.BossJobDoc:
+		if strings.TrimSpace(doc.JobName) == "" {
+			return fmt.Errorf("缺少岗位名")
+		}
+	case *model.WebPageDoc:
+		if strings.TrimSpace(doc.Title) == "" && strings.TrimSpace(doc.Content) == "" {
+			return fmt.Errorf("缺少标题和正文")
+		}
+	}
+	return nil
+}
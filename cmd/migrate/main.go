@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"flag"
+	"log"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+)
+
+//使用go:embed嵌入appconfig.json文件
+//下方注释重要,不能删除
+//在实际使用时，注意与文件名的对应，Github上保存的appconfig_example.json文件为样例，以实际为准,比如我这里是appconfig.json
+//When using it in practice, pay attention to the correspondence between the filename and the actual filename.
+//The appconfig_example.json file saved on GitHub is just an example;
+//use your own file, for example, mine is appconfig.json.
+
+//go:embed appconfig/appconfig.json
+var appConfig []byte
+
+// 索引迁移: 按当前代码中的映射和嵌入模型创建新版本的索引("<索引名>_v<版本>"),
+// 复制数据(维度变化或指定-reembed时重新嵌入)后原子地将别名切换到新索引
+// 用法: go run ./cmd/migrate -index boss_jobs [-reembed] [-delete-old]
+// 只检查线上映射与代码中的映射是否一致: go run ./cmd/migrate -index boss_jobs -check
+func main() {
+	index := flag.String("index", "boss_jobs", "要迁移的索引: boss_jobs, web_pages, doc_chunks, doc_history, agent_sessions")
+	reembed := flag.Bool("reembed", false, "向量维度不变时也重新生成词嵌入(如更换了同维度的嵌入模型)")
+	deleteOld := flag.Bool("delete-old", false, "切换别名后删除旧索引,默认保留以便回滚")
+	batchSize := flag.Int("batch-size", 200, "重新嵌入时每批读取的文档数")
+	check := flag.Bool("check", false, "只比较线上映射与代码中的映射,不迁移")
+	flag.Parse()
+
+	appcfg, err := config.ParseConfig(appConfig)
+	if err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+
+	ctx := context.Background()
+	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化Embedder失败: %v", err)
+	}
+	//新索引的向量维度由当前的嵌入模型决定
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+
+	opts := migrateOptions{dims: dims, reembed: *reembed, deleteOld: *deleteOld, batchSize: *batchSize, check: *check}
+	switch *index {
+	case (&model.BossJobDoc{}).GetIndex():
+		err = migrate[*model.BossJobDoc](ctx, appcfg, embedder, opts)
+	case (&model.WebPageDoc{}).GetIndex():
+		err = migrate[*model.WebPageDoc](ctx, appcfg, embedder, opts)
+	case (&model.ChunkDoc{}).GetIndex():
+		err = migrate[*model.ChunkDoc](ctx, appcfg, embedder, opts)
+	case (&model.HistoryDoc{}).GetIndex():
+		err = migrate[*model.HistoryDoc](ctx, appcfg, embedder, opts)
+	case (&model.SessionDoc{}).GetIndex():
+		err = migrate[*model.SessionDoc](ctx, appcfg, embedder, opts)
+	default:
+		log.Fatalf("未知的索引: %s", *index)
+	}
+	if err != nil {
+		log.Fatalf("迁移失败: %v", err)
+	}
+}
+
+type migrateOptions struct {
+	dims      int
+	reembed   bool
+	deleteOld bool
+	batchSize int
+	check     bool
+}
+
+func migrate[D model.Document](ctx context.Context, appcfg *config.Config, embedder embedding.Embedder, opts migrateOptions) error {
+	client, err := es.InitTypedEsClient[D](appcfg, 1)
+	if err != nil {
+		return err
+	}
+	if opts.check {
+		return checkMapping(ctx, client, opts.dims)
+	}
+	//重新嵌入失败的文档不带向量写入新索引,避免迁移丢失数据,之后重新爬取时会补上向量
+	pipelineCfg := embedding.DefaultPipelineConfig()
+	pipelineCfg.Policy = embedding.FailureIndexWithoutVector
+	pipeline := embedding.InitPipeline[D](embedder, pipelineCfg)
+
+	result, err := client.Migrate(ctx, es.MigrateOptions[D]{
+		Dims: opts.dims,
+		Reembed: func(ctx context.Context, docs []D) ([]D, error) {
+			result := pipeline.EmbedDocs(ctx, docs)
+			embedding.LogFailures(result)
+			return result.Ready, nil
+		},
+		ForceReembed: opts.reembed,
+		DeleteOld:    opts.deleteOld,
+		BatchSize:    opts.batchSize,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("别名 %s: %s -> %s, 复制 %d 个文档, 重新嵌入: %t",
+		result.Alias, result.From, result.To, result.Copied, result.Reembedded)
+	return nil
+}
+
+func checkMapping[D model.Document](ctx context.Context, client es.TypedEsClient[D], dims int) error {
+	diffs, err := client.ValidateMapping(ctx, dims)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		log.Printf("索引 %s 的映射与代码一致", client.Index())
+		return nil
+	}
+	log.Printf("索引 %s 的映射与代码有 %d 处不一致:", client.Index(), len(diffs))
+	for _, diff := range diffs {
+		log.Printf("  %s", diff)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/api"
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/llm"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+
+	service "github.com/LouYuanbo1/crawleragent/internal/service/agent"
+)
+
+//使用go:embed嵌入appconfig.json文件
+//下方注释重要,不能删除
+//在实际使用时，注意与文件名的对应，Github上保存的appconfig_example.json文件为样例，以实际为准,比如我这里是appconfig.json
+//When using it in practice, pay attention to the correspondence between the filename and the actual filename.
+//The appconfig_example.json file saved on GitHub is just an example;
+//use your own file, for example, mine is appconfig.json.
+
+//go:embed appconfig/appconfig.json
+var appConfig []byte
+
+// 智能体HTTP服务: 对话(支持SSE流式输出)、只检索和会话管理接口,供Web前端调用;
+// 以及OpenAI兼容的/v1/chat/completions接口,model选择配置文件中server.profiles对应的知识库
+// 用法: go run ./cmd/server,监听地址、跨域和模型配置见配置文件的server
+func main() {
+	appcfg, err := config.ParseConfig(appConfig)
+	if err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	embedder, err := embedding.InitEmbedder(ctx, appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化Embedder失败: %v", err)
+	}
+	dims, err := embedder.Dimension(ctx)
+	if err != nil {
+		log.Fatalf("获取嵌入模型向量维度失败: %v", err)
+	}
+
+	llm, err := llm.InitLLM(ctx, appcfg)
+	if err != nil {
+		log.Fatalf("初始化LLM失败: %v", err)
+	}
+
+	sessionStore, err := store.InitStore[*model.SessionDoc](appcfg, 1)
+	if err != nil {
+		log.Fatalf("初始化会话存储失败: %v", err)
+	}
+	defer sessionStore.Close()
+	//会话索引没有向量字段,不需要维度
+	if err := sessionStore.EnsureIndex(ctx, 0); err != nil {
+		log.Fatalf("创建会话索引失败: %v", err)
+	}
+	//各知识库的智能体共用会话记录
+	memory := service.InitStoreMemory(sessionStore)
+
+	jobStore, err := store.InitStore[*model.BossJobDoc](appcfg, 3)
+	if err != nil {
+		log.Fatalf("初始化文档存储失败: %v", err)
+	}
+	defer jobStore.Close()
+	if err := jobStore.EnsureIndex(ctx, dims); err != nil {
+		log.Fatalf("校验索引失败: %v", err)
+	}
+	agent, err := service.InitAgentService(ctx,
+		llm,
+		jobStore,
+		nil,
+		embedder,
+		memory,
+		service.JobAgentParam())
+	if err != nil {
+		log.Fatalf("初始化Agent失败: %v", err)
+	}
+
+	//OpenAI兼容接口的模型,按配置的知识库索引创建智能体,同一索引的模型共用一个智能体
+	profiles := appcfg.Server.Profiles
+	if len(profiles) == 0 {
+		profiles = append(profiles, struct {
+			Model string `json:"model"`
+			Index string `json:"index"`
+		}{Model: "crawleragent-jobs", Index: "boss_jobs"})
+	}
+	agents := map[string]api.ChatAgent{"boss_jobs": agent}
+	var models []api.Model
+	for _, profile := range profiles {
+		if _, ok := agents[profile.Index]; !ok {
+			switch profile.Index {
+			case "web_pages":
+				webAgent, closeStores, err := initWebAgent(ctx, appcfg, llm, embedder, memory, dims)
+				if err != nil {
+					log.Fatalf("初始化网页知识库Agent失败: %v", err)
+				}
+				defer closeStores()
+				agents[profile.Index] = webAgent
+			default:
+				log.Fatalf("模型%s的知识库索引不支持: %s", profile.Model, profile.Index)
+			}
+		}
+		models = append(models, api.Model{Name: profile.Model, Agent: agents[profile.Index]})
+	}
+
+	addr := appcfg.Server.Addr
+	if addr == "" {
+		addr = ":8080"
+	}
+	handler := api.InitServer(agent, api.Options{
+		AllowOrigin: appcfg.Server.AllowOrigin,
+		APIKey:      appcfg.Server.APIKey,
+		Models:      models,
+	})
+	//流式回答持续时间不定,不设置WriteTimeout
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("关闭HTTP服务失败: %v", err)
+		}
+	}()
+	log.Printf("智能体HTTP服务监听 %s", addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("HTTP服务异常退出: %v", err)
+	}
+	log.Printf("智能体HTTP服务已关闭")
+}
+
+// initWebAgent 创建web_pages网页知识库的智能体,网页按doc_chunks中的分块检索后聚合回原网页
+func initWebAgent(ctx context.Context,
+	appcfg *config.Config,
+	llm llm.LLM,
+	embedder embedding.Embedder,
+	memory service.Memory,
+	dims int,
+) (api.ChatAgent, func(), error) {
+	pageStore, err := store.InitStore[*model.WebPageDoc](appcfg, 3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("初始化网页存储失败: %w", err)
+	}
+	chunkStore, err := store.InitStore[*model.ChunkDoc](appcfg, 3)
+	if err != nil {
+		pageStore.Close()
+		return nil, nil, fmt.Errorf("初始化分块存储失败: %w", err)
+	}
+	closeStores := func() {
+		chunkStore.Close()
+		pageStore.Close()
+	}
+	if err := pageStore.EnsureIndex(ctx, dims); err != nil {
+		closeStores()
+		return nil, nil, fmt.Errorf("校验网页索引失败: %w", err)
+	}
+	if err := chunkStore.EnsureIndex(ctx, dims); err != nil {
+		closeStores()
+		return nil, nil, fmt.Errorf("校验分块索引失败: %w", err)
+	}
+	agent, err := service.InitAgentService(ctx, llm, pageStore, chunkStore, embedder, memory, service.WebAgentParam())
+	if err != nil {
+		closeStores()
+		return nil, nil, err
+	}
+	return agent, closeStores, nil
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	service "github.com/LouYuanbo1/crawleragent/internal/service/agent"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// ChatAgent OpenAI兼容接口使用的对话能力,任意文档类型的AgentService都满足
+type ChatAgent interface {
+	Stream(ctx context.Context, req service.Request, out io.Writer) (*service.Response, error)
+	Invoke(ctx context.Context, req service.Request) (*service.Response, error)
+}
+
+// Model OpenAI兼容接口的一个模型,请求中的model为Name时由Agent回答,完整运行Agent的RAG流程图
+type Model struct {
+	Name  string
+	Agent ChatAgent
+}
+
+// sessionHeader 请求带有该请求头时使用服务端保存的会话记录,忽略messages中之前的对话
+const sessionHeader = "X-Session-Id"
+
+// openAIHandler OpenAI Chat Completions兼容接口,供已支持该协议的工具直接调用智能体
+type openAIHandler struct {
+	models  []Model
+	apiKey  string
+	created int64
+}
+
+func initOpenAIHandler(models []Model, apiKey string) *openAIHandler {
+	return &openAIHandler{models: models, apiKey: apiKey, created: time.Now().Unix()}
+}
+
+func (h *openAIHandler) agent(name string) ChatAgent {
+	for _, m := range h.models {
+		if m.Name == name {
+			return m.Agent
+		}
+	}
+	return nil
+}
+
+// authorized 配置了apiKey时校验Bearer令牌,失败时写入401响应
+func (h *openAIHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.apiKey == "" {
+		return true
+	}
+	if !validAPIKey(r, h.apiKey) {
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", errors.New("API Key无效"))
+		return false
+	}
+	return true
+}
+
+type openAIModel struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (h *openAIHandler) listModels(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+	data := make([]openAIModel, 0, len(h.models))
+	for _, m := range h.models {
+		data = append(data, openAIModel{Id: m.Name, Object: "model", Created: h.created, OwnedBy: "crawleragent"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+// chatCompletionRequest 只使用model、messages和stream,temperature等采样参数由服务端的LLM配置决定
+type chatCompletionRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIMessage struct {
+	Role string `json:"role"`
+	// Content 可以是字符串,也可以是[{"type":"text","text":"..."}]形式的内容片段
+	Content json.RawMessage `json:"content"`
+}
+
+// text 取出消息的文本内容,忽略图片等非文本片段
+func (m openAIMessage) text() (string, error) {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return "", nil
+	}
+	var content string
+	if err := json.Unmarshal(m.Content, &content); err == nil {
+		return content, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", fmt.Errorf("消息内容格式错误: %w", err)
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// agentRequest 最后一条user消息作为请求,之前的user和assistant消息作为对话记录;
+// system消息忽略,提示由模型对应的提示模板决定
+func agentRequest(messages []openAIMessage, sessionID string) (service.Request, error) {
+	last := -1
+	for i, msg := range messages {
+		if msg.Role == "user" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return service.Request{}, errors.New("messages中没有user消息")
+	}
+	query, err := messages[last].text()
+	if err != nil {
+		return service.Request{}, err
+	}
+	req := service.Request{SessionID: sessionID, Query: strings.TrimSpace(query)}
+	if req.Query == "" {
+		return service.Request{}, errors.New("最后一条user消息的内容不能为空")
+	}
+	if sessionID != "" {
+		return req, nil
+	}
+	for _, msg := range messages[:last] {
+		content, err := msg.text()
+		if err != nil {
+			return service.Request{}, err
+		}
+		if content == "" {
+			continue
+		}
+		switch msg.Role {
+		case "user":
+			req.History = append(req.History, schema.UserMessage(content))
+		case "assistant":
+			req.History = append(req.History, schema.AssistantMessage(content, nil))
+		}
+	}
+	return req, nil
+}
+
+type chatCompletionChoice struct {
+	Index        int          `json:"index"`
+	Message      *openAIReply `json:"message,omitempty"`
+	Delta        *openAIReply `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type openAIReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// openAIUsage 流程图中多次调用模型(意图识别、查询改写等),不统计token数,固定为0
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type chatCompletion struct {
+	Id      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+	Usage   *openAIUsage           `json:"usage,omitempty"`
+}
+
+// chatCompletions 非流式时返回chat.completion;流式时先发送带role的chunk,
+// 之后每个回答片段发送一个chunk,最后发送finish_reason为stop的chunk和[DONE]
+func (h *openAIHandler) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+	var body chatCompletionRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	agent := h.agent(body.Model)
+	if agent == nil {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model_not_found", fmt.Errorf("模型不存在: %s", body.Model))
+		return
+	}
+	req, err := agentRequest(body.Messages, strings.TrimSpace(r.Header.Get(sessionHeader)))
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", err)
+		return
+	}
+
+	completion := chatCompletion{Id: newCompletionID(), Created: time.Now().Unix(), Model: body.Model}
+	stop := "stop"
+	if !body.Stream {
+		resp, err := agent.Invoke(r.Context(), req)
+		if err != nil {
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+		completion.Object = "chat.completion"
+		completion.Choices = []chatCompletionChoice{{
+			Message:      &openAIReply{Role: "assistant", Content: strings.TrimSpace(resp.Answer)},
+			FinishReason: &stop,
+		}}
+		completion.Usage = &openAIUsage{}
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+
+	events, err := initEventStream(w)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	defer events.Close()
+	completion.Object = "chat.completion.chunk"
+	chunk := func(delta *openAIReply, finishReason *string) error {
+		completion.Choices = []chatCompletionChoice{{Delta: delta, FinishReason: finishReason}}
+		return events.SendData(completion)
+	}
+	chunk(&openAIReply{Role: "assistant"}, nil)
+	out := writerFunc(func(p []byte) (int, error) {
+		if err := chunk(&openAIReply{Content: string(p)}, nil); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	})
+	if _, err := agent.Stream(r.Context(), req, out); err != nil {
+		// 客户端断开时不需要再发送
+		if r.Context().Err() == nil {
+			log.Printf("处理请求失败: %v", err)
+			events.SendData(openAIErrorBody("server_error", "", err))
+			events.SendDone()
+		}
+		return
+	}
+	chunk(&openAIReply{}, &stop)
+	events.SendDone()
+}
+
+// writerFunc 将函数适配为io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func openAIErrorBody(errType, code string, err error) map[string]any {
+	body := map[string]any{"message": err.Error(), "type": errType}
+	if code != "" {
+		body["code"] = code
+	}
+	return map[string]any{"error": body}
+}
+
+// writeOpenAIError 按OpenAI的格式返回错误: {"error": {"message": ..., "type": ..., "code": ...}}
+func writeOpenAIError(w http.ResponseWriter, status int, errType, code string, err error) {
+	if status >= http.StatusInternalServerError {
+		log.Printf("处理请求失败: %v", err)
+	}
+	writeJSON(w, status, openAIErrorBody(errType, code, err))
+}
+
+func newCompletionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	service "github.com/LouYuanbo1/crawleragent/internal/service/agent"
+)
+
+// 请求体的大小上限
+const maxBodyBytes = 1 << 20
+
+// server 智能体的HTTP接口,对话、只检索和会话管理都复用AgentService
+type server[D model.Document] struct {
+	agent       service.AgentService[D]
+	allowOrigin string
+	apiKey      string
+}
+
+// Options HTTP接口的配置
+type Options struct {
+	// AllowOrigin 不为空时返回CORS头,供其他域名下的前端调用
+	AllowOrigin string
+	// APIKey 不为空时/api和/v1下的接口都需要带"Authorization: Bearer <APIKey>",/healthz不需要
+	APIKey string
+	// Models OpenAI兼容接口的模型,为空时不提供/v1接口
+	Models []Model
+}
+
+// InitServer 创建智能体的HTTP接口:
+//
+//	POST   /api/chat              对话,stream为true时以Server-Sent Events逐段返回回答
+//	POST   /api/search            只检索知识库,不生成回答
+//	GET    /api/sessions          列出会话
+//	GET    /api/sessions/{id}     获取会话的全部轮次和检索上下文
+//	DELETE /api/sessions/{id}     删除会话
+//	GET    /v1/models             OpenAI兼容接口,列出opts.Models
+//	POST   /v1/chat/completions   OpenAI兼容接口,由model选择的智能体回答
+//	GET    /healthz               健康检查
+func InitServer[D model.Document](agent service.AgentService[D], opts Options) http.Handler {
+	s := &server[D]{agent: agent, allowOrigin: opts.AllowOrigin, apiKey: opts.APIKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chat", s.withAuth(s.chat))
+	mux.HandleFunc("POST /api/search", s.withAuth(s.search))
+	mux.HandleFunc("GET /api/sessions", s.withAuth(s.listSessions))
+	mux.HandleFunc("GET /api/sessions/{id}", s.withAuth(s.getSession))
+	mux.HandleFunc("DELETE /api/sessions/{id}", s.withAuth(s.deleteSession))
+	if len(opts.Models) > 0 {
+		openAI := initOpenAIHandler(opts.Models, opts.APIKey)
+		mux.HandleFunc("GET /v1/models", openAI.listModels)
+		mux.HandleFunc("POST /v1/chat/completions", openAI.chatCompletions)
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return s.withCORS(mux)
+}
+
+type chatRequest struct {
+	// SessionId 为空时创建新的会话,会话ID在响应中返回
+	SessionId string `json:"sessionId"`
+	Query     string `json:"query"`
+	Stream    bool   `json:"stream"`
+}
+
+// chat 对话接口,返回回答及检索到的文档、路由和耗时(service.Response);
+// 流式时依次发送session、token(多个)、done事件,done事件的数据为完整的Response,出错时发送error事件
+func (s *server[D]) chat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("query不能为空"))
+		return
+	}
+	if req.SessionId == "" {
+		req.SessionId = newSessionID()
+	}
+
+	if !req.Stream {
+		resp, err := s.agent.Invoke(r.Context(), service.Request{SessionID: req.SessionId, Query: req.Query})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp.Answer = strings.TrimSpace(resp.Answer)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	events, err := initEventStream(w)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer events.Close()
+	events.Send("session", map[string]string{"sessionId": req.SessionId})
+	resp, err := s.agent.Stream(r.Context(), service.Request{SessionID: req.SessionId, Query: req.Query}, events.TokenWriter())
+	if err != nil {
+		// 客户端断开时不需要再发送
+		if r.Context().Err() == nil {
+			events.Send("error", map[string]string{"error": err.Error()})
+		}
+		return
+	}
+	events.Send("done", resp)
+}
+
+type searchRequest struct {
+	Query string `json:"query"`
+	// K 返回的文档数,为0时使用检索配置,超过检索配置的MaxK时返回400
+	K int `json:"k"`
+	// Filters 筛选条件,为空时按配置从query中抽取
+	Filters *service.QueryFilters `json:"filters"`
+}
+
+type searchHit struct {
+	Id       string          `json:"id"`
+	Score    float64         `json:"score"`
+	Document json.RawMessage `json:"document"`
+}
+
+type searchResponse struct {
+	Filters *service.QueryFilters `json:"filters,omitempty"`
+	Relaxed bool                  `json:"relaxed"`
+	Hits    []searchHit           `json:"hits"`
+}
+
+func (s *server[D]) search(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("query不能为空"))
+		return
+	}
+	result, err := s.agent.Search(r.Context(), req.Query, req.K, req.Filters)
+	if errors.Is(err, service.ErrInvalidK) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := searchResponse{Filters: result.Filters, Relaxed: result.Relaxed, Hits: make([]searchHit, 0, len(result.Hits))}
+	for _, hit := range result.Hits {
+		document, err := documentJSON(hit.Doc)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp.Hits = append(resp.Hits, searchHit{Id: hit.ID, Score: hit.Score, Document: document})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type sessionSummary struct {
+	SessionId string    `json:"sessionId"`
+	Title     string    `json:"title"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Turns     int       `json:"turns"`
+}
+
+// listSessions 列出会话,只返回概要,轮次内容通过/api/sessions/{id}获取
+func (s *server[D]) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.agent.ListSessions(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	summaries := make([]sessionSummary, 0, len(sessions))
+	for _, session := range sessions {
+		summaries = append(summaries, sessionSummary{
+			SessionId: session.SessionId,
+			Title:     session.Title,
+			Created:   session.Created,
+			Updated:   session.Updated,
+			Turns:     len(session.Turns),
+		})
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *server[D]) getSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	session, err := s.agent.GetSession(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if session == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("会话不存在: %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *server[D]) deleteSession(w http.ResponseWriter, r *http.Request) {
+	if err := s.agent.DeleteSession(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withCORS 配置了allowOrigin时为响应加上CORS头,并直接响应预检请求
+func (s *server[D]) withCORS(next http.Handler) http.Handler {
+	if s.allowOrigin == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", s.allowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withAuth 配置了apiKey时校验Bearer令牌,失败时返回401
+func (s *server[D]) withAuth(next http.HandlerFunc) http.HandlerFunc {
+	if s.apiKey == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !validAPIKey(r, s.apiKey) {
+			writeError(w, http.StatusUnauthorized, errors.New("API Key无效"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validAPIKey 请求的"Authorization: Bearer <key>"与apiKey一致,使用常量时间比较
+func validAPIKey(r *http.Request, apiKey string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(apiKey)) == 1
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("解析请求失败: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("写入响应失败: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		log.Printf("处理请求失败: %v", err)
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// documentJSON 文档的JSON,去掉向量字段
+func documentJSON[D model.Document](doc D) (json.RawMessage, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "embedding")
+	return json.Marshal(fields)
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "web-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 检索和意图识别期间还没有回答片段,定时发送注释行,避免代理或浏览器因空闲断开连接
+const keepAliveInterval = 15 * time.Second
+
+// eventStream Server-Sent Events响应,Send可以在多个goroutine中调用
+type eventStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+func initEventStream(w http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("响应不支持流式输出")
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 关闭nginx的响应缓冲
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	es := &eventStream{w: w, flusher: flusher, stop: make(chan struct{})}
+	es.done.Add(1)
+	go es.keepAlive()
+	return es, nil
+}
+
+func (es *eventStream) keepAlive() {
+	defer es.done.Done()
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-es.stop:
+			return
+		case <-ticker.C:
+			es.write(": ping\n\n")
+		}
+	}
+}
+
+// Send 发送一个事件,data编码为JSON
+func (es *eventStream) Send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return es.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+}
+
+// SendData 发送不带事件名的data帧,data编码为JSON,用于OpenAI兼容的流式响应
+func (es *eventStream) SendData(data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return es.write(fmt.Sprintf("data: %s\n\n", payload))
+}
+
+// SendDone 发送OpenAI流式响应的结束标记"data: [DONE]"
+func (es *eventStream) SendDone() error {
+	return es.write("data: [DONE]\n\n")
+}
+
+func (es *eventStream) write(frame string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if _, err := io.WriteString(es.w, frame); err != nil {
+		return err
+	}
+	es.flusher.Flush()
+	return nil
+}
+
+// TokenWriter 每次Write作为一个token事件发送,data为{"content": "..."}
+func (es *eventStream) TokenWriter() io.Writer {
+	return tokenWriter{es}
+}
+
+// Close 停止发送心跳,之后不能再调用Send
+func (es *eventStream) Close() {
+	close(es.stop)
+	es.done.Wait()
+}
+
+type tokenWriter struct {
+	es *eventStream
+}
+
+func (tw tokenWriter) Write(p []byte) (int, error) {
+	if err := tw.es.Send("token", map[string]string{"content": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -7,8 +7,41 @@ type Config struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 		Address  string `json:"address"`
+		// 嵌入模型维度与已有索引不一致时,自动创建带维度后缀的新索引,否则启动时报错
+		CreateIndexOnDimsMismatch bool `json:"create_index_on_dims_mismatch"`
+		// 标签为analyzer=chinese的字段使用的中文分词器: ik(需要安装IK插件), smartcn(需要安装smartcn插件),
+		// 为空时使用ES默认的standard分词器;修改后需要运行cmd/migrate迁移已有索引
+		ChineseAnalyzer string `json:"chinese_analyzer"`
+		// 长期运行的批量写入器,未配置的项使用默认值
+		Bulk struct {
+			// 缓冲的文档数达到该值时提交,默认500
+			FlushCount int `json:"flush_count"`
+			// 缓冲的请求体达到该字节数时提交,默认5MB
+			FlushBytes int `json:"flush_bytes"`
+			// 定时提交间隔(毫秒),默认1000
+			FlushIntervalMs int `json:"flush_interval_ms"`
+			// 等待写入的文档队列长度,队列满时爬虫服务会等待ES写入,默认1000
+			QueueSize int `json:"queue_size"`
+		} `json:"bulk"`
 	} `json:"elasticsearch"`
 
+	// 文档存储,本地运行时可以使用flat/jsonl/memory代替Elasticsearch
+	Storage struct {
+		// 存储后端: elasticsearch(默认), flat(本地二进制向量文件), jsonl(本地JSONL文件), memory(内存,仅用于测试)
+		Backend string `json:"backend"`
+		// 本地存储文件所在目录
+		Dir string `json:"dir"`
+	} `json:"storage"`
+
+	// 重复爬取时的变更跟踪,记录文档的出现时间和内容变化,长期没有爬到的文档标记为过期而不是删除
+	Tracking struct {
+		Enabled bool `json:"enabled"`
+		// 连续多少次运行没有爬到的文档标记为过期,0表示不标记
+		ExpireAfterRuns int `json:"expire_after_runs"`
+		// 内容变化时是否将旧版本写入历史索引doc_history
+		History bool `json:"history"`
+	} `json:"tracking"`
+
 	Rod struct {
 		UserDataDir          string `json:"user_data_dir"`
 		UserMode             bool   `json:"user_mode"`
@@ -63,14 +96,51 @@ type Config struct {
 	} `json:"colly"`
 
 	Embedder struct {
+		// 嵌入模型提供方: ollama(默认), openai(兼容/v1/embeddings的服务), hash(离线测试用)
+		Provider  string `json:"provider"`
 		Host      string `json:"host"`
 		Port      int    `json:"port"`
 		Model     string `json:"model"`
+		APIKey    string `json:"api_key"`
 		BatchSize int    `json:"batch_size"`
+		// 向量维度,为0时自动探测(hash嵌入器默认768)
+		Dims int `json:"dims"`
+		// 词嵌入缓存,以内容哈希为key,重复爬取时未变化的文本不再调用嵌入模型
+		Cache struct {
+			Enabled bool   `json:"enabled"`
+			Path    string `json:"path"`
+		} `json:"cache"`
 	} `json:"embedder"`
 	LLM struct {
 		Host  string `json:"host"`
 		Port  int    `json:"port"`
 		Model string `json:"model"`
 	} `json:"llm"`
+
+	// 智能体命令行(cmd/agent)的工具调用模式
+	Agent struct {
+		// 工具调用模式的使用时机: 为空或"off"不使用,"fallback"知识库没有检索到岗位时使用,"always"查询知识库时都使用
+		Tools string `json:"tools"`
+		// 是否提供按需爬取Boss直聘的工具,开启时启动rod浏览器,使用rod配置
+		Crawl bool `json:"crawl"`
+		// 等待一次按需爬取完成的秒数,默认180
+		CrawlTimeoutSeconds int `json:"crawl_timeout_seconds"`
+	} `json:"agent"`
+
+	// 智能体HTTP服务(cmd/server)
+	Server struct {
+		// 监听地址,默认":8080"
+		Addr string `json:"addr"`
+		// 允许跨域访问的前端地址(如"http://localhost:3000"),为空时不返回CORS头,"*"允许任意来源
+		AllowOrigin string `json:"allow_origin"`
+		// 接口的API Key,不为空时/api和/v1下的请求需要带"Authorization: Bearer <api_key>"
+		APIKey string `json:"api_key"`
+		// OpenAI兼容接口的模型列表,请求中的model选择知识库索引和对应的提示模板;为空时只提供boss_jobs岗位知识库
+		Profiles []struct {
+			// Model 模型名,如"crawleragent-jobs"
+			Model string `json:"model"`
+			// Index 知识库索引,支持"boss_jobs"和"web_pages"(使用doc_chunks分块检索)
+			Index string `json:"index"`
+		} `json:"profiles"`
+	} `json:"server"`
 }
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
@@ -27,7 +28,7 @@ type RowBossJobData struct {
 // ToDocument 将RowBossJobData转换为BossJobDoc
 // Document类型用于将原始数据转换为索引文档(保存到es)
 func (entity *RowBossJobData) ToDocument() *model.BossJobDoc {
-	return &model.BossJobDoc{
+	doc := &model.BossJobDoc{
 		EncryptJobId:     entity.EncryptJobId,
 		JobName:          entity.JobName,
 		SalaryDesc:       entity.SalaryDesc,
@@ -44,6 +45,27 @@ func (entity *RowBossJobData) ToDocument() *model.BossJobDoc {
 		DetailAddress: fmt.Sprintf("https://www.zhipin.com/job_detail/%s.html?securityId=%s&ka=company_more_job_%s",
 			entity.EncryptJobId, entity.SecurityId, entity.EncryptJobId),
 	}
+	doc.SetSalaryRange()
+	return doc
+}
+
+// ParseBossJobList 解析Boss直聘岗位列表接口(joblist.json)的响应,接口返回错误码时返回错误
+func ParseBossJobList(body []byte) ([]*RowBossJobData, error) {
+	var jsonData struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		ZpData  struct {
+			HasMore    bool              `json:"hasMore"`
+			JobResList []*RowBossJobData `json:"jobList"`
+		} `json:"zpData"`
+	}
+	if err := json.Unmarshal(body, &jsonData); err != nil {
+		return nil, fmt.Errorf("JSON解析失败: %v", err)
+	}
+	if jsonData.Code != 0 {
+		return nil, fmt.Errorf("API返回错误: %d - %s", jsonData.Code, jsonData.Message)
+	}
+	return jsonData.ZpData.JobResList, nil
 }
 
 // 将来可能爬bilibili,先这样吧
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+// RowWebPageData是从任意网页抽取出的正文数据
+// Markdown为去除导航/广告等模板内容后的正文
+type RowWebPageData struct {
+	Url         string   `json:"url"`
+	Title       string   `json:"title"`
+	Author      string   `json:"author"`
+	PublishDate string   `json:"publishDate"`
+	Markdown    string   `json:"markdown"`
+	Links       []string `json:"links"`
+}
+
+// ToDocument 将RowWebPageData转换为WebPageDoc
+func (entity *RowWebPageData) ToDocument() *model.WebPageDoc {
+	return &model.WebPageDoc{
+		Url:         entity.Url,
+		Title:       entity.Title,
+		Author:      entity.Author,
+		PublishDate: entity.PublishDate,
+		Content:     entity.Markdown,
+		Links:       entity.Links,
+	}
+}
@@ -4,26 +4,28 @@ import (
 	"fmt"
 
 	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
-	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/densevectorelementtype"
-	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/densevectorsimilarity"
 )
 
 type BossJobDoc struct {
-	EncryptJobId     string    `json:"encryptJobId"`
-	JobName          string    `json:"jobName"`
-	SalaryDesc       string    `json:"salaryDesc"`
-	BrandName        string    `json:"brandName"`
-	BrandScaleName   string    `json:"brandScaleName"`
-	CityName         string    `json:"cityName"`
-	AreaDistrict     string    `json:"areaDistrict"`
-	BusinessDistrict string    `json:"businessDistrict"`
-	JobLabels        []string  `json:"jobLabels"`
-	Skills           []string  `json:"skills"`
-	JobExperience    string    `json:"jobExperience"`
-	JobDegree        string    `json:"jobDegree"`
-	WelfareList      []string  `json:"welfareList"`
-	DetailAddress    string    `json:"detailAddress"`
-	Embedding        []float32 `json:"embedding"`
+	EncryptJobId string `json:"encryptJobId" es:"type=keyword"`
+	JobName      string `json:"jobName" es:"type=text,analyzer=chinese,keyword"`
+	SalaryDesc   string `json:"salaryDesc" es:"type=keyword"`
+	// SalaryMin、SalaryMax 由SalaryDesc解析出的月薪范围(单位K),用于按薪资过滤,无法解析(面议、按天计薪)时为0
+	SalaryMin        int       `json:"salaryMin,omitzero" es:"type=integer"`
+	SalaryMax        int       `json:"salaryMax,omitzero" es:"type=integer"`
+	BrandName        string    `json:"brandName" es:"type=text,analyzer=chinese,keyword"`
+	BrandScaleName   string    `json:"brandScaleName" es:"type=keyword"`
+	CityName         string    `json:"cityName" es:"type=keyword"`
+	AreaDistrict     string    `json:"areaDistrict" es:"type=keyword"`
+	BusinessDistrict string    `json:"businessDistrict" es:"type=keyword"`
+	JobLabels        []string  `json:"jobLabels" es:"type=text,analyzer=chinese,keyword"`
+	Skills           []string  `json:"skills" es:"type=text,analyzer=chinese,keyword"`
+	JobExperience    string    `json:"jobExperience" es:"type=keyword"`
+	JobDegree        string    `json:"jobDegree" es:"type=keyword"`
+	WelfareList      []string  `json:"welfareList" es:"type=text,analyzer=chinese,keyword"`
+	DetailAddress    string    `json:"detailAddress" es:"type=text,analyzer=chinese"`
+	Embedding        []float32 `json:"embedding" es:"type=dense_vector,similarity=cosine"`
+	Tracking
 }
 
 func (jd *BossJobDoc) GetID() string {
@@ -35,24 +37,11 @@ func (jd *BossJobDoc) GetIndex() string {
 }
 
 // GetTypeMapping 获取BossJobDoc的索引映射，用于创建带有词嵌入索引
-// 用户需要根据实际情况自定义映射,这里只映射了Embedding向量字段
-// 其他字段Elasticsearch会自动映射,无需自定义
-func (jd *BossJobDoc) GetTypeMapping() *types.TypeMapping {
-	dims := 768
-	elementType := densevectorelementtype.Float
-	similarity := densevectorsimilarity.Cosine
-	index := true
-	return &types.TypeMapping{
-		Properties: map[string]types.Property{
-			"embedding": types.DenseVectorProperty{
-				Dims:        &dims,
-				ElementType: &elementType,
-				Similarity:  &similarity,
-				Index:       &index,
-				Type:        "dense_vector",
-			},
-		},
-	}
+// 映射由字段的es标签生成,城市、经验等枚举类字段只用于过滤,映射为keyword;
+// 岗位名、公司名、标签等中文字段使用中文分词,并保留keyword子字段用于精确匹配和聚合
+// dims为嵌入模型的向量维度,由启动时探测嵌入器得到
+func (jd *BossJobDoc) GetTypeMapping(dims int, analyzer string) (*types.TypeMapping, error) {
+	return TypeMappingFromTags(jd, dims, analyzer)
 }
 
 // GetEmbeddingString 获取BossJobDoc的词嵌入字符串，用于生成词嵌入
@@ -80,3 +69,11 @@ func (jd *BossJobDoc) SetEmbedding(embedding []float32) {
 func (jd *BossJobDoc) GetEmbedding() []float32 {
 	return jd.Embedding
 }
+
+// ContentHash 岗位内容的哈希,薪资、福利等任意字段变化都会改变哈希
+func (jd *BossJobDoc) ContentHash() string {
+	content := *jd
+	content.Embedding = nil
+	content.Tracking = Tracking{}
+	return hashContent(&content)
+}
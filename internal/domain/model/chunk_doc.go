@@ -0,0 +1,45 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// ChunkDoc 长文档分块后的子文档,通过ParentId关联到原文档
+// 所有类型文档的分块都保存在同一个索引中,使用ParentIndex区分
+type ChunkDoc struct {
+	ParentId    string    `json:"parentId" es:"type=keyword"`
+	ParentIndex string    `json:"parentIndex" es:"type=keyword"`
+	Seq         int       `json:"seq" es:"type=integer"`
+	Content     string    `json:"content" es:"type=text,analyzer=chinese"`
+	Embedding   []float32 `json:"embedding" es:"type=dense_vector,similarity=cosine"`
+}
+
+// GetID 分块ID由原文档ID和分块序号组成
+func (cd *ChunkDoc) GetID() string {
+	return fmt.Sprintf("%s_%d", cd.ParentId, cd.Seq)
+}
+
+func (cd *ChunkDoc) GetIndex() string {
+	return "doc_chunks"
+}
+
+// GetTypeMapping 获取ChunkDoc的索引映射,由字段的es标签生成
+// parentId和parentIndex用于过滤和聚合,需要映射为keyword
+func (cd *ChunkDoc) GetTypeMapping(dims int, analyzer string) (*types.TypeMapping, error) {
+	return TypeMappingFromTags(cd, dims, analyzer)
+}
+
+// GetEmbeddingString 分块本身已经足够短,直接使用分块内容生成词嵌入
+func (cd *ChunkDoc) GetEmbeddingString() string {
+	return cd.Content
+}
+
+func (cd *ChunkDoc) SetEmbedding(embedding []float32) {
+	cd.Embedding = embedding
+}
+
+func (cd *ChunkDoc) GetEmbedding() []float32 {
+	return cd.Embedding
+}
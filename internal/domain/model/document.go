@@ -5,10 +5,11 @@ import (
 )
 
 type Document interface {
-	*BossJobDoc
+	*BossJobDoc | *WebPageDoc | *ChunkDoc | *HistoryDoc | *SessionDoc
 	GetID() string
 	GetIndex() string
-	GetTypeMapping() *types.TypeMapping
+	// GetTypeMapping 生成索引映射,dims为向量维度,analyzer为analyzer=chinese的字段使用的中文分词器配置
+	GetTypeMapping(dims int, analyzer string) (*types.TypeMapping, error)
 	GetEmbeddingString() string
 	SetEmbedding(embedding []float32)
 	GetEmbedding() []float32
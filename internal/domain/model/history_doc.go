@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// HistoryDoc 文档内容变化前的旧版本,所有类型文档的历史版本都保存在同一个索引中,使用Index区分
+// 历史版本只用于查看变化,不参与向量检索,因此没有向量字段
+type HistoryDoc struct {
+	DocId       string `json:"docId" es:"type=keyword"`
+	Index       string `json:"index" es:"type=keyword"`
+	Version     int    `json:"version" es:"type=integer"`
+	ContentHash string `json:"contentHash" es:"type=keyword"`
+	// ValidFrom和ValidTo 该版本内容有效的时间段,即上次内容变化到本次检测到变化
+	ValidFrom time.Time `json:"validFrom" es:"type=date"`
+	ValidTo   time.Time `json:"validTo" es:"type=date"`
+	// Source 旧版本文档的JSON(不含向量)
+	Source json.RawMessage `json:"source" es:"type=object,enabled=false"`
+}
+
+// GetID 历史版本ID由索引名、文档ID和版本号组成
+func (hd *HistoryDoc) GetID() string {
+	return fmt.Sprintf("%s_%s_v%d", hd.Index, hd.DocId, hd.Version)
+}
+
+func (hd *HistoryDoc) GetIndex() string {
+	return "doc_history"
+}
+
+// GetTypeMapping 获取HistoryDoc的索引映射,由字段的es标签生成,旧版本文档只保存不索引
+// 历史索引没有向量字段,dims不起作用
+func (hd *HistoryDoc) GetTypeMapping(dims int, analyzer string) (*types.TypeMapping, error) {
+	return TypeMappingFromTags(hd, dims, analyzer)
+}
+
+// GetEmbeddingString 历史版本不生成词嵌入
+func (hd *HistoryDoc) GetEmbeddingString() string {
+	return ""
+}
+
+func (hd *HistoryDoc) SetEmbedding(embedding []float32) {}
+
+func (hd *HistoryDoc) GetEmbedding() []float32 {
+	return nil
+}
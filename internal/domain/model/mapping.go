@@ -0,0 +1,167 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/densevectorelementtype"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/densevectorsimilarity"
+)
+
+// 文档字段通过es标签声明映射,标签为逗号分隔的选项:
+//
+//	type=text|keyword|integer|long|float|boolean|date|object|dense_vector  字段类型,必填
+//	analyzer=<分词器>,search_analyzer=<分词器>  text字段的分词器,如ik_max_word、smartcn;
+//	                                          analyzer=chinese时使用GetTypeMapping传入的中文分词器
+//	keyword        为text字段增加keyword子字段(<字段>.keyword),用于精确匹配和聚合
+//	index=false    只保存不索引
+//	enabled=false  object字段只保存不解析
+//	similarity=cosine|dot_product|l2_norm  dense_vector的相似度,默认cosine,维度由GetTypeMapping的dims参数决定
+//
+// 没有es标签的字段不生成映射,交给ES的动态映射;匿名嵌入的结构体(如Tracking)的字段与文档字段平级
+const chineseAnalyzer = "chinese"
+
+// analyzers analyzer=chinese的字段实际使用的分词器,为空时使用ES的standard分词器,不依赖任何插件
+type analyzers struct {
+	index  string
+	search string
+}
+
+// chineseAnalyzers 按配置的名称选择中文分词器
+// name为ik(ik_max_word建索引,ik_smart检索)、smartcn,或其他已安装的分词器名称,为空时使用standard分词器
+func chineseAnalyzers(name string) analyzers {
+	if name == "ik" {
+		return analyzers{index: "ik_max_word", search: "ik_smart"}
+	}
+	return analyzers{index: name}
+}
+
+// TypeMappingFromTags 根据文档结构体的es标签生成索引映射,analyzer为elasticsearch.chinese_analyzer的配置,
+// 标签格式错误时返回错误
+func TypeMappingFromTags(doc any, dims int, analyzer string) (*types.TypeMapping, error) {
+	properties := make(map[string]types.Property)
+	if err := collectProperties(reflect.TypeOf(doc), dims, chineseAnalyzers(analyzer), properties); err != nil {
+		return nil, err
+	}
+	return &types.TypeMapping{Properties: properties}, nil
+}
+
+func collectProperties(t reflect.Type, dims int, chinese analyzers, properties map[string]types.Property) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := collectProperties(field.Type, dims, chinese, properties); err != nil {
+				return err
+			}
+			continue
+		}
+		tag, ok := field.Tag.Lookup("es")
+		if !ok || tag == "-" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		property, err := propertyFromTag(tag, dims, chinese)
+		if err != nil {
+			return fmt.Errorf("字段 %s.%s 的es标签错误: %w", t.Name(), field.Name, err)
+		}
+		properties[name] = property
+	}
+	return nil
+}
+
+func propertyFromTag(tag string, dims int, chinese analyzers) (types.Property, error) {
+	options := make(map[string]string)
+	for _, option := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		options[key] = value
+	}
+	var index *bool
+	if value, ok := options["index"]; ok {
+		indexed := value != "false"
+		index = &indexed
+	}
+
+	switch options["type"] {
+	case "text":
+		property := types.NewTextProperty()
+		property.Index = index
+		analyzer, searchAnalyzer := options["analyzer"], options["search_analyzer"]
+		if analyzer == chineseAnalyzer {
+			analyzer = chinese.index
+			if searchAnalyzer == "" {
+				searchAnalyzer = chinese.search
+			}
+		}
+		if analyzer != "" {
+			property.Analyzer = &analyzer
+		}
+		if searchAnalyzer != "" {
+			property.SearchAnalyzer = &searchAnalyzer
+		}
+		if _, ok := options["keyword"]; ok {
+			ignoreAbove := 256
+			keyword := types.NewKeywordProperty()
+			keyword.IgnoreAbove = &ignoreAbove
+			property.Fields = map[string]types.Property{"keyword": keyword}
+		}
+		return property, nil
+	case "keyword":
+		property := types.NewKeywordProperty()
+		property.Index = index
+		return property, nil
+	case "integer":
+		property := types.NewIntegerNumberProperty()
+		property.Index = index
+		return property, nil
+	case "long":
+		property := types.NewLongNumberProperty()
+		property.Index = index
+		return property, nil
+	case "float":
+		property := types.NewFloatNumberProperty()
+		property.Index = index
+		return property, nil
+	case "boolean":
+		property := types.NewBooleanProperty()
+		property.Index = index
+		return property, nil
+	case "date":
+		property := types.NewDateProperty()
+		property.Index = index
+		return property, nil
+	case "object":
+		property := types.NewObjectProperty()
+		if value, ok := options["enabled"]; ok {
+			enabled := value != "false"
+			property.Enabled = &enabled
+		}
+		return property, nil
+	case "dense_vector":
+		similarity := densevectorsimilarity.Cosine
+		if value := options["similarity"]; value != "" {
+			similarity = densevectorsimilarity.DenseVectorSimilarity{Name: value}
+		}
+		elementType := densevectorelementtype.Float
+		indexed := true
+		if index != nil {
+			indexed = *index
+		}
+		return &types.DenseVectorProperty{
+			Dims:        &dims,
+			ElementType: &elementType,
+			Similarity:  &similarity,
+			Index:       &indexed,
+			Type:        "dense_vector",
+		}, nil
+	default:
+		return nil, fmt.Errorf("未知的字段类型: %q", options["type"])
+	}
+}
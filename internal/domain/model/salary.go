@@ -0,0 +1,49 @@
+package model
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// salaryPattern 匹配"15-25K"、"15-25K·13薪"、"8000-10000元/月"、"20K以上"等写法
+var salaryPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)(?:\s*-\s*(\d+(?:\.\d+)?))?\s*(K|k|千|万|元/月|元)?`)
+
+// ParseSalary 将Boss直聘的薪资描述解析为月薪范围(单位K),"·13薪"等年终部分忽略,
+// 按天、按小时计薪或面议等无法换算为月薪的描述返回0, 0
+func ParseSalary(desc string) (minK, maxK int) {
+	desc = strings.TrimSpace(desc)
+	if desc == "" || strings.Contains(desc, "/天") || strings.Contains(desc, "/时") || strings.Contains(desc, "/小时") {
+		return 0, 0
+	}
+	match := salaryPattern.FindStringSubmatch(desc)
+	if match == nil {
+		return 0, 0
+	}
+	scale := 1.0
+	switch match[3] {
+	case "K", "k", "千":
+	case "万":
+		scale = 10
+	case "元/月", "元":
+		scale = 0.001
+	default:
+		return 0, 0
+	}
+	low, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, 0
+	}
+	high := low
+	if match[2] != "" {
+		if high, err = strconv.ParseFloat(match[2], 64); err != nil {
+			return 0, 0
+		}
+	}
+	return int(low*scale + 0.5), int(high*scale + 0.5)
+}
+
+// SetSalaryRange 根据SalaryDesc填充SalaryMin、SalaryMax
+func (jd *BossJobDoc) SetSalaryRange() {
+	jd.SalaryMin, jd.SalaryMax = ParseSalary(jd.SalaryDesc)
+}
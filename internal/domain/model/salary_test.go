@@ -0,0 +1,43 @@
+package model
+
+import "testing"
+
+func TestParseSalary(t *testing.T) {
+	tests := []struct {
+		desc     string
+		min, max int
+	}{
+		{"15-25K", 15, 25},
+		{"15-25K·14薪", 15, 25},
+		{"15-25k·13薪", 15, 25},
+		{" 8-12K ", 8, 12},
+		{"20K以上", 20, 20},
+		{"3-4万·16薪", 30, 40},
+		{"1-1.5万", 10, 15},
+		{"8000-10000元/月", 8, 10},
+		{"6500元", 7, 7},
+		{"5-8千", 5, 8},
+		{"面议", 0, 0},
+		{"", 0, 0},
+		{"200-300元/天", 0, 0},
+		{"50-80元/时", 0, 0},
+		{"40元/小时", 0, 0},
+		{"10-15", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			minK, maxK := ParseSalary(tt.desc)
+			if minK != tt.min || maxK != tt.max {
+				t.Errorf("ParseSalary(%q) = %d, %d, want %d, %d", tt.desc, minK, maxK, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestSetSalaryRange(t *testing.T) {
+	job := &BossJobDoc{SalaryDesc: "15-25K·14薪"}
+	job.SetSalaryRange()
+	if job.SalaryMin != 15 || job.SalaryMax != 25 {
+		t.Errorf("SetSalaryRange() = %d, %d, want 15, 25", job.SalaryMin, job.SalaryMax)
+	}
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// SessionDoc 智能体的一次会话,保存全部轮次的问题、检索上下文和最终回答,用于恢复会话和回顾回答、调整提示
+// 会话只保存不参与向量检索,因此没有向量字段
+type SessionDoc struct {
+	SessionId string `json:"sessionId" es:"type=keyword"`
+	// Title 会话的第一个问题,用于列出会话
+	Title   string    `json:"title" es:"type=text,analyzer=chinese"`
+	Created time.Time `json:"created" es:"type=date"`
+	Updated time.Time `json:"updated" es:"type=date"`
+	// Summary 较早轮次的摘要,Compacted为已经压缩进摘要的轮数,提示中只使用摘要和之后的轮次
+	Summary   string `json:"summary,omitempty" es:"type=text,analyzer=chinese"`
+	Compacted int    `json:"compacted,omitempty" es:"type=integer"`
+	// Turns 全部轮次,包括已经压缩进摘要的轮次,只保存不索引
+	Turns []SessionTurn `json:"turns" es:"type=object,enabled=false"`
+}
+
+// SessionTurn 一轮对话及产生回答的检索上下文
+type SessionTurn struct {
+	Query string `json:"query"`
+	// RewrittenQuery 追问改写后用于意图识别和检索的问题,没有改写时为空
+	RewrittenQuery string `json:"rewrittenQuery,omitempty"`
+	Intent         string `json:"intent,omitempty"`
+	IntentReason   string `json:"intentReason,omitempty"`
+	// Route 本轮经过的流程图节点,由意图决定
+	Route []string `json:"route,omitempty"`
+	// Filters 查询理解抽取的筛选条件,FiltersRelaxed为true表示按条件没有检索到文档,去掉条件重新检索
+	Filters        string `json:"filters,omitempty"`
+	FiltersRelaxed bool   `json:"filtersRelaxed,omitempty"`
+	// Documents 知识库检索到的文档,按提供给模型的顺序
+	Documents []RetrievedDoc `json:"documents,omitempty"`
+	// Check 回答的引用校验结果,没有查询知识库或关闭了校验时为nil
+	Check *CitationCheck `json:"check,omitempty"`
+	// ToolCalls 工具调用模式中模型依次调用的工具,没有使用工具调用模式时为空
+	ToolCalls []ToolCall `json:"toolCalls,omitempty"`
+	// WebResults 网络搜索结果的网址
+	WebResults []string   `json:"webResults,omitempty"`
+	Answer     string     `json:"answer"`
+	Error      string     `json:"error,omitempty"`
+	Time       time.Time  `json:"time"`
+	Timing     TurnTiming `json:"timing"`
+}
+
+// TurnTiming 一轮对话各阶段的耗时(毫秒),没有经过的阶段为0
+type TurnTiming struct {
+	// RetrievalMs 知识库检索(生成查询向量和检索)的耗时
+	RetrievalMs int64 `json:"retrievalMs,omitempty"`
+	// WebSearchMs 网络搜索的耗时
+	WebSearchMs int64 `json:"webSearchMs,omitempty"`
+	// FirstTokenMs 从收到请求到模型输出第一个回答片段的耗时,只在流式回答时记录
+	FirstTokenMs int64 `json:"firstTokenMs,omitempty"`
+	TotalMs      int64 `json:"totalMs"`
+}
+
+// ToolCall 模型的一次工具调用
+type ToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	// Result 工具返回给模型的结果,过长时截断
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Ms     int64  `json:"ms"`
+}
+
+// RetrievedDoc 检索到的文档
+type RetrievedDoc struct {
+	Index string  `json:"index"`
+	Id    string  `json:"id"`
+	Score float64 `json:"score"`
+	// Title、Url 文档的标题和网址,岗位为"岗位名 - 公司名"和DetailAddress,网页为标题和Url
+	Title string `json:"title,omitempty"`
+	Url   string `json:"url,omitempty"`
+	// Cited 回答是否引用了该文档(按编号或网址)
+	Cited bool `json:"cited,omitempty"`
+}
+
+// CitationCheck 回答的引用校验结果
+type CitationCheck struct {
+	// Cited 回答中引用的有效文档编号,从1开始,与Documents的顺序一致
+	Cited []int `json:"cited,omitempty"`
+	// Invalid 检索结果中不存在的引用,如"[文档7]"或编造的岗位网址
+	Invalid []string `json:"invalid,omitempty"`
+	// Stripped 删除的包含无效引用的条目数,只在strip模式下不为0
+	Stripped int `json:"stripped,omitempty"`
+	// Uncited 检索到了文档但回答没有引用任何文档
+	Uncited bool `json:"uncited,omitempty"`
+}
+
+func (sd *SessionDoc) GetID() string {
+	return sd.SessionId
+}
+
+func (sd *SessionDoc) GetIndex() string {
+	return "agent_sessions"
+}
+
+// GetTypeMapping 获取SessionDoc的索引映射,由字段的es标签生成,会话索引没有向量字段,dims不起作用
+func (sd *SessionDoc) GetTypeMapping(dims int, analyzer string) (*types.TypeMapping, error) {
+	return TypeMappingFromTags(sd, dims, analyzer)
+}
+
+// GetEmbeddingString 会话不生成词嵌入
+func (sd *SessionDoc) GetEmbeddingString() string {
+	return ""
+}
+
+func (sd *SessionDoc) SetEmbedding(embedding []float32) {}
+
+func (sd *SessionDoc) GetEmbedding() []float32 {
+	return nil
+}
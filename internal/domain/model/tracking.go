@@ -0,0 +1,46 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Tracking 重复爬取时的变更跟踪信息,嵌入到需要跟踪的文档中,JSON字段与文档字段平级
+// 未开启变更跟踪时各字段为零值,不会写入存储
+type Tracking struct {
+	// ContentHash 文档内容(不含向量和跟踪信息)的哈希,用于判断重新爬取的文档是否变化
+	ContentHash string `json:"contentHash,omitzero" es:"type=keyword"`
+	// Version 内容每变化一次加1,历史索引中保存之前的版本
+	Version     int       `json:"version,omitzero" es:"type=integer"`
+	FirstSeen   time.Time `json:"firstSeen,omitzero" es:"type=date"`
+	LastSeen    time.Time `json:"lastSeen,omitzero" es:"type=date"`
+	LastChanged time.Time `json:"lastChanged,omitzero" es:"type=date"`
+	// LastSeenRun 最近一次爬到该文档的运行序号
+	LastSeenRun int64 `json:"lastSeenRun,omitzero" es:"type=long"`
+	// Expired 连续多次运行没有爬到时标记为过期,再次爬到时恢复
+	Expired   bool      `json:"expired,omitzero" es:"type=boolean"`
+	ExpiredAt time.Time `json:"expiredAt,omitzero" es:"type=date"`
+}
+
+// Trackable 支持变更跟踪的文档
+type Trackable interface {
+	GetTracking() *Tracking
+	// ContentHash 计算文档内容的哈希
+	ContentHash() string
+}
+
+func (t *Tracking) GetTracking() *Tracking {
+	return t
+}
+
+// hashContent 计算去掉向量和跟踪信息后的文档JSON的哈希
+func hashContent(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
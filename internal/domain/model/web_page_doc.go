@@ -0,0 +1,66 @@
+package model
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// WebPageDoc 通用网页文档,用于保存博客、文档站等非API页面抽取出的正文
+type WebPageDoc struct {
+	Url   string `json:"url" es:"type=keyword"`
+	Title string `json:"title" es:"type=text,analyzer=chinese,keyword"`
+	// Author和PublishDate来自页面元数据,格式不统一,只做精确匹配
+	Author      string    `json:"author" es:"type=keyword"`
+	PublishDate string    `json:"publishDate" es:"type=keyword"`
+	Content     string    `json:"content" es:"type=text,analyzer=chinese"`
+	Links       []string  `json:"links" es:"type=keyword"`
+	Embedding   []float32 `json:"embedding" es:"type=dense_vector,similarity=cosine"`
+	Tracking
+}
+
+// GetID 使用URL的md5作为文档ID,避免过长的URL直接作为ES的_id
+func (wd *WebPageDoc) GetID() string {
+	sum := md5.Sum([]byte(wd.Url))
+	return hex.EncodeToString(sum[:])
+}
+
+func (wd *WebPageDoc) GetIndex() string {
+	return "web_pages"
+}
+
+// GetTypeMapping 获取WebPageDoc的索引映射,由字段的es标签生成
+// url和links只用于精确匹配,不需要分词;标题和正文使用中文分词
+func (wd *WebPageDoc) GetTypeMapping(dims int, analyzer string) (*types.TypeMapping, error) {
+	return TypeMappingFromTags(wd, dims, analyzer)
+}
+
+// GetEmbeddingString 获取WebPageDoc的词嵌入字符串,用于生成词嵌入
+func (wd *WebPageDoc) GetEmbeddingString() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("标题:%s. ", wd.Title))
+	if wd.Author != "" {
+		builder.WriteString(fmt.Sprintf("作者:%s. ", wd.Author))
+	}
+	builder.WriteString(fmt.Sprintf("正文:%s", wd.Content))
+	return builder.String()
+}
+
+func (wd *WebPageDoc) SetEmbedding(embedding []float32) {
+	wd.Embedding = embedding
+}
+
+func (wd *WebPageDoc) GetEmbedding() []float32 {
+	return wd.Embedding
+}
+
+// ContentHash 网页内容的哈希,正文、标题、链接等任意字段变化都会改变哈希
+func (wd *WebPageDoc) ContentHash() string {
+	content := *wd
+	content.Embedding = nil
+	content.Tracking = Tracking{}
+	return hashContent(&content)
+}
@@ -0,0 +1,133 @@
+package chunking
+
+import (
+	"strings"
+)
+
+// Chunker 文本分块器接口,用于在词嵌入之前将长文本切分为多个块,
+// 避免整篇文档作为一个向量时被嵌入模型静默截断
+type Chunker interface {
+	Split(text string) []string
+}
+
+// 分块时优先在这些位置断开,越靠前优先级越高
+var breakPoints = []string{"\n\n", "\n", "。", "！", "？", ". ", "! ", "? ", "；", "; ", "，", ", ", " "}
+
+type charChunker struct {
+	size    int
+	overlap int
+}
+
+// InitCharChunker 按字符数分块,相邻块之间保留overlap个字符的重叠
+// size按rune计算,中文和英文字符都计为1
+func InitCharChunker(size, overlap int) Chunker {
+	size = max(size, 1)
+	overlap = min(max(overlap, 0), size/2)
+	return &charChunker{size: size, overlap: overlap}
+}
+
+func (cc *charChunker) Split(text string) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) == 0 {
+		return nil
+	}
+	if len(runes) <= cc.size {
+		return []string{string(runes)}
+	}
+
+	chunks := make([]string, 0, len(runes)/(cc.size-cc.overlap)+1)
+	start := 0
+	for start < len(runes) {
+		end := min(start+cc.size, len(runes))
+		if end < len(runes) {
+			end = findBreak(runes, start, end)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end >= len(runes) {
+			break
+		}
+		// 下一块从end-overlap开始,但至少前进一个字符,避免死循环
+		start = max(end-cc.overlap, start+1)
+	}
+	return chunks
+}
+
+// findBreak 在[start,end)的后半段寻找最合适的断点,找不到时直接在end处截断
+func findBreak(runes []rune, start, end int) int {
+	window := string(runes[start:end])
+	half := len(window) / 2
+	for _, point := range breakPoints {
+		if idx := strings.LastIndex(window, point); idx > half {
+			return start + len([]rune(window[:idx+len(point)]))
+		}
+	}
+	return end
+}
+
+type headingChunker struct {
+	fallback Chunker
+	maxSize  int
+}
+
+// InitHeadingChunker 按Markdown标题分块,每个标题及其正文为一块,
+// 超过maxSize的段落再按字符分块(带overlap)
+func InitHeadingChunker(maxSize, overlap int) Chunker {
+	return &headingChunker{
+		fallback: InitCharChunker(maxSize, overlap),
+		maxSize:  max(maxSize, 1),
+	}
+}
+
+func (hc *headingChunker) Split(text string) []string {
+	sections := splitByHeadings(text)
+	chunks := make([]string, 0, len(sections))
+	for _, section := range sections {
+		if len([]rune(section)) <= hc.maxSize {
+			chunks = append(chunks, section)
+			continue
+		}
+		// 长段落切分后,每块都带上所属标题,保证块的语义完整
+		heading, body := splitHeading(section)
+		for _, chunk := range hc.fallback.Split(body) {
+			if heading != "" {
+				chunk = heading + "\n" + chunk
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+func splitByHeadings(text string) []string {
+	sections := make([]string, 0)
+	var current strings.Builder
+	inCodeBlock := false
+	flush := func() {
+		if section := strings.TrimSpace(current.String()); section != "" {
+			sections = append(sections, section)
+		}
+		current.Reset()
+	}
+	for line := range strings.Lines(text) {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCodeBlock = !inCodeBlock
+		}
+		if !inCodeBlock && strings.HasPrefix(trimmed, "#") {
+			flush()
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return sections
+}
+
+func splitHeading(section string) (string, string) {
+	if !strings.HasPrefix(section, "#") {
+		return "", section
+	}
+	heading, body, _ := strings.Cut(section, "\n")
+	return strings.TrimSpace(heading), body
+}
@@ -0,0 +1,255 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+// 这些标签基本不会包含正文,直接删除
+const boilerplateTags = "script, style, noscript, iframe, svg, canvas, form, button, input, select, textarea, nav, header, footer, aside, template"
+
+// 正文候选节点,按优先级排列
+var contentCandidates = []string{"article", "main", "[role=main]", "#content", ".content", ".post", ".article"}
+
+// class或id中包含以下单词的节点视为导航/广告等模板内容
+var boilerplatePattern = regexp.MustCompile(`(?i)^(nav|navbar|menu|sidebar|footer|header|banner|ad|ads|advert|advertisement|promo|sponsor|share|social|comment|comments|related|breadcrumb|breadcrumbs|cookie|popup|modal|subscribe|newsletter|toc)$`)
+
+var splitPattern = regexp.MustCompile(`[\s_-]+`)
+
+// Extract 从HTML中抽取可读正文,返回标题、作者、发布时间、Markdown正文和外链
+func Extract(pageUrl string, html []byte) (*entity.RowWebPageData, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("解析HTML失败: %w", err)
+	}
+	return ExtractDocument(pageUrl, doc)
+}
+
+// ExtractDocument 与Extract相同,但直接使用已解析的goquery文档
+func ExtractDocument(pageUrl string, doc *goquery.Document) (*entity.RowWebPageData, error) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, fmt.Errorf("解析URL失败: %w", err)
+	}
+	// 元信息需要在删除header等节点之前读取
+	data := &entity.RowWebPageData{
+		Url:         pageUrl,
+		Title:       extractTitle(doc),
+		Author:      extractAuthor(doc),
+		PublishDate: extractPublishDate(doc),
+	}
+
+	removeBoilerplate(doc.Selection)
+	content := findContent(doc.Selection)
+	if content == nil {
+		return nil, fmt.Errorf("未找到正文内容: %s", pageUrl)
+	}
+
+	data.Links = extractLinks(content, base)
+	data.Markdown = toMarkdown(content, base)
+	if data.Markdown == "" {
+		return nil, fmt.Errorf("正文内容为空: %s", pageUrl)
+	}
+	return data, nil
+}
+
+// FromHTMLElement 用于CollyService.HandleHTML的toCrawlable回调,选择器应为"html"
+func FromHTMLElement(e *colly.HTMLElement) ([]*entity.RowWebPageData, error) {
+	if e.DOM.Length() == 0 {
+		return nil, fmt.Errorf("空的HTML元素: %s", e.Request.URL)
+	}
+	// 抽取过程会删除节点,复制一份避免影响其他OnHTML回调
+	doc := goquery.NewDocumentFromNode(e.DOM.Clone().Nodes[0])
+	data, err := ExtractDocument(e.Request.URL.String(), doc)
+	if err != nil {
+		return nil, err
+	}
+	return []*entity.RowWebPageData{data}, nil
+}
+
+// FromHtmlContent 用于并行爬虫HtmlContentConfig的回调,每个选择器匹配到的HTML片段生成一个文档
+// 部分片段抽取失败时记录日志,一个都没有抽取成功(包括选择器没有匹配到片段)时返回错误,便于发现选择器失效或页面改版
+func FromHtmlContent(content *types.HtmlContent) ([]*entity.RowWebPageData, error) {
+	if len(content.Content) == 0 {
+		return nil, fmt.Errorf("选择器没有匹配到 %s 中的HTML片段", content.Url)
+	}
+	results := make([]*entity.RowWebPageData, 0, len(content.Content))
+	var lastErr error
+	for i, fragment := range content.Content {
+		data, err := Extract(content.Url, []byte(fragment))
+		if err != nil {
+			log.Printf("抽取 %s 的第 %d 个片段失败: %v", content.Url, i+1, err)
+			lastErr = err
+			continue
+		}
+		results = append(results, data)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("未能从 %s 的 %d 个片段中抽取正文: %w", content.Url, len(content.Content), lastErr)
+	}
+	return results, nil
+}
+
+func extractTitle(doc *goquery.Document) string {
+	if title := metaContent(doc, `meta[property="og:title"]`, `meta[name="twitter:title"]`); title != "" {
+		return title
+	}
+	if title := cleanText(doc.Find("title").First().Text()); title != "" {
+		return title
+	}
+	return cleanText(doc.Find("h1").First().Text())
+}
+
+func extractAuthor(doc *goquery.Document) string {
+	if author := metaContent(doc, `meta[name="author"]`, `meta[property="article:author"]`, `meta[name="twitter:creator"]`); author != "" {
+		return author
+	}
+	return cleanText(doc.Find(`[rel="author"], [itemprop="author"], .author, .byline`).First().Text())
+}
+
+func extractPublishDate(doc *goquery.Document) string {
+	if date := metaContent(doc,
+		`meta[property="article:published_time"]`,
+		`meta[name="publishdate"]`,
+		`meta[name="date"]`,
+		`meta[itemprop="datePublished"]`,
+	); date != "" {
+		return date
+	}
+	if date, ok := doc.Find("time[datetime]").First().Attr("datetime"); ok {
+		return strings.TrimSpace(date)
+	}
+	return ""
+}
+
+func metaContent(doc *goquery.Document, selectors ...string) string {
+	for _, selector := range selectors {
+		if content, ok := doc.Find(selector).First().Attr("content"); ok {
+			if content = strings.TrimSpace(content); content != "" {
+				return content
+			}
+		}
+	}
+	return ""
+}
+
+func removeBoilerplate(root *goquery.Selection) {
+	root.Find(boilerplateTags).Remove()
+	root.Find("[class], [id]").Not("html, body").Each(func(_ int, s *goquery.Selection) {
+		if isBoilerplate(s.AttrOr("class", "")) || isBoilerplate(s.AttrOr("id", "")) {
+			s.Remove()
+		}
+	})
+	root.Find(`[hidden], [aria-hidden="true"], [style*="display:none"], [style*="display: none"]`).Remove()
+}
+
+func isBoilerplate(attr string) bool {
+	for _, word := range splitPattern.Split(attr, -1) {
+		if boilerplatePattern.MatchString(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// findContent 优先使用语义化标签,否则参考readability的做法:
+// 每个段落按文本长度为父节点加分,祖父节点加一半,最后按链接密度折算,取得分最高者
+func findContent(root *goquery.Selection) *goquery.Selection {
+	for _, selector := range contentCandidates {
+		candidate := root.Find(selector).First()
+		if candidate.Length() > 0 && len(cleanText(candidate.Text())) > 200 {
+			return candidate
+		}
+	}
+
+	scores := make(map[*html.Node]float64)
+	root.Find("p, pre, blockquote, li, td").Each(func(_ int, s *goquery.Selection) {
+		textLength := float64(len([]rune(cleanText(s.Text()))))
+		if textLength < 25 {
+			return
+		}
+		parent := s.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		scores[parent.Nodes[0]] += textLength
+		if grandParent := parent.Parent(); grandParent.Length() > 0 {
+			scores[grandParent.Nodes[0]] += textLength / 2
+		}
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for node, score := range scores {
+		score *= 1 - linkDensity(goquery.NewDocumentFromNode(node).Selection)
+		if score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	if best != nil {
+		return root.FindNodes(best)
+	}
+	if body := root.Find("body"); body.Length() > 0 {
+		return body
+	}
+	return nil
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	textLength := float64(len([]rune(cleanText(s.Text()))))
+	if textLength == 0 {
+		return 1
+	}
+	linkLength := float64(len([]rune(cleanText(s.Find("a").Text()))))
+	return linkLength / textLength
+}
+
+// extractLinks 收集正文中指向其他站点的外链,去重后返回
+func extractLinks(content *goquery.Selection, base *url.URL) []string {
+	seen := make(map[string]struct{})
+	links := make([]string, 0)
+	content.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		link := resolveUrl(base, s.AttrOr("href", ""))
+		if link == "" {
+			return
+		}
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Host == "" || parsed.Host == base.Host {
+			return
+		}
+		if _, ok := seen[link]; ok {
+			return
+		}
+		seen[link] = struct{}{}
+		links = append(links, link)
+	})
+	return links
+}
+
+func resolveUrl(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "mailto:") {
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+	resolved.Fragment = ""
+	return resolved.String()
+}
+
+func cleanText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
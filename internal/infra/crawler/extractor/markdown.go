@@ -0,0 +1,202 @@
+package extractor
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+
+// markdownWriter 将正文节点递归转换为Markdown,只处理常见的块级和行内标签
+type markdownWriter struct {
+	builder strings.Builder
+	base    *url.URL
+	// 列表嵌套深度,用于缩进
+	listDepth int
+}
+
+func toMarkdown(content *goquery.Selection, base *url.URL) string {
+	w := &markdownWriter{base: base}
+	for _, node := range content.Nodes {
+		w.writeChildren(node)
+	}
+	markdown := blankLinesPattern.ReplaceAllString(w.builder.String(), "\n\n")
+	return strings.TrimSpace(markdown)
+}
+
+func (w *markdownWriter) writeChildren(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		w.writeNode(child)
+	}
+}
+
+func (w *markdownWriter) writeNode(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		w.writeText(node.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch node.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(node.Data[1] - '0')
+		w.block(strings.Repeat("#", level) + " " + inlineText(node))
+	case "p", "div", "section", "article", "main", "figure", "table", "tr", "dl":
+		w.newBlock()
+		w.writeChildren(node)
+		w.newBlock()
+	case "br":
+		w.builder.WriteString("  \n")
+	case "hr":
+		w.block("---")
+	case "pre":
+		w.block("```\n" + strings.Trim(textContent(node), "\n") + "\n```")
+	case "code":
+		w.writeText("`" + textContent(node) + "`")
+	case "blockquote":
+		quote := strings.TrimSpace(inlineText(node))
+		w.block("> " + strings.ReplaceAll(quote, "\n", "\n> "))
+	case "ul", "ol":
+		w.writeList(node, node.Data == "ol")
+	case "strong", "b":
+		w.wrapInline(node, "**")
+	case "em", "i":
+		w.wrapInline(node, "*")
+	case "a":
+		w.writeLink(node)
+	case "img":
+		w.writeImage(node)
+	case "td", "th":
+		w.writeChildren(node)
+		w.builder.WriteString(" | ")
+	default:
+		w.writeChildren(node)
+	}
+}
+
+func (w *markdownWriter) writeText(text string) {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return
+	}
+	current := w.builder.String()
+	if len(current) > 0 && !strings.HasSuffix(current, "\n") && !strings.HasSuffix(current, " ") && !strings.ContainsAny(text[:1], ".,;:!?)") {
+		w.builder.WriteString(" ")
+	}
+	w.builder.WriteString(text)
+}
+
+func (w *markdownWriter) writeList(node *html.Node, ordered bool) {
+	if w.listDepth == 0 {
+		w.newBlock()
+	}
+	index := 1
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.Data != "li" {
+			continue
+		}
+		marker := "-"
+		if ordered {
+			marker = fmt.Sprintf("%d.", index)
+			index++
+		}
+		w.builder.WriteString(strings.Repeat("  ", w.listDepth) + marker + " ")
+		w.listDepth++
+		for grandChild := child.FirstChild; grandChild != nil; grandChild = grandChild.NextSibling {
+			if grandChild.Type == html.ElementNode && (grandChild.Data == "ul" || grandChild.Data == "ol") {
+				w.builder.WriteString("\n")
+				w.writeList(grandChild, grandChild.Data == "ol")
+				continue
+			}
+			w.writeNode(grandChild)
+		}
+		w.listDepth--
+		if !strings.HasSuffix(w.builder.String(), "\n") {
+			w.builder.WriteString("\n")
+		}
+	}
+	if w.listDepth == 0 {
+		w.newBlock()
+	}
+}
+
+func (w *markdownWriter) wrapInline(node *html.Node, mark string) {
+	text := inlineText(node)
+	if text == "" {
+		return
+	}
+	w.writeText(mark + text + mark)
+}
+
+func (w *markdownWriter) writeLink(node *html.Node) {
+	text := inlineText(node)
+	href := resolveUrl(w.base, attr(node, "href"))
+	if href == "" {
+		w.writeText(text)
+		return
+	}
+	if text == "" {
+		text = href
+	}
+	w.writeText(fmt.Sprintf("[%s](%s)", text, href))
+}
+
+func (w *markdownWriter) writeImage(node *html.Node) {
+	src := resolveUrl(w.base, attr(node, "src"))
+	if src == "" {
+		return
+	}
+	w.writeText(fmt.Sprintf("![%s](%s)", attr(node, "alt"), src))
+}
+
+func (w *markdownWriter) block(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	w.newBlock()
+	w.builder.WriteString(text)
+	w.newBlock()
+}
+
+func (w *markdownWriter) newBlock() {
+	if w.builder.Len() > 0 {
+		w.builder.WriteString("\n\n")
+	}
+}
+
+func inlineText(node *html.Node) string {
+	return strings.Join(strings.Fields(textContent(node)), " ")
+}
+
+func textContent(node *html.Node) string {
+	var builder strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return builder.String()
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math/rand/v2"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -20,10 +21,13 @@ import (
 )
 
 type rodBrowserPoolCrawler struct {
-	browserPool        rod.Pool[rod.Browser]
-	createBrowser      func() (*rod.Browser, error)
-	controlURLCh       chan string
+	browserPool   rod.Pool[rod.Browser]
+	createBrowser func() (*rod.Browser, error)
+	controlURLCh  chan string
+	// chsMu 保护监听管道列表,PerformAllUrlOperations可能被多次调用(如智能体按需爬取)
+	chsMu              sync.Mutex
 	networkResponseChs []chan *types.NetworkResponse
+	htmlContentChs     []chan *types.HtmlContent
 }
 
 func InitRodBrowserPoolCrawler(cfg *config.Config, browserPoolSize int) (ParallelCrawler, error) {
@@ -77,12 +81,14 @@ func InitRodBrowserPoolCrawler(cfg *config.Config, browserPoolSize int) (Paralle
 	}
 
 	networkResponseChs := make([]chan *types.NetworkResponse, 0, browserPoolSize)
+	htmlContentChs := make([]chan *types.HtmlContent, 0, browserPoolSize)
 
 	return &rodBrowserPoolCrawler{
 		browserPool:        BrowserPool,
 		createBrowser:      createBrowser,
 		controlURLCh:       controlURLCh,
 		networkResponseChs: networkResponseChs,
+		htmlContentChs:     htmlContentChs,
 	}, nil
 }
 
@@ -93,10 +99,16 @@ func (rppc *rodBrowserPoolCrawler) Close() {
 	time.Sleep(3 * time.Second) // 可以根据实际情况调整
 
 	// 关闭所有监听管道
+	rppc.chsMu.Lock()
+	defer rppc.chsMu.Unlock()
 	log.Printf("关闭 %d 个监听管道", len(rppc.networkResponseChs))
 	for _, ch := range rppc.networkResponseChs {
 		close(ch)
 	}
+	log.Printf("关闭 %d 个HTML内容管道", len(rppc.htmlContentChs))
+	for _, ch := range rppc.htmlContentChs {
+		close(ch)
+	}
 	log.Printf("关闭 %d 个浏览器连接", len(rppc.browserPool))
 	rppc.browserPool.Cleanup(func(b *rod.Browser) { b.MustClose() })
 }
@@ -108,11 +120,17 @@ func (rppc *rodBrowserPoolCrawler) PerformAllUrlOperations(ctx context.Context,
 	// 过滤无效操作
 	validOperations := rppc.operationsChecker(operations)
 
+	// 多次爬取复用同一个监听管道时只记录一次,避免Close时重复关闭
+	rppc.chsMu.Lock()
 	for _, op := range validOperations {
-		if op.ListenerConfig != nil {
+		if op.ListenerConfig != nil && !slices.Contains(rppc.networkResponseChs, op.ListenerConfig.ListenerCh) {
 			rppc.networkResponseChs = append(rppc.networkResponseChs, op.ListenerConfig.ListenerCh)
 		}
+		if op.HtmlContentConfig != nil && !slices.Contains(rppc.htmlContentChs, op.HtmlContentConfig.HtmlContentsCh) {
+			rppc.htmlContentChs = append(rppc.htmlContentChs, op.HtmlContentConfig.HtmlContentsCh)
+		}
 	}
+	rppc.chsMu.Unlock()
 
 	operationCh := make(chan *param.UrlOperation, len(validOperations))
 	for _, op := range validOperations {
@@ -191,7 +209,7 @@ func (rppc *rodBrowserPoolCrawler) processUrlOperation(ctx context.Context, work
 		router.Stop()
 		log.Printf("Worker %d 页面关闭", workerID)
 		page.MustClose()
-		log.Printf("将 browser %d 返回池，处理的URL模式: %s", workerID, operation.ListenerConfig.UrlPatterns)
+		log.Printf("将 browser %d 返回池，处理的URL模式: %s", workerID, operation.ListenerUrlPatterns())
 		rppc.browserPool.Put(browser)
 	}()
 
@@ -225,6 +243,14 @@ func (rppc *rodBrowserPoolCrawler) processUrlOperation(ctx context.Context, work
 		errCh <- fmt.Errorf("未知操作类型: %v", operation.OperationType)
 		return
 	}
+
+	if operation.HtmlContentConfig != nil {
+		err = rppc.collectHtmlContents(ctx, page, operation)
+		if err != nil {
+			errCh <- fmt.Errorf("获取HTML内容失败: %v", err)
+			return
+		}
+	}
 }
 
 func (rppc *rodBrowserPoolCrawler) navigateURL(page *rod.Page, workerID int, url string) error {
@@ -257,7 +283,7 @@ func (rppc *rodBrowserPoolCrawler) performClick(page *rod.Page, operation *param
 			return fmt.Errorf("点击失败: %v", err)
 		}
 
-		page.WaitRequestIdle(time.Second, operation.ListenerConfig.UrlPatterns, nil, []proto.NetworkResourceType{proto.NetworkResourceTypeDocument})
+		page.WaitRequestIdle(time.Second, operation.ListenerUrlPatterns(), nil, []proto.NetworkResourceType{proto.NetworkResourceTypeDocument})
 
 		time.Sleep(totalSleep)
 	}
@@ -280,7 +306,7 @@ func (rppc *rodBrowserPoolCrawler) performXClick(page *rod.Page, operation *para
 			return fmt.Errorf("点击失败: %v", err)
 		}
 
-		page.WaitRequestIdle(time.Second, operation.ListenerConfig.UrlPatterns, nil, []proto.NetworkResourceType{proto.NetworkResourceTypeDocument})
+		page.WaitRequestIdle(time.Second, operation.ListenerUrlPatterns(), nil, []proto.NetworkResourceType{proto.NetworkResourceTypeDocument})
 
 		time.Sleep(totalSleep)
 	}
@@ -333,7 +359,7 @@ func (rppc *rodBrowserPoolCrawler) performScrolling(page *rod.Page, operation *p
 
 		fmt.Printf("第 %d 次滚动完成，目标位置: %f\n", i+1, currentScroll)
 
-		page.WaitRequestIdle(time.Second, operation.ListenerConfig.UrlPatterns, nil, []proto.NetworkResourceType{proto.NetworkResourceTypeDocument})
+		page.WaitRequestIdle(time.Second, operation.ListenerUrlPatterns(), nil, []proto.NetworkResourceType{proto.NetworkResourceTypeDocument})
 
 		time.Sleep(totalSleep)
 
@@ -343,8 +369,44 @@ func (rppc *rodBrowserPoolCrawler) performScrolling(page *rod.Page, operation *p
 	return nil
 }
 
+// collectHtmlContents 在操作完成后按选择器获取页面中的HTML片段,发送到HtmlContentsCh
+func (rppc *rodBrowserPoolCrawler) collectHtmlContents(ctx context.Context, page *rod.Page, operation *param.UrlOperation) error {
+	pageInfo, err := page.Info()
+	if err != nil {
+		return fmt.Errorf("获取页面信息失败: %v", err)
+	}
+	for _, selector := range operation.HtmlContentConfig.ContentSelectors {
+		elements, err := page.Elements(selector)
+		if err != nil {
+			return fmt.Errorf("查找元素失败 (selector: %s): %v", selector, err)
+		}
+		contents := make([]string, 0, len(elements))
+		for _, element := range elements {
+			html, err := element.HTML()
+			if err != nil {
+				log.Printf("获取元素HTML失败 (selector: %s): %v", selector, err)
+				continue
+			}
+			contents = append(contents, html)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case operation.HtmlContentConfig.HtmlContentsCh <- &types.HtmlContent{
+			Url:             pageInfo.URL,
+			ContentSelector: selector,
+			Content:         contents,
+		}:
+		}
+	}
+	return nil
+}
+
 func (rppc *rodBrowserPoolCrawler) setNetListener(ctx context.Context, browser *rod.Browser, listener *param.ListenerConfig) *rod.HijackRouter {
 	router := browser.HijackRequests()
+	if listener == nil {
+		return router
+	}
 	for _, urlPattern := range listener.UrlPatterns {
 		router.MustAdd(urlPattern, func(hijack *rod.Hijack) {
 			select {
@@ -0,0 +1,254 @@
+package embedding
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+)
+
+// CacheStats 词嵌入缓存的命中统计
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+// HitRate 返回缓存命中率,没有请求时返回0
+func (cs CacheStats) HitRate() float64 {
+	total := cs.Hits + cs.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(cs.Hits) / float64(total)
+}
+
+// CachedEmbedder 带缓存的嵌入器,内容不变的文本直接从缓存中读取向量,不再调用嵌入模型
+type CachedEmbedder interface {
+	Embedder
+	Stats() CacheStats
+	Close() error
+}
+
+// LogCacheStats 如果嵌入器开启了缓存,打印缓存命中统计
+func LogCacheStats(e Embedder) {
+	ce, ok := e.(CachedEmbedder)
+	if !ok {
+		return
+	}
+	stats := ce.Stats()
+	log.Printf("词嵌入缓存: 命中 %d, 未命中 %d, 命中率 %.1f%%, 缓存条目 %d",
+		stats.Hits, stats.Misses, stats.HitRate()*100, stats.Entries)
+}
+
+type cacheKey [sha256.Size]byte
+
+// cachedEmbedder 使用内容哈希作为key缓存向量,key中包含提供方、模型名称和配置的维度,
+// 切换提供方、模型或维度后不会命中旧配置的向量
+// 缓存保存在本地文件中,格式为追加写入的记录: key(32字节) + 维度(uint32) + 向量(float32*维度)
+type cachedEmbedder struct {
+	inner Embedder
+	// namespace 提供方、模型和维度,作为key的前缀
+	namespace string
+	mu        sync.RWMutex
+	vectors   map[cacheKey][]float32
+	file      *os.File
+	writer    *bufio.Writer
+	hits      atomic.Int64
+	misses    atomic.Int64
+}
+
+// InitCachedEmbedder 使用配置中的缓存文件路径包装嵌入器,启动时将已有缓存加载到内存
+func InitCachedEmbedder(inner Embedder, cfg *config.Config) (CachedEmbedder, error) {
+	path := cfg.Embedder.Cache.Path
+	if path == "" {
+		path = "embedding_cache.bin"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开词嵌入缓存文件失败: %w", err)
+	}
+	ce := &cachedEmbedder{
+		inner:     inner,
+		namespace: cacheNamespace(cfg),
+		vectors:   make(map[cacheKey][]float32),
+		file:      file,
+		writer:    bufio.NewWriter(file),
+	}
+	if err := ce.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	log.Printf("加载词嵌入缓存 %s, 共 %d 条", path, len(ce.vectors))
+	return ce, nil
+}
+
+func (ce *cachedEmbedder) BatchSize() int {
+	return ce.inner.BatchSize()
+}
+
+func (ce *cachedEmbedder) Concurrency() int {
+	return ce.inner.Concurrency()
+}
+
+func (ce *cachedEmbedder) Dimension(ctx context.Context) (int, error) {
+	return ce.inner.Dimension(ctx)
+}
+
+// Embed 先查缓存,只把未命中的文本交给内部嵌入器,结果按输入顺序返回
+func (ce *cachedEmbedder) Embed(ctx context.Context, strings []string) ([][]float32, error) {
+	if len(strings) == 0 {
+		return nil, nil
+	}
+	results := make([][]float32, len(strings))
+	keys := make([]cacheKey, len(strings))
+	missIndexes := make([]int, 0, len(strings))
+	missStrings := make([]string, 0, len(strings))
+
+	ce.mu.RLock()
+	for i, s := range strings {
+		keys[i] = ce.key(s)
+		if vector, ok := ce.vectors[keys[i]]; ok {
+			results[i] = vector
+			continue
+		}
+		missIndexes = append(missIndexes, i)
+		missStrings = append(missStrings, s)
+	}
+	ce.mu.RUnlock()
+
+	ce.hits.Add(int64(len(strings) - len(missStrings)))
+	ce.misses.Add(int64(len(missStrings)))
+	if len(missStrings) == 0 {
+		return results, nil
+	}
+
+	vectors, err := ce.inner.Embed(ctx, missStrings)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(missStrings) {
+		return nil, fmt.Errorf("%w: 嵌入结果数量不匹配: 期望 %d, 实际 %d", ErrPermanent, len(missStrings), len(vectors))
+	}
+
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	for j, vector := range vectors {
+		i := missIndexes[j]
+		results[i] = vector
+		if _, ok := ce.vectors[keys[i]]; ok {
+			continue
+		}
+		ce.vectors[keys[i]] = vector
+		if err := ce.writeRecord(keys[i], vector); err != nil {
+			log.Printf("写入词嵌入缓存失败: %v", err)
+		}
+	}
+	if err := ce.writer.Flush(); err != nil {
+		log.Printf("刷新词嵌入缓存失败: %v", err)
+	}
+	return results, nil
+}
+
+func (ce *cachedEmbedder) Stats() CacheStats {
+	ce.mu.RLock()
+	entries := len(ce.vectors)
+	ce.mu.RUnlock()
+	return CacheStats{
+		Hits:    ce.hits.Load(),
+		Misses:  ce.misses.Load(),
+		Entries: entries,
+	}
+}
+
+func (ce *cachedEmbedder) Close() error {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	if err := ce.writer.Flush(); err != nil {
+		return fmt.Errorf("刷新词嵌入缓存失败: %w", err)
+	}
+	return ce.file.Close()
+}
+
+// cacheNamespace 缓存key的前缀,未配置提供方时与InitEmbedder一样按ollama处理
+func cacheNamespace(cfg *config.Config) string {
+	provider := cfg.Embedder.Provider
+	if provider == "" {
+		provider = ProviderOllama
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d", provider, cfg.Embedder.Model, cfg.Embedder.Dims)
+}
+
+func (ce *cachedEmbedder) key(s string) cacheKey {
+	h := sha256.New()
+	h.Write([]byte(ce.namespace))
+	h.Write([]byte{0})
+	h.Write([]byte(s))
+	var key cacheKey
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+func (ce *cachedEmbedder) writeRecord(key cacheKey, vector []float32) error {
+	if _, err := ce.writer.Write(key[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(ce.writer, binary.LittleEndian, uint32(len(vector))); err != nil {
+		return err
+	}
+	return binary.Write(ce.writer, binary.LittleEndian, vector)
+}
+
+// load 读取缓存文件中的所有记录,文件末尾不完整的记录(如进程中途退出)会被截断丢弃
+func (ce *cachedEmbedder) load() error {
+	if _, err := ce.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("读取词嵌入缓存失败: %w", err)
+	}
+	reader := bufio.NewReader(ce.file)
+	var offset int64
+	for {
+		var key cacheKey
+		var dims uint32
+		if _, err := io.ReadFull(reader, key[:]); err != nil {
+			// 恰好在记录边界读到文件末尾,说明缓存完整
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return ce.truncateAt(offset, err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &dims); err != nil {
+			return ce.truncateAt(offset, err)
+		}
+		if dims == 0 || dims > math.MaxUint16 {
+			return ce.truncateAt(offset, fmt.Errorf("非法的向量维度: %d", dims))
+		}
+		vector := make([]float32, dims)
+		if err := binary.Read(reader, binary.LittleEndian, vector); err != nil {
+			return ce.truncateAt(offset, err)
+		}
+		ce.vectors[key] = vector
+		offset += int64(len(key)) + 4 + int64(dims)*4
+	}
+}
+
+func (ce *cachedEmbedder) truncateAt(offset int64, err error) error {
+	log.Printf("词嵌入缓存文件在偏移 %d 处损坏,截断后继续: %v", offset, err)
+	if err := ce.file.Truncate(offset); err != nil {
+		return fmt.Errorf("截断词嵌入缓存失败: %w", err)
+	}
+	return nil
+}
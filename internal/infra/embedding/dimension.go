@@ -0,0 +1,42 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 用于探测向量维度的文本,内容无关紧要
+const dimensionProbeText = "dimension probe"
+
+// dimensionProbe 缓存嵌入模型的向量维度,探测失败时下次调用会重试
+type dimensionProbe struct {
+	mu    sync.Mutex
+	dims  int
+	embed func(ctx context.Context, strings []string) ([][]float32, error)
+}
+
+// newDimensionProbe dims大于0时直接使用配置的维度,不再探测
+func newDimensionProbe(dims int, embed func(ctx context.Context, strings []string) ([][]float32, error)) *dimensionProbe {
+	return &dimensionProbe{dims: max(dims, 0), embed: embed}
+}
+
+func (dp *dimensionProbe) get(ctx context.Context) (int, error) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	if dp.dims > 0 {
+		return dp.dims, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	vectors, err := dp.embed(ctx, []string{dimensionProbeText})
+	if err != nil {
+		return 0, fmt.Errorf("探测向量维度失败: %w", err)
+	}
+	if len(vectors) == 0 || len(vectors[0]) == 0 {
+		return 0, fmt.Errorf("探测向量维度失败: 嵌入模型返回空向量")
+	}
+	dp.dims = len(vectors[0])
+	return dp.dims, nil
+}
@@ -2,10 +2,52 @@ package embedding
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+)
+
+// 嵌入模型提供方,通过配置embedder.provider选择,为空时默认使用ollama
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+	ProviderHash   = "hash"
 )
 
+// ErrPermanent 不可重试的嵌入错误(如请求参数错误、返回数量不匹配),重试也不会成功
+var ErrPermanent = errors.New("不可重试的嵌入错误")
+
 // Embedder 嵌入器接口,用于将文本转换为向量表示
 type Embedder interface {
 	Embed(ctx context.Context, strings []string) ([][]float32, error)
 	BatchSize() int
+	// Concurrency 返回允许同时请求模型的数量(即嵌入器信号量的大小)
+	Concurrency() int
+	// Dimension 返回向量维度,需要时会调用一次模型探测,之后使用缓存的结果
+	Dimension(ctx context.Context) (int, error)
+}
+
+// InitEmbedder 根据配置中的provider初始化嵌入器,embedSemSize限制同时请求模型的数量
+func InitEmbedder(ctx context.Context, cfg *config.Config, embedSemSize int) (Embedder, error) {
+	var e Embedder
+	var err error
+	switch cfg.Embedder.Provider {
+	case "", ProviderOllama:
+		e, err = initOllamaEmbedder(ctx, cfg, embedSemSize)
+	case ProviderOpenAI:
+		e, err = initOpenAIEmbedder(cfg, embedSemSize)
+	case ProviderHash:
+		e, err = initHashEmbedder(cfg, embedSemSize)
+	default:
+		return nil, fmt.Errorf("未知的嵌入模型提供方: %s", cfg.Embedder.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 开启缓存时包装为带缓存的嵌入器,调用方无需感知
+	if cfg.Embedder.Cache.Enabled {
+		return InitCachedEmbedder(e, cfg)
+	}
+	return e, nil
 }
@@ -0,0 +1,122 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+)
+
+// 未配置dims时哈希嵌入器使用的默认维度,与nomic-embed-text一致
+const defaultHashDims = 768
+
+// hashEmbedder 确定性的特征哈希嵌入器,不依赖任何模型服务,
+// 相同文本总是得到相同向量,词语重叠越多的文本余弦相似度越高,用于离线测试和本地调试
+type hashEmbedder struct {
+	dims        int
+	batchSize   int
+	concurrency int
+}
+
+func initHashEmbedder(cfg *config.Config, embedSemSize int) (Embedder, error) {
+	dims := cfg.Embedder.Dims
+	if dims <= 0 {
+		dims = defaultHashDims
+	}
+	return &hashEmbedder{dims: dims, batchSize: cfg.Embedder.BatchSize, concurrency: embedSemSize}, nil
+}
+
+func (e *hashEmbedder) BatchSize() int {
+	return e.batchSize
+}
+
+func (e *hashEmbedder) Concurrency() int {
+	return e.concurrency
+}
+
+func (e *hashEmbedder) Dimension(ctx context.Context) (int, error) {
+	return e.dims, nil
+}
+
+func (e *hashEmbedder) Embed(ctx context.Context, strings []string) ([][]float32, error) {
+	if len(strings) == 0 {
+		return nil, nil
+	}
+	vectors := make([][]float32, 0, len(strings))
+	for _, s := range strings {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, e.embedOne(s))
+	}
+	return vectors, nil
+}
+
+// embedOne 每个特征哈希到一个维度,哈希的最高位决定加减,最后做L2归一化
+func (e *hashEmbedder) embedOne(s string) []float32 {
+	vector := make([]float32, e.dims)
+	for _, feature := range hashFeatures(s) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		index := int(sum % uint64(e.dims))
+		if sum>>63 == 0 {
+			vector[index]++
+		} else {
+			vector[index]--
+		}
+	}
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
+
+// hashFeatures 英文等按单词切分,中文等没有空格的文字使用相邻两字作为特征
+func hashFeatures(s string) []string {
+	features := make([]string, 0)
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			features = append(features, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		if len(han) == 1 {
+			features = append(features, string(han))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			features = append(features, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return features
+}
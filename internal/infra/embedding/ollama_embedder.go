@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/LouYuanbo1/crawleragent/internal/config"
 	"github.com/cloudwego/eino-ext/components/embedding/ollama"
@@ -12,13 +12,15 @@ import (
 )
 
 type embedder struct {
-	model     *ollama.Embedder
-	batchSize int
-	embedSem  *semaphore.Weighted
+	model       *ollama.Embedder
+	batchSize   int
+	concurrency int
+	embedSem    *semaphore.Weighted
+	dimension   *dimensionProbe
 }
 
-// InitEmbedder 初始化嵌入器
-func InitEmbedder(ctx context.Context, cfg *config.Config, embedSemSize int) (Embedder, error) {
+// initOllamaEmbedder 初始化Ollama嵌入器
+func initOllamaEmbedder(ctx context.Context, cfg *config.Config, embedSemSize int) (Embedder, error) {
 	model, err := ollama.NewEmbedder(ctx, &ollama.EmbeddingConfig{
 		Model:   cfg.Embedder.Model,
 		BaseURL: cfg.Embedder.Host + ":" + strconv.Itoa(cfg.Embedder.Port),
@@ -27,7 +29,14 @@ func InitEmbedder(ctx context.Context, cfg *config.Config, embedSemSize int) (Em
 		return nil, err
 	}
 	embedSem := semaphore.NewWeighted(int64(embedSemSize))
-	return &embedder{model: model, batchSize: cfg.Embedder.BatchSize, embedSem: embedSem}, nil
+	e := &embedder{model: model, batchSize: cfg.Embedder.BatchSize, concurrency: embedSemSize, embedSem: embedSem}
+	e.dimension = newDimensionProbe(cfg.Embedder.Dims, e.Embed)
+	return e, nil
+}
+
+// Dimension 返回向量维度,配置中未指定dims时嵌入一次探测文本获取
+func (e *embedder) Dimension(ctx context.Context) (int, error) {
+	return e.dimension.get(ctx)
 }
 
 // BatchSize 返回批量处理大小
@@ -35,10 +44,14 @@ func (e *embedder) BatchSize() int {
 	return e.batchSize
 }
 
+// Concurrency 返回允许同时请求模型的数量
+func (e *embedder) Concurrency() int {
+	return e.concurrency
+}
+
 // Embed 将文本转换为向量表示
+// 超时由调用方的ctx控制,等待信号量的时间也计算在内
 func (e *embedder) Embed(ctx context.Context, strings []string) ([][]float32, error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
 	if len(strings) == 0 {
 		return nil, nil
 	}
@@ -50,7 +63,7 @@ func (e *embedder) Embed(ctx context.Context, strings []string) ([][]float32, er
 
 	embeddingVectors, err := e.model.EmbedStrings(ctx, strings)
 	if err != nil {
-		return nil, err
+		return nil, classifyOllamaError(err)
 	}
 	//EmbedStrings(ctx, strings)返回的是[][]float64类型的向量表示,需要转换为[][]float32类型(一般嵌入模型也是float32)
 	allFloat32Vectors := make([][]float32, 0, len(embeddingVectors))
@@ -64,3 +77,18 @@ func (e *embedder) Embed(ctx context.Context, strings []string) ([][]float32, er
 	}
 	return allFloat32Vectors, nil
 }
+
+// ollamaInputErrors ollama对具体输入返回的错误信息,重试也不会成功;
+// eino-ext以文本形式返回ollama的错误,状态码已经丢失,只能按错误信息判断
+var ollamaInputErrors = []string{"context length", "input length", "invalid input"}
+
+// classifyOllamaError 输入引起的错误标记为ErrPermanent,其余错误(连接失败、超时、模型加载失败等)可以重试
+func classifyOllamaError(err error) error {
+	message := strings.ToLower(err.Error())
+	for _, pattern := range ollamaInputErrors {
+		if strings.Contains(message, pattern) {
+			return fmt.Errorf("%w: %v", ErrPermanent, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"golang.org/x/sync/semaphore"
+)
+
+// openAIEmbedder 兼容OpenAI /v1/embeddings 接口的嵌入器,
+// 可用于OpenAI、llama.cpp server、vLLM等提供兼容接口的服务
+type openAIEmbedder struct {
+	client      *http.Client
+	url         string
+	apiKey      string
+	model       string
+	batchSize   int
+	concurrency int
+	embedSem    *semaphore.Weighted
+	dimension   *dimensionProbe
+}
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func initOpenAIEmbedder(cfg *config.Config, embedSemSize int) (Embedder, error) {
+	if cfg.Embedder.Host == "" {
+		return nil, fmt.Errorf("OpenAI兼容嵌入器需要配置host")
+	}
+	baseURL := strings.TrimSuffix(cfg.Embedder.Host, "/")
+	// port为0时不拼接端口,便于直接使用https://api.openai.com这类地址
+	if cfg.Embedder.Port > 0 {
+		baseURL += ":" + strconv.Itoa(cfg.Embedder.Port)
+	}
+	e := &openAIEmbedder{
+		client:      &http.Client{Timeout: 60 * time.Second},
+		url:         baseURL + "/v1/embeddings",
+		apiKey:      cfg.Embedder.APIKey,
+		model:       cfg.Embedder.Model,
+		batchSize:   cfg.Embedder.BatchSize,
+		concurrency: embedSemSize,
+		embedSem:    semaphore.NewWeighted(int64(embedSemSize)),
+	}
+	e.dimension = newDimensionProbe(cfg.Embedder.Dims, e.Embed)
+	return e, nil
+}
+
+func (e *openAIEmbedder) BatchSize() int {
+	return e.batchSize
+}
+
+func (e *openAIEmbedder) Concurrency() int {
+	return e.concurrency
+}
+
+func (e *openAIEmbedder) Dimension(ctx context.Context) (int, error) {
+	return e.dimension.get(ctx)
+}
+
+// Embed 调用/v1/embeddings接口,结果按返回的index排序,保证与输入顺序一致
+func (e *openAIEmbedder) Embed(ctx context.Context, strings []string) ([][]float32, error) {
+	if len(strings) == 0 {
+		return nil, nil
+	}
+	if err := e.embedSem.Acquire(ctx, 1); err != nil {
+		return nil, fmt.Errorf("等待词嵌入信号量超时: %w", err)
+	}
+	defer e.embedSem.Release(1)
+
+	body, err := json.Marshal(openAIEmbeddingRequest{Model: e.model, Input: strings})
+	if err != nil {
+		return nil, fmt.Errorf("序列化嵌入请求失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建嵌入请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求嵌入接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取嵌入响应失败: %w", err)
+	}
+	// 先检查状态码: 网关返回的429、502、503等错误的响应体可能是HTML或纯文本,不能按JSON解析的结果判断是否重试
+	if resp.StatusCode != http.StatusOK {
+		message := errorMessage(respBody)
+		// 429和5xx可以重试,其他4xx说明请求本身有问题,重试没有意义
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return nil, fmt.Errorf("嵌入接口返回错误 (status: %d): %s", resp.StatusCode, message)
+		}
+		return nil, fmt.Errorf("%w: 嵌入接口返回错误 (status: %d): %s", ErrPermanent, resp.StatusCode, message)
+	}
+	var embeddingResp openAIEmbeddingResponse
+	if err := json.Unmarshal(respBody, &embeddingResp); err != nil {
+		return nil, fmt.Errorf("%w: 解析嵌入响应失败: %v", ErrPermanent, err)
+	}
+	if len(embeddingResp.Data) != len(strings) {
+		return nil, fmt.Errorf("%w: 嵌入结果数量不匹配: 期望 %d, 实际 %d", ErrPermanent, len(strings), len(embeddingResp.Data))
+	}
+
+	sort.Slice(embeddingResp.Data, func(i, j int) bool {
+		return embeddingResp.Data[i].Index < embeddingResp.Data[j].Index
+	})
+	vectors := make([][]float32, 0, len(embeddingResp.Data))
+	for _, data := range embeddingResp.Data {
+		vectors = append(vectors, data.Embedding)
+	}
+	return vectors, nil
+}
+
+// errorMessage 取出错误响应中的message,不是JSON格式时使用响应体的前200个字符
+func errorMessage(body []byte) string {
+	var errorResp openAIEmbeddingResponse
+	if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error != nil {
+		return errorResp.Error.Message
+	}
+	message := []rune(strings.TrimSpace(string(body)))
+	if len(message) > 200 {
+		message = message[:200]
+	}
+	return string(message)
+}
@@ -0,0 +1,251 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+// FailurePolicy 文档词嵌入失败后的处理策略
+type FailurePolicy int
+
+const (
+	// FailureSkip 丢弃失败的文档,不写入索引
+	FailureSkip FailurePolicy = iota
+	// FailureDefer 暂存失败的文档,在下一次EmbedDocs时重新尝试
+	FailureDefer
+	// FailureIndexWithoutVector 失败的文档不带向量直接写入索引,仍可用于全文检索
+	FailureIndexWithoutVector
+)
+
+// PipelineConfig 词嵌入流水线配置
+type PipelineConfig struct {
+	// Policy 文档最终失败后的处理策略
+	Policy FailurePolicy
+	// MaxRetries 单个批次遇到可重试错误时的最大重试次数
+	MaxRetries int
+	// InitialBackoff 第一次重试前的等待时间,之后每次翻倍
+	InitialBackoff time.Duration
+	// MaxBackoff 重试等待时间的上限
+	MaxBackoff time.Duration
+	// AttemptTimeout 单次请求嵌入模型的超时时间,每次重试重新计时
+	AttemptTimeout time.Duration
+	// MaxDeferred FailureDefer策略下最多暂存的文档数量,超出时丢弃最早的文档
+	MaxDeferred int
+}
+
+// DefaultPipelineConfig 默认配置: 失败文档延后重试,每批最多重试3次
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		Policy:         FailureDefer,
+		MaxRetries:     3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     8 * time.Second,
+		AttemptTimeout: 30 * time.Second,
+		MaxDeferred:    1000,
+	}
+}
+
+// DocFailure 词嵌入失败的文档及其原因
+type DocFailure[D model.Document] struct {
+	Doc D
+	Err error
+}
+
+// EmbedResult 一次词嵌入的结果
+type EmbedResult[D model.Document] struct {
+	// Ready 可以写入索引的文档,FailureIndexWithoutVector策略下也包含没有向量的失败文档
+	Ready []D
+	// Failed 所有词嵌入失败的文档
+	Failed []DocFailure[D]
+}
+
+// Pipeline 词嵌入流水线,按批次并发调用嵌入器,可重试错误按指数退避重试整批,
+// 批次遇到不可重试的错误时逐个文档重新嵌入,定位具体失败的文档
+type Pipeline[D model.Document] interface {
+	EmbedDocs(ctx context.Context, docs []D) *EmbedResult[D]
+	// Flush 退出前重新嵌入暂存的失败文档,仍然失败的文档不再暂存,不带向量放入Ready,
+	// 避免最后几批暂存的文档没有下一次EmbedDocs而丢失
+	Flush(ctx context.Context) *EmbedResult[D]
+	// TakeDeferred 取出所有暂存的失败文档,用于退出前记录或手动处理
+	TakeDeferred() []D
+}
+
+type pipeline[D model.Document] struct {
+	embedder Embedder
+	cfg      PipelineConfig
+	mu       sync.Mutex
+	deferred []D
+}
+
+func InitPipeline[D model.Document](embedder Embedder, cfg PipelineConfig) Pipeline[D] {
+	return &pipeline[D]{embedder: embedder, cfg: cfg}
+}
+
+func (p *pipeline[D]) EmbedDocs(ctx context.Context, docs []D) *EmbedResult[D] {
+	// 之前暂存的失败文档与本次文档一起重新嵌入
+	result := p.embed(ctx, append(p.TakeDeferred(), docs...))
+	p.applyPolicy(result)
+	return result
+}
+
+func (p *pipeline[D]) Flush(ctx context.Context) *EmbedResult[D] {
+	result := p.embed(ctx, p.TakeDeferred())
+	if len(result.Failed) > 0 {
+		log.Printf("%d 个暂存的文档仍然词嵌入失败,不带向量写入索引", len(result.Failed))
+		for _, failure := range result.Failed {
+			result.Ready = append(result.Ready, failure.Doc)
+		}
+	}
+	return result
+}
+
+// embed 按批次并发嵌入文档,不处理失败的文档
+func (p *pipeline[D]) embed(ctx context.Context, docs []D) *EmbedResult[D] {
+	result := &EmbedResult[D]{Ready: make([]D, 0, len(docs))}
+	if len(docs) == 0 {
+		return result
+	}
+
+	batchSize := max(p.embedder.BatchSize(), 1)
+	sem := make(chan struct{}, max(p.embedder.Concurrency(), 1))
+	errs := make([]error, len(docs))
+	var wg sync.WaitGroup
+	for i := 0; i < len(docs); i += batchSize {
+		end := min(i+batchSize, len(docs))
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(batch []D, batchErrs []error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p.embedBatch(ctx, batch, batchErrs)
+		}(docs[i:end], errs[i:end])
+	}
+	wg.Wait()
+
+	for i, doc := range docs {
+		if errs[i] == nil {
+			result.Ready = append(result.Ready, doc)
+			continue
+		}
+		result.Failed = append(result.Failed, DocFailure[D]{Doc: doc, Err: errs[i]})
+	}
+	return result
+}
+
+func (p *pipeline[D]) TakeDeferred() []D {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	deferred := p.deferred
+	p.deferred = nil
+	return deferred
+}
+
+// embedBatch 嵌入一个批次,错误写入对应位置的errs。可重试的错误(连接失败、超时、服务端错误)影响整批输入,
+// 整批重试后仍然失败时整批失败;只有不可重试的错误(如某个输入过长)才可能由个别文档引起,此时逐个嵌入定位失败的文档
+func (p *pipeline[D]) embedBatch(ctx context.Context, batch []D, errs []error) {
+	err := p.embedWithRetry(ctx, batch)
+	if err == nil {
+		return
+	}
+	if len(batch) == 1 || ctx.Err() != nil || !errors.Is(err, ErrPermanent) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return
+	}
+	for i := range batch {
+		errs[i] = p.embedWithRetry(ctx, batch[i:i+1])
+		// 逐个嵌入时遇到可重试的错误说明服务不可用,剩余的文档不再逐个请求
+		if errs[i] != nil && !errors.Is(errs[i], ErrPermanent) {
+			for j := i + 1; j < len(batch); j++ {
+				errs[j] = errs[i]
+			}
+			return
+		}
+	}
+}
+
+func (p *pipeline[D]) embedWithRetry(ctx context.Context, batch []D) error {
+	texts := make([]string, 0, len(batch))
+	for _, doc := range batch {
+		texts = append(texts, doc.GetEmbeddingString())
+	}
+	backoff := p.cfg.InitialBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		var vectors [][]float32
+		vectors, err = p.embedOnce(ctx, texts)
+		if err == nil {
+			for i := range vectors {
+				batch[i].SetEmbedding(vectors[i])
+			}
+			return nil
+		}
+		if attempt >= p.cfg.MaxRetries || errors.Is(err, ErrPermanent) || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("词嵌入失败,%v 后进行第 %d 次重试: %v", backoff, attempt+1, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, p.cfg.MaxBackoff)
+	}
+}
+
+func (p *pipeline[D]) embedOnce(ctx context.Context, texts []string) ([][]float32, error) {
+	if p.cfg.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.AttemptTimeout)
+		defer cancel()
+	}
+	vectors, err := p.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: 嵌入结果数量不匹配: 期望 %d, 实际 %d", ErrPermanent, len(texts), len(vectors))
+	}
+	return vectors, nil
+}
+
+func (p *pipeline[D]) applyPolicy(result *EmbedResult[D]) {
+	if len(result.Failed) == 0 {
+		return
+	}
+	switch p.cfg.Policy {
+	case FailureIndexWithoutVector:
+		for _, failure := range result.Failed {
+			result.Ready = append(result.Ready, failure.Doc)
+		}
+	case FailureDefer:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, failure := range result.Failed {
+			// 不可重试的错误延后也不会成功,直接丢弃
+			if errors.Is(failure.Err, ErrPermanent) {
+				continue
+			}
+			p.deferred = append(p.deferred, failure.Doc)
+		}
+		if p.cfg.MaxDeferred > 0 && len(p.deferred) > p.cfg.MaxDeferred {
+			dropped := len(p.deferred) - p.cfg.MaxDeferred
+			log.Printf("暂存的词嵌入失败文档超过上限 %d, 丢弃最早的 %d 个", p.cfg.MaxDeferred, dropped)
+			p.deferred = p.deferred[dropped:]
+		}
+	}
+}
+
+// LogFailures 打印词嵌入失败的文档
+func LogFailures[D model.Document](result *EmbedResult[D]) {
+	for _, failure := range result.Failed {
+		log.Printf("文档 %s 词嵌入失败: %v", failure.Doc.GetID(), failure.Err)
+	}
+}
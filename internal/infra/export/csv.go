@@ -0,0 +1,64 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+type csvWriter[D any] struct {
+	file    *os.File
+	buf     *bufio.Writer
+	writer  *csv.Writer
+	columns []Column
+}
+
+func newCSVWriter[D any](filename string, columns []Column) (*csvWriter[D], error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("创建导出文件失败: %w", err)
+	}
+	buf := bufio.NewWriter(file)
+	//写入UTF-8 BOM,Excel打开时才能正确识别中文
+	buf.WriteString("\ufeff")
+	w := &csvWriter[D]{file: file, buf: buf, writer: csv.NewWriter(buf), columns: columns}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := w.writer.Write(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("写入表头失败: %w", err)
+	}
+	return w, nil
+}
+
+func (w *csvWriter[D]) Write(docs []D) error {
+	record := make([]string, len(w.columns))
+	for _, doc := range docs {
+		for i, column := range w.columns {
+			text, err := column.text(doc)
+			if err != nil {
+				return err
+			}
+			record[i] = text
+		}
+		if err := w.writer.Write(record); err != nil {
+			return fmt.Errorf("写入CSV失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter[D]) Close() error {
+	w.writer.Flush()
+	err := w.writer.Error()
+	if err == nil {
+		err = w.buf.Flush()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
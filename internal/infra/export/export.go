@@ -0,0 +1,271 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format 导出文件格式
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatParquet Format = "parquet"
+	FormatXLSX    Format = "xlsx"
+)
+
+// FormatFromFilename 根据文件扩展名判断导出格式
+func FormatFromFilename(filename string) (Format, error) {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")); ext {
+	case "csv":
+		return FormatCSV, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	case "parquet":
+		return FormatParquet, nil
+	case "xlsx":
+		return FormatXLSX, nil
+	default:
+		return "", fmt.Errorf("不支持的导出格式: %q", ext)
+	}
+}
+
+// DefaultExcluded 未指定导出列时默认排除的字段,向量体积大且在表格中没有可读性
+var DefaultExcluded = []string{"embedding"}
+
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindTime
+	// kindJSON 切片、map等复合类型,CSV/XLSX/Parquet中保存为JSON字符串
+	kindJSON
+)
+
+// Column 导出的一列,对应文档结构体的一个JSON字段
+type Column struct {
+	Name  string
+	kind  columnKind
+	index []int
+}
+
+// Columns 根据文档结构体的json标签生成导出列,匿名嵌入的结构体(如Tracking)的字段与文档字段平级
+// names为空时导出全部字段(排除DefaultExcluded),否则按names的顺序导出,字段不存在时返回错误
+func Columns[D any](names []string) ([]Column, error) {
+	var doc D
+	t := reflect.TypeOf(doc)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("文档类型 %T 不是结构体", doc)
+	}
+	all := collectColumns(t, nil)
+	if len(names) == 0 {
+		columns := make([]Column, 0, len(all))
+		for _, column := range all {
+			if !contains(DefaultExcluded, column.Name) {
+				columns = append(columns, column)
+			}
+		}
+		return columns, nil
+	}
+	byName := make(map[string]Column, len(all))
+	for _, column := range all {
+		byName[column.Name] = column
+	}
+	columns := make([]Column, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		column, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("文档类型 %s 没有字段 %q", t.Name(), name)
+		}
+		if seen[column.Name] {
+			return nil, fmt.Errorf("导出列 %q 重复", column.Name)
+		}
+		seen[column.Name] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func collectColumns(t reflect.Type, parent []int) []Column {
+	var columns []Column
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int(nil), parent...), i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, collectColumns(field.Type, index)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, Column{Name: name, kind: kindOf(field.Type), index: index})
+	}
+	return columns
+}
+
+func kindOf(t reflect.Type) columnKind {
+	if t == reflect.TypeOf(time.Time{}) {
+		return kindTime
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return kindString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return kindInt
+	case reflect.Float32, reflect.Float64:
+		return kindFloat
+	case reflect.Bool:
+		return kindBool
+	default:
+		return kindJSON
+	}
+}
+
+// value 读取文档中该列的值,文档为nil时返回零值
+func (c Column) value(doc any) reflect.Value {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v.FieldByIndex(c.index)
+}
+
+// text 将列的值格式化为字符串,用于CSV和XLSX,时间为RFC3339格式,零值时间为空
+func (c Column) text(doc any) (string, error) {
+	v := c.value(doc)
+	if !v.IsValid() {
+		return "", nil
+	}
+	switch c.kind {
+	case kindString:
+		return v.String(), nil
+	case kindInt:
+		if v.CanInt() {
+			return strconv.FormatInt(v.Int(), 10), nil
+		}
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case kindFloat:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case kindBool:
+		return strconv.FormatBool(v.Bool()), nil
+	case kindTime:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(time.RFC3339Nano), nil
+	default:
+		if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil() {
+			return "", nil
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return "", fmt.Errorf("序列化字段 %s 失败: %w", c.Name, err)
+		}
+		return string(data), nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer 按行写入导出文件,Close时写入文件尾并关闭文件
+type Writer[D any] interface {
+	Write(docs []D) error
+	Close() error
+}
+
+// InitWriter 创建导出文件并写入表头(CSV/XLSX为首行列名,Parquet为schema)
+func InitWriter[D any](filename string, format Format, columns []Column) (Writer[D], error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("没有要导出的列")
+	}
+	if dir := filepath.Dir(filename); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建导出目录失败: %w", err)
+		}
+	}
+	switch format {
+	case FormatCSV:
+		return newCSVWriter[D](filename, columns)
+	case FormatJSONL:
+		return newJSONLWriter[D](filename, columns)
+	case FormatParquet:
+		return newParquetWriter[D](filename, columns)
+	case FormatXLSX:
+		return newXLSXWriter[D](filename, columns)
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %q", format)
+	}
+}
+
+// Options 导出选项
+type Options struct {
+	// Format 为空时根据文件扩展名判断
+	Format Format
+	// Columns 导出的字段(JSON字段名),为空时导出除embedding外的全部字段
+	Columns []string
+}
+
+// Export 从stream中按批读取文档写入filename,返回写入的文档数
+// stream为存储的遍历函数,如TypedEsClient.SearchAfter、Store.Scan的包装
+func Export[D any](filename string, opts Options, stream func(fn func(docs []D) error) error) (int, error) {
+	format := opts.Format
+	if format == "" {
+		var err error
+		if format, err = FormatFromFilename(filename); err != nil {
+			return 0, err
+		}
+	}
+	columns, err := Columns[D](opts.Columns)
+	if err != nil {
+		return 0, err
+	}
+	writer, err := InitWriter[D](filename, format, columns)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	err = stream(func(docs []D) error {
+		if err := writer.Write(docs); err != nil {
+			return err
+		}
+		total += len(docs)
+		return nil
+	})
+	if closeErr := writer.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入导出文件失败: %w", closeErr)
+	}
+	return total, err
+}
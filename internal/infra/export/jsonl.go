@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type jsonlWriter[D any] struct {
+	file    *os.File
+	buf     *bufio.Writer
+	columns []Column
+	// keys 预先序列化的字段名,每行按列的顺序输出
+	keys [][]byte
+}
+
+func newJSONLWriter[D any](filename string, columns []Column) (*jsonlWriter[D], error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("创建导出文件失败: %w", err)
+	}
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		key, _ := json.Marshal(column.Name)
+		keys[i] = append(key, ':')
+	}
+	return &jsonlWriter[D]{file: file, buf: bufio.NewWriter(file), columns: columns, keys: keys}, nil
+}
+
+func (w *jsonlWriter[D]) Write(docs []D) error {
+	var line bytes.Buffer
+	for _, doc := range docs {
+		line.Reset()
+		line.WriteByte('{')
+		for i, column := range w.columns {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.Write(w.keys[i])
+			//零值时间输出null,与存储中省略零值字段的含义一致
+			var value any
+			if v := column.value(doc); v.IsValid() && !(column.kind == kindTime && v.IsZero()) {
+				value = v.Interface()
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("序列化字段 %s 失败: %w", column.Name, err)
+			}
+			line.Write(data)
+		}
+		line.WriteString("}\n")
+		if _, err := w.buf.Write(line.Bytes()); err != nil {
+			return fmt.Errorf("写入JSONL失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *jsonlWriter[D]) Close() error {
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetWriter 每列为optional的叶子节点,复合类型保存为JSON字符串,时间保存为毫秒时间戳
+type parquetWriter[D any] struct {
+	file    *os.File
+	writer  *parquet.Writer
+	columns []Column
+	// columnIndex 每列在parquet schema中的下标,parquet-go按字段名排序schema中的列
+	columnIndex []int
+	rows        []parquet.Row
+}
+
+func newParquetWriter[D any](filename string, columns []Column) (*parquetWriter[D], error) {
+	group := make(parquet.Group, len(columns))
+	for _, column := range columns {
+		group[column.Name] = parquet.Optional(parquetNode(column.kind))
+	}
+	schema := parquet.NewSchema("doc", group)
+	columnIndex := make([]int, len(columns))
+	for i, column := range columns {
+		leaf, ok := schema.Lookup(column.Name)
+		if !ok {
+			return nil, fmt.Errorf("parquet schema中没有列 %s", column.Name)
+		}
+		columnIndex[i] = leaf.ColumnIndex
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("创建导出文件失败: %w", err)
+	}
+	return &parquetWriter[D]{
+		file:        file,
+		writer:      parquet.NewWriter(file, schema),
+		columns:     columns,
+		columnIndex: columnIndex,
+	}, nil
+}
+
+func parquetNode(kind columnKind) parquet.Node {
+	switch kind {
+	case kindInt:
+		return parquet.Int(64)
+	case kindFloat:
+		return parquet.Leaf(parquet.DoubleType)
+	case kindBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case kindTime:
+		return parquet.Timestamp(parquet.Millisecond)
+	default:
+		return parquet.String()
+	}
+}
+
+func (w *parquetWriter[D]) Write(docs []D) error {
+	w.rows = w.rows[:0]
+	for _, doc := range docs {
+		row := make(parquet.Row, len(w.columns))
+		for i, column := range w.columns {
+			value, err := w.parquetValue(column, doc)
+			if err != nil {
+				return err
+			}
+			row[w.columnIndex[i]] = value.Level(0, definitionLevel(value), w.columnIndex[i])
+		}
+		w.rows = append(w.rows, row)
+	}
+	if _, err := w.writer.WriteRows(w.rows); err != nil {
+		return fmt.Errorf("写入Parquet失败: %w", err)
+	}
+	return nil
+}
+
+func (w *parquetWriter[D]) parquetValue(column Column, doc any) (parquet.Value, error) {
+	v := column.value(doc)
+	if !v.IsValid() {
+		return parquet.NullValue(), nil
+	}
+	switch column.kind {
+	case kindInt:
+		if v.CanInt() {
+			return parquet.Int64Value(v.Int()), nil
+		}
+		return parquet.Int64Value(int64(v.Uint())), nil
+	case kindFloat:
+		return parquet.DoubleValue(v.Float()), nil
+	case kindBool:
+		return parquet.BooleanValue(v.Bool()), nil
+	case kindTime:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return parquet.NullValue(), nil
+		}
+		return parquet.Int64Value(t.UnixMilli()), nil
+	default:
+		text, err := column.text(doc)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ByteArrayValue([]byte(text)), nil
+	}
+}
+
+// definitionLevel optional列有值时为1,null为0
+func definitionLevel(value parquet.Value) int {
+	if value.IsNull() {
+		return 0
+	}
+	return 1
+}
+
+func (w *parquetWriter[D]) Close() error {
+	err := w.writer.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
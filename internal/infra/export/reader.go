@@ -0,0 +1,272 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadOptions 读取导入文件的选项
+type ReadOptions struct {
+	// Format 为空时根据文件扩展名判断,支持csv和jsonl
+	Format Format
+	// Mapping 源文件的列名(JSONL为字段名)到文档JSON字段名的映射,用于导入字段名不同的外部数据;
+	// 未列出的列按同名字段读取,文档中没有对应字段的列忽略
+	Mapping map[string]string
+	// BatchSize 每批传给fn的文档数,<=0时为200
+	BatchSize int
+}
+
+// 时间字段支持的格式,导出的文件使用RFC3339
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// Read 读取CSV或JSONL文件(包括Export导出的文件),按批转换为文档后调用fn,返回读取的文档数
+// 字段值无法转换为文档字段的类型时返回带行号的错误
+func Read[D any](filename string, opts ReadOptions, fn func(docs []D) error) (int, error) {
+	format := opts.Format
+	if format == "" {
+		var err error
+		if format, err = FormatFromFilename(filename); err != nil {
+			return 0, err
+		}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 200
+	}
+	var doc D
+	t := reflect.TypeOf(doc)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return 0, fmt.Errorf("文档类型 %T 不是结构体指针", doc)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, fmt.Errorf("打开导入文件失败: %w", err)
+	}
+	defer file.Close()
+
+	batcher := &docBatcher[D]{size: opts.BatchSize, fn: fn}
+	switch format {
+	case FormatCSV:
+		err = readCSV(file, t.Elem(), opts.Mapping, batcher)
+	case FormatJSONL:
+		err = readJSONL(file, t.Elem(), opts.Mapping, batcher)
+	default:
+		return 0, fmt.Errorf("不支持导入的格式: %q, 仅支持csv和jsonl", format)
+	}
+	if err == nil {
+		err = batcher.flush()
+	}
+	return batcher.total, err
+}
+
+// docBatcher 攒够一批文档后调用fn
+type docBatcher[D any] struct {
+	size  int
+	fn    func(docs []D) error
+	batch []D
+	total int
+}
+
+func (b *docBatcher[D]) add(doc any) error {
+	b.batch = append(b.batch, doc.(D))
+	b.total++
+	if len(b.batch) >= b.size {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *docBatcher[D]) flush() error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+	err := b.fn(b.batch)
+	b.batch = nil
+	return err
+}
+
+type adder interface {
+	add(doc any) error
+}
+
+func readCSV(r io.Reader, t reflect.Type, mapping map[string]string, out adder) error {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("读取CSV表头失败: %w", err)
+	}
+	all := collectColumns(t, nil)
+	byName := make(map[string]Column, len(all))
+	for _, column := range all {
+		byName[column.Name] = column
+	}
+	//每个源列对应的文档字段,没有对应字段时为nil
+	columns := make([]*Column, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")
+		if field, ok := mapping[name]; ok {
+			name = field
+		}
+		if column, ok := byName[name]; ok {
+			columns[i] = &column
+		} else {
+			log.Printf("导入时忽略CSV列 %q: 文档中没有对应字段", header[i])
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取CSV失败: %w", err)
+		}
+		doc := reflect.New(t)
+		for i, text := range record {
+			if i >= len(columns) || columns[i] == nil || text == "" {
+				continue
+			}
+			if err := columns[i].set(doc.Elem(), text); err != nil {
+				return fmt.Errorf("第 %d 行: %w", line, err)
+			}
+		}
+		if err := out.add(doc.Interface()); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONL(r io.Reader, t reflect.Type, mapping map[string]string, out adder) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return fmt.Errorf("读取JSONL失败: %w", readErr)
+		}
+		if data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\ufeff")); len(data) > 0 {
+			if len(mapping) > 0 {
+				var err error
+				if data, err = renameKeys(data, mapping); err != nil {
+					return fmt.Errorf("第 %d 行: %w", line, err)
+				}
+			}
+			doc := reflect.New(t)
+			if err := json.Unmarshal(data, doc.Interface()); err != nil {
+				return fmt.Errorf("第 %d 行: 解析JSON失败: %w", line, err)
+			}
+			if err := out.add(doc.Interface()); err != nil {
+				return err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// renameKeys 按mapping重命名JSON对象的顶层字段
+func renameKeys(data []byte, mapping map[string]string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	renamed := make(map[string]json.RawMessage, len(object))
+	for key, value := range object {
+		if field, ok := mapping[key]; ok {
+			key = field
+		}
+		renamed[key] = value
+	}
+	return json.Marshal(renamed)
+}
+
+// set 将CSV中的文本转换为字段类型后写入文档,是text的逆操作
+func (c Column) set(doc reflect.Value, text string) error {
+	field := doc.FieldByIndex(c.index)
+	switch c.kind {
+	case kindString:
+		field.SetString(text)
+	case kindInt:
+		if field.CanInt() {
+			n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+			if err != nil {
+				return fmt.Errorf("字段 %s 不是整数: %q", c.Name, text)
+			}
+			field.SetInt(n)
+		} else {
+			n, err := strconv.ParseUint(strings.TrimSpace(text), 10, 64)
+			if err != nil {
+				return fmt.Errorf("字段 %s 不是非负整数: %q", c.Name, text)
+			}
+			field.SetUint(n)
+		}
+	case kindFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return fmt.Errorf("字段 %s 不是数字: %q", c.Name, text)
+		}
+		field.SetFloat(f)
+	case kindBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("字段 %s 不是布尔值: %q", c.Name, text)
+		}
+		field.SetBool(b)
+	case kindTime:
+		t, err := parseTime(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("字段 %s 的时间格式无法识别: %q", c.Name, text)
+		}
+		field.Set(reflect.ValueOf(t))
+	default:
+		return c.setComposite(field, strings.TrimSpace(text))
+	}
+	return nil
+}
+
+// setComposite 复合类型的字段按JSON解析;字符串切片也可以是以逗号、分号或竖线分隔的文本,便于导入外部数据
+func (c Column) setComposite(field reflect.Value, text string) error {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), field.Addr().Interface()); err != nil {
+			return fmt.Errorf("字段 %s 解析JSON失败: %w", c.Name, err)
+		}
+		return nil
+	}
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		parts := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == '，' || r == ';' || r == '；' || r == '|'
+		})
+		values := reflect.MakeSlice(field.Type(), 0, len(parts))
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part != "" {
+				values = reflect.Append(values, reflect.ValueOf(part).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(values)
+		return nil
+	}
+	return fmt.Errorf("字段 %s 需要JSON格式的值: %q", c.Name, text)
+}
+
+func parseTime(text string) (time.Time, error) {
+	var err error
+	for _, layout := range timeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxSheet = "Data"
+
+// xlsxWriter 使用excelize的流式写入,内存占用不随行数增长
+type xlsxWriter[D any] struct {
+	filename string
+	file     *excelize.File
+	stream   *excelize.StreamWriter
+	columns  []Column
+	row      int
+}
+
+func newXLSXWriter[D any](filename string, columns []Column) (*xlsxWriter[D], error) {
+	file := excelize.NewFile()
+	file.SetSheetName("Sheet1", xlsxSheet)
+	stream, err := file.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("创建Excel工作表失败: %w", err)
+	}
+	header := make([]any, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("写入表头失败: %w", err)
+	}
+	return &xlsxWriter[D]{filename: filename, file: file, stream: stream, columns: columns, row: 1}, nil
+}
+
+func (w *xlsxWriter[D]) Write(docs []D) error {
+	for _, doc := range docs {
+		w.row++
+		cells := make([]any, len(w.columns))
+		for i, column := range w.columns {
+			cell, err := xlsxCell(column, doc)
+			if err != nil {
+				return err
+			}
+			cells[i] = cell
+		}
+		axis, _ := excelize.CoordinatesToCellName(1, w.row)
+		if err := w.stream.SetRow(axis, cells); err != nil {
+			return fmt.Errorf("写入Excel失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// xlsxCell 数值和布尔值保留原类型,便于在Excel中排序和计算,其余字段写入文本
+func xlsxCell(column Column, doc any) (any, error) {
+	v := column.value(doc)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch column.kind {
+	case kindInt, kindFloat, kindBool:
+		return v.Interface(), nil
+	default:
+		return column.text(doc)
+	}
+}
+
+func (w *xlsxWriter[D]) Close() error {
+	err := w.stream.Flush()
+	if err == nil {
+		err = w.file.SaveAs(w.filename)
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,9 +1,16 @@
 package llm
 
-import "github.com/cloudwego/eino-ext/components/model/ollama"
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cloudwego/eino-ext/components/model/ollama"
+)
 
 // 定义Agent接口,用于调用模型,并处理模型返回的结果
 // 提供Invoke方法返回整个模型的输出结果和Stream方法流式输出
 type LLM interface {
 	Model() *ollama.ChatModel
+	// StructuredModel 返回输出受format约束的模型(format为JSON Schema),用于意图识别等需要解析模型输出的场景
+	StructuredModel(ctx context.Context, format json.RawMessage) (*ollama.ChatModel, error)
 }
@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 
@@ -11,21 +12,34 @@ import (
 
 // 实现AgentClient接口
 type llm struct {
-	model *ollama.ChatModel
+	model  *ollama.ChatModel
+	config *ollama.ChatModelConfig
 }
 
 func InitLLM(ctx context.Context, config *config.Config) (LLM, error) {
-	model, err := ollama.NewChatModel(ctx, &ollama.ChatModelConfig{
+	modelConfig := &ollama.ChatModelConfig{
 		BaseURL: fmt.Sprintf("%s:%d", config.LLM.Host, config.LLM.Port),
 		Model:   config.LLM.Model,
-	})
+	}
+	model, err := ollama.NewChatModel(ctx, modelConfig)
 	if err != nil {
 		log.Printf("Error adding LLM node: %v", err)
 		return nil, err
 	}
-	return &llm{model: model}, nil
+	return &llm{model: model, config: modelConfig}, nil
 }
 
 func (a *llm) Model() *ollama.ChatModel {
 	return a.model
 }
+
+// StructuredModel 与Model使用同一个模型服务,ollama按format中的JSON Schema约束输出
+func (a *llm) StructuredModel(ctx context.Context, format json.RawMessage) (*ollama.ChatModel, error) {
+	modelConfig := *a.config
+	modelConfig.Format = format
+	model, err := ollama.NewChatModel(ctx, &modelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("创建结构化输出模型失败: %w", err)
+	}
+	return model, nil
+}
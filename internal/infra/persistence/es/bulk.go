@@ -0,0 +1,135 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/esutil"
+)
+
+// BulkFailure 批量操作中失败的单个文档
+type BulkFailure struct {
+	ID     string
+	Status int
+	Reason string
+}
+
+// BulkResult 批量操作的结果,记录每个文档是否成功
+type BulkResult struct {
+	Succeeded []string
+	Failed    []BulkFailure
+}
+
+func (br *BulkResult) NumSucceeded() int {
+	return len(br.Succeeded)
+}
+
+func (br *BulkResult) NumFailed() int {
+	return len(br.Failed)
+}
+
+// Err 存在失败的文档时返回*BulkError,全部成功时返回nil
+func (br *BulkResult) Err() error {
+	if br == nil || len(br.Failed) == 0 {
+		return nil
+	}
+	return &BulkError{Result: br}
+}
+
+// BulkError 批量操作部分文档失败,可以通过errors.As取出完整的结果
+type BulkError struct {
+	Result *BulkResult
+}
+
+func (be *BulkError) Error() string {
+	first := be.Result.Failed[0]
+	return fmt.Sprintf("批量操作部分失败: 成功 %d, 失败 %d, 首个失败文档 %s (status: %d): %s",
+		be.Result.NumSucceeded(), be.Result.NumFailed(), first.ID, first.Status, first.Reason)
+}
+
+// bulkItem 待提交的批量操作,body为nil表示删除
+type bulkItem struct {
+	action string
+	id     string
+	body   []byte
+}
+
+// runBulk 向index提交批量操作并等待全部完成,按文档收集成功和失败的结果
+// 单个文档失败记录在结果中;请求本身失败(连接失败、ES不可用等)时返回error,
+// 此时结果中只包含已经确认的文档
+func (tec *typedEsClient[D]) runBulk(ctx context.Context, index string, items []bulkItem, result *BulkResult) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var mu sync.Mutex
+	var requestErr error
+	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Index:         index,            // 目标索引名称
+		Client:        tec.client,       // Elasticsearch 客户端
+		NumWorkers:    2,                // 并发工作协程数
+		FlushBytes:    5 * 1024 * 1024,  // 5MB 时自动刷新
+		FlushInterval: 30 * time.Second, // 30秒自动刷新
+		OnError: func(ctx context.Context, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if requestErr == nil {
+				requestErr = err
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("创建批量索引器失败: %w", err)
+	}
+
+	onSuccess := func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Succeeded = append(result.Succeeded, item.DocumentID)
+	}
+	onFailure := func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		failure := BulkFailure{ID: item.DocumentID, Status: res.Status}
+		switch {
+		case err != nil:
+			failure.Reason = err.Error()
+		case res.Error.Reason != "":
+			failure.Reason = fmt.Sprintf("%s: %s", res.Error.Type, res.Error.Reason)
+		default:
+			// 删除不存在的文档时没有error字段,result为not_found
+			failure.Reason = res.Result
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		result.Failed = append(result.Failed, failure)
+	}
+
+	var addErr error
+	for _, item := range items {
+		bulkItem := esutil.BulkIndexerItem{
+			Action:     item.action,
+			DocumentID: item.id,
+			OnSuccess:  onSuccess,
+			OnFailure:  onFailure,
+		}
+		if item.body != nil {
+			bulkItem.Body = bytes.NewReader(item.body)
+		}
+		if addErr = bi.Add(ctx, bulkItem); addErr != nil {
+			break
+		}
+	}
+
+	// 无论添加是否出错都要关闭,确保已经添加的文档被提交
+	closeErr := bi.Close(ctx)
+	switch {
+	case addErr != nil:
+		return fmt.Errorf("添加批量操作失败: %w", addErr)
+	case closeErr != nil:
+		return fmt.Errorf("提交批量操作失败: %w", closeErr)
+	case requestErr != nil:
+		return fmt.Errorf("批量请求失败: %w", requestErr)
+	}
+	return nil
+}
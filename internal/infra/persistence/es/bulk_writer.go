@@ -0,0 +1,359 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+// ErrBulkWriterClosed 向已关闭的BulkWriter写入文档
+var ErrBulkWriterClosed = errors.New("批量写入器已关闭")
+
+// BulkWriterConfig 长期运行的批量写入器配置
+type BulkWriterConfig struct {
+	// FlushCount 缓冲的文档数达到该值时提交
+	FlushCount int
+	// FlushBytes 缓冲的请求体达到该大小时提交
+	FlushBytes int
+	// FlushInterval 距离上次提交超过该时间时提交,保证少量文档也能及时写入
+	FlushInterval time.Duration
+	// QueueSize 等待写入的文档队列长度,队列满时Add阻塞,形成背压
+	QueueSize int
+	// MaxRetries 请求整体失败或文档被限流(429)时的最大重试次数
+	MaxRetries int
+	// RequestTimeout 单次bulk请求的超时时间
+	RequestTimeout time.Duration
+	// MaxKeptFailures 两次Flush之间最多保留的失败记录数,超出的只计数
+	MaxKeptFailures int
+}
+
+func DefaultBulkWriterConfig() BulkWriterConfig {
+	return BulkWriterConfig{
+		FlushCount:      500,
+		FlushBytes:      5 * 1024 * 1024,
+		FlushInterval:   time.Second,
+		QueueSize:       1000,
+		MaxRetries:      3,
+		RequestTimeout:  30 * time.Second,
+		MaxKeptFailures: 1000,
+	}
+}
+
+// BulkWriterStats 批量写入器的累计统计
+type BulkWriterStats struct {
+	Added   int64
+	Indexed int64
+	Failed  int64
+	Flushes int64
+	// Queued 当前排队等待提交的文档数
+	Queued int
+}
+
+// BulkWriter 长期运行的单索引批量写入器,多个服务可以同时写入同一个BulkWriter,
+// 文档按数量、大小或时间间隔合并为一次bulk请求,ES变慢时队列写满,Add会阻塞调用方
+type BulkWriter[D model.Document] interface {
+	// Add 将文档加入写入队列,队列满时阻塞直到有空间、ctx取消或写入器关闭
+	Add(ctx context.Context, docs []D) error
+	// Flush 提交所有已加入的文档并等待完成,返回上次Flush以来失败的文档(*BulkError)
+	Flush(ctx context.Context) error
+	// Close 提交剩余的文档后停止写入器
+	Close(ctx context.Context) error
+	Stats() BulkWriterStats
+}
+
+type bulkDoc struct {
+	id   string
+	body []byte
+}
+
+type bulkWriter[D model.Document] struct {
+	client  TypedEsClient[D]
+	cfg     BulkWriterConfig
+	queue   chan bulkDoc
+	flushCh chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	// closeMu保护closed,Add持有读锁期间写入器不会关闭队列
+	closeMu sync.RWMutex
+	closed  bool
+
+	mu       sync.Mutex
+	failures []BulkFailure
+	dropped  int
+
+	added   atomic.Int64
+	indexed atomic.Int64
+	failed  atomic.Int64
+	flushes atomic.Int64
+}
+
+// InitBulkWriter 创建并启动写入client.Index()的批量写入器,cfg中未设置(<=0)的项使用默认值
+// 每次提交时读取索引名,因此CreateIndexWithMapping切换索引后也会写入新索引
+func InitBulkWriter[D model.Document](client TypedEsClient[D], cfg BulkWriterConfig) BulkWriter[D] {
+	defaults := DefaultBulkWriterConfig()
+	if cfg.FlushCount <= 0 {
+		cfg.FlushCount = defaults.FlushCount
+	}
+	if cfg.FlushBytes <= 0 {
+		cfg.FlushBytes = defaults.FlushBytes
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaults.FlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaults.MaxRetries
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = defaults.RequestTimeout
+	}
+	if cfg.MaxKeptFailures <= 0 {
+		cfg.MaxKeptFailures = defaults.MaxKeptFailures
+	}
+	bw := &bulkWriter[D]{
+		client:  client,
+		cfg:     cfg,
+		queue:   make(chan bulkDoc, cfg.QueueSize),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go bw.run()
+	return bw
+}
+
+func (bw *bulkWriter[D]) Add(ctx context.Context, docs []D) error {
+	bw.closeMu.RLock()
+	defer bw.closeMu.RUnlock()
+	if bw.closed {
+		return ErrBulkWriterClosed
+	}
+	for _, doc := range docs {
+		body, err := json.Marshal(doc)
+		if err != nil {
+			bw.recordFailures([]BulkFailure{{ID: doc.GetID(), Reason: fmt.Sprintf("序列化文档失败: %s", err)}})
+			continue
+		}
+		select {
+		case bw.queue <- bulkDoc{id: doc.GetID(), body: body}:
+			bw.added.Add(1)
+		case <-ctx.Done():
+			return fmt.Errorf("等待写入队列超时: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+func (bw *bulkWriter[D]) Flush(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case bw.flushCh <- reply:
+	case <-bw.stopped:
+		return bw.takeFailures()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return bw.takeFailures()
+}
+
+func (bw *bulkWriter[D]) Close(ctx context.Context) error {
+	bw.closeMu.Lock()
+	if !bw.closed {
+		bw.closed = true
+		close(bw.done)
+	}
+	bw.closeMu.Unlock()
+	select {
+	case <-bw.stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("等待批量写入器关闭超时: %w", ctx.Err())
+	}
+	return bw.takeFailures()
+}
+
+func (bw *bulkWriter[D]) Stats() BulkWriterStats {
+	return BulkWriterStats{
+		Added:   bw.added.Load(),
+		Indexed: bw.indexed.Load(),
+		Failed:  bw.failed.Load(),
+		Flushes: bw.flushes.Load(),
+		Queued:  len(bw.queue),
+	}
+}
+
+// run 后台协程,唯一的队列消费者;同一时间只有一个bulk请求,请求变慢时队列自然积压
+func (bw *bulkWriter[D]) run() {
+	defer close(bw.stopped)
+	ticker := time.NewTicker(bw.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]bulkDoc, 0, bw.cfg.FlushCount)
+	size := 0
+	add := func(doc bulkDoc) {
+		batch = append(batch, doc)
+		size += len(doc.body)
+		if len(batch) >= bw.cfg.FlushCount || size >= bw.cfg.FlushBytes {
+			bw.commit(batch)
+			batch, size = batch[:0], 0
+		}
+	}
+	// drain 取出队列中已有的文档,不等待新文档
+	drain := func() {
+		for {
+			select {
+			case doc := <-bw.queue:
+				add(doc)
+			default:
+				return
+			}
+		}
+	}
+	flush := func() {
+		drain()
+		if len(batch) > 0 {
+			bw.commit(batch)
+			batch, size = batch[:0], 0
+		}
+	}
+
+	for {
+		select {
+		case doc := <-bw.queue:
+			add(doc)
+		case <-ticker.C:
+			flush()
+		case reply := <-bw.flushCh:
+			flush()
+			close(reply)
+		case <-bw.done:
+			// 关闭后Add不会再写入队列,提交剩余文档后退出
+			flush()
+			return
+		}
+	}
+}
+
+// commit 提交一批文档,请求失败或文档被限流时按指数退避重试
+func (bw *bulkWriter[D]) commit(batch []bulkDoc) {
+	bw.flushes.Add(1)
+	pending := batch
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		retry, failures, err := bw.send(pending)
+		if err == nil && len(retry) == 0 {
+			bw.recordFailures(failures)
+			return
+		}
+		if attempt >= bw.cfg.MaxRetries {
+			if err != nil {
+				for _, doc := range pending {
+					failures = append(failures, BulkFailure{ID: doc.id, Reason: err.Error()})
+				}
+			} else {
+				for _, doc := range retry {
+					failures = append(failures, BulkFailure{ID: doc.id, Status: 429, Reason: "重试后仍被限流"})
+				}
+			}
+			bw.recordFailures(failures)
+			return
+		}
+		bw.recordFailures(failures)
+		if err == nil {
+			pending = retry
+		}
+		log.Printf("批量写入 %s 失败,%v 后进行第 %d 次重试 (%d 个文档): %v", bw.client.Index(), backoff, attempt+1, len(pending), err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 8*time.Second)
+	}
+}
+
+// send 发送一次bulk请求,返回需要重试的文档(被限流)和失败的文档;请求整体失败时返回error
+func (bw *bulkWriter[D]) send(batch []bulkDoc) ([]bulkDoc, []BulkFailure, error) {
+	var body bytes.Buffer
+	for _, doc := range batch {
+		meta, _ := json.Marshal(map[string]map[string]string{"index": {"_id": doc.id}})
+		body.Write(meta)
+		body.WriteByte('\n')
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bw.cfg.RequestTimeout)
+	defer cancel()
+	resp, err := bw.client.GetClient().Bulk().Index(bw.client.Index()).Raw(&body).Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var retry []bulkDoc
+	var failures []BulkFailure
+	indexed := 0
+	for i, item := range resp.Items {
+		if i >= len(batch) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status < 300:
+				indexed++
+			case result.Status == 429:
+				retry = append(retry, batch[i])
+			default:
+				failure := BulkFailure{ID: batch[i].id, Status: result.Status}
+				if result.Error != nil && result.Error.Reason != nil {
+					failure.Reason = fmt.Sprintf("%s: %s", result.Error.Type, *result.Error.Reason)
+				}
+				failures = append(failures, failure)
+			}
+		}
+	}
+	bw.indexed.Add(int64(indexed))
+	return retry, failures, nil
+}
+
+func (bw *bulkWriter[D]) recordFailures(failures []BulkFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	bw.failed.Add(int64(len(failures)))
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	for _, failure := range failures {
+		log.Printf("写入文档 %s 到 %s 失败 (status: %d): %s", failure.ID, bw.client.Index(), failure.Status, failure.Reason)
+		if len(bw.failures) >= bw.cfg.MaxKeptFailures {
+			bw.dropped++
+			continue
+		}
+		bw.failures = append(bw.failures, failure)
+	}
+}
+
+// takeFailures 取出上次调用以来的失败记录
+func (bw *bulkWriter[D]) takeFailures() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if len(bw.failures) == 0 {
+		return nil
+	}
+	result := &BulkResult{Failed: bw.failures}
+	if bw.dropped > 0 {
+		log.Printf("另有 %d 个失败文档未保留详细信息", bw.dropped)
+	}
+	bw.failures, bw.dropped = nil, 0
+	return result.Err()
+}
@@ -2,12 +2,16 @@ package es
 
 import (
 	"context"
+	"errors"
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 	"github.com/elastic/go-elasticsearch/v9"
 	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
 )
 
+// ErrEmbeddingDimsMismatch 已有索引的embedding维度与嵌入模型的向量维度不一致
+var ErrEmbeddingDimsMismatch = errors.New("embedding维度与索引映射不一致")
+
 /*
 // 所有的文档结构体要实现这两个函数
 
@@ -18,15 +22,25 @@ import (
 */
 type TypedEsClient[D model.Document] interface {
 	GetClient() *elasticsearch.TypedClient
-	CreateIndexWithMapping(ctx context.Context) error
+	Index() string
+	CreateIndexWithMapping(ctx context.Context, dims int) error
 	DeleteIndex(ctx context.Context) error
 	IndexDocWithID(ctx context.Context, doc D) error
-	BulkIndexDocsWithID(ctx context.Context, docs []D) error
+	BulkIndexDocsWithID(ctx context.Context, docs []D) (*BulkResult, error)
 	GetDoc(ctx context.Context, id string) (D, error)
 	CountDocs(ctx context.Context) (int64, error)
 	SearchDoc(ctx context.Context, query *types.Query, from, size int) ([]D, int64, error)
 	UpdateDoc(ctx context.Context, doc D) error
 	DeleteDoc(ctx context.Context, id string) error
-	BulkDeleteDocs(ctx context.Context, ids []string) error
+	BulkDeleteDocs(ctx context.Context, ids []string) (*BulkResult, error)
 	ToExcel(ctx context.Context, filename string, sortFields []string, size int) error
+	ScanDocs(ctx context.Context, batchSize int, fn func(docs []D) error) error
+	// SearchAfter 使用point in time和search_after按查询和排序分批读取文档
+	SearchAfter(ctx context.Context, query *types.Query, sort []string, batchSize, limit int, fn func(docs []D) error) error
+	// Export 流式导出文档为CSV、JSONL、Parquet或XLSX
+	Export(ctx context.Context, filename string, opts ExportOptions) (int, error)
+	// ValidateMapping 比较代码生成的映射与线上映射,返回不一致的字段属性
+	ValidateMapping(ctx context.Context, dims int) ([]MappingDiff, error)
+	// Migrate 创建新版本的物理索引,复制(必要时重新嵌入)数据后原子地切换别名
+	Migrate(ctx context.Context, opts MigrateOptions[D]) (*MigrateResult, error)
 }
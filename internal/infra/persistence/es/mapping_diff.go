@@ -0,0 +1,148 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// MappingDiff 生成的映射与线上索引映射不一致的一处字段属性
+type MappingDiff struct {
+	// Field 字段路径,子字段形如 title.keyword
+	Field string
+	// Attr 不一致的属性,如 type、analyzer、dims
+	Attr     string
+	Expected string
+	// Live 线上索引中的值,字段不存在时为 "<missing>"
+	Live string
+}
+
+func (d MappingDiff) String() string {
+	return fmt.Sprintf("%s.%s: 期望 %s, 实际 %s", d.Field, d.Attr, d.Expected, d.Live)
+}
+
+// 参与比较的字段属性,其他属性(如ignore_above)不影响检索行为,不做比较
+var diffAttrs = []string{"type", "analyzer", "search_analyzer", "index", "enabled", "dims", "similarity"}
+
+const missingField = "<missing>"
+
+// DiffMapping 比较生成的映射和线上映射,只检查生成的映射中声明的字段,
+// 线上映射中多出的字段(如动态映射产生的字段)不算差异
+func DiffMapping(expected, live *types.TypeMapping) ([]MappingDiff, error) {
+	if expected == nil {
+		return nil, nil
+	}
+	expectedProps, err := mappingProperties(expected.Properties)
+	if err != nil {
+		return nil, err
+	}
+	var liveProps map[string]any
+	if live != nil {
+		liveProps, err = mappingProperties(live.Properties)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var diffs []MappingDiff
+	diffProperties("", expectedProps, liveProps, &diffs)
+	return diffs, nil
+}
+
+// mappingProperties 将映射序列化为通用的map,便于不同类型的Property统一比较
+func mappingProperties(properties map[string]types.Property) (map[string]any, error) {
+	data, err := json.Marshal(properties)
+	if err != nil {
+		return nil, fmt.Errorf("序列化映射失败: %w", err)
+	}
+	var props map[string]any
+	if err := json.Unmarshal(data, &props); err != nil {
+		return nil, fmt.Errorf("解析映射失败: %w", err)
+	}
+	return props, nil
+}
+
+func diffProperties(prefix string, expected, live map[string]any, diffs *[]MappingDiff) {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := prefix + name
+		expectedField, _ := expected[name].(map[string]any)
+		liveField, ok := live[name].(map[string]any)
+		if !ok {
+			*diffs = append(*diffs, MappingDiff{Field: field, Attr: "type", Expected: attrString(expectedField["type"]), Live: missingField})
+			continue
+		}
+		for _, attr := range diffAttrs {
+			expectedValue, ok := expectedField[attr]
+			if !ok {
+				//代码中去掉了分词器(改回standard)而线上仍使用原分词器
+				if (attr == "analyzer" || attr == "search_analyzer") && liveField[attr] != nil {
+					*diffs = append(*diffs, MappingDiff{Field: field, Attr: attr, Expected: "<default>", Live: attrString(liveField[attr])})
+				}
+				continue
+			}
+			if liveValue := attrString(liveField[attr]); attrString(expectedValue) != liveValue && !defaultAttr(attr, expectedValue, liveField[attr]) {
+				*diffs = append(*diffs, MappingDiff{Field: field, Attr: attr, Expected: attrString(expectedValue), Live: liveValue})
+			}
+		}
+		if subProps, ok := expectedField["properties"].(map[string]any); ok {
+			liveSub, _ := liveField["properties"].(map[string]any)
+			diffProperties(field+".", subProps, liveSub, diffs)
+		}
+		if subFields, ok := expectedField["fields"].(map[string]any); ok {
+			liveSub, _ := liveField["fields"].(map[string]any)
+			diffProperties(field+".", subFields, liveSub, diffs)
+		}
+	}
+}
+
+// defaultAttr 线上映射省略了取默认值的属性,如index=true、enabled=true
+func defaultAttr(attr string, expected, live any) bool {
+	if live != nil {
+		return false
+	}
+	switch attr {
+	case "index", "enabled":
+		return attrString(expected) == "true"
+	}
+	return false
+}
+
+func attrString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return missingField
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ValidateMapping 比较当前代码生成的映射与线上索引的映射,返回不一致的字段属性
+// 映射变化(如更换分词器)后需要运行cmd/migrate迁移到新版本的索引才能生效
+func (tec *typedEsClient[D]) ValidateMapping(ctx context.Context, dims int) ([]MappingDiff, error) {
+	expected, err := tec.typeMapping(dims)
+	if err != nil {
+		return nil, err
+	}
+	if expected == nil {
+		return nil, nil
+	}
+	getMappingResponse, err := tec.client.Indices.GetMapping().Index(tec.Index()).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index mapping: %s", err)
+	}
+	//通过别名读取时响应的键为物理索引名,只有一个
+	for _, record := range getMappingResponse {
+		return DiffMapping(expected, &record.Mappings)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, tec.Index())
+}
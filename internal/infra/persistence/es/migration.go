@@ -0,0 +1,339 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/core/reindex"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// 物理索引命名为 "<别名>_v<版本>",服务只通过别名(文档的GetIndex())读写,
+// 修改映射或更换嵌入模型时由Migrate创建新版本的索引并切换别名,正在运行的服务无需重启
+
+// ErrIndexNotFound 迁移时别名和同名索引都不存在
+var ErrIndexNotFound = errors.New("索引不存在")
+
+// MigrateOptions 迁移选项
+type MigrateOptions[D model.Document] struct {
+	// Dims 新索引的向量维度
+	Dims int
+	// Reembed 重新生成词嵌入,返回写入新索引的文档;向量维度变化或ForceReembed时必须提供
+	Reembed func(ctx context.Context, docs []D) ([]D, error)
+	// ForceReembed 维度不变时也重新生成词嵌入(如更换了同维度的嵌入模型)
+	ForceReembed bool
+	// DeleteOld 切换别名后删除旧的物理索引,默认保留以便回滚
+	DeleteOld bool
+	// BatchSize 重新嵌入时每批读取的文档数
+	BatchSize int
+}
+
+// MigrateResult 迁移结果
+type MigrateResult struct {
+	Alias      string
+	From       string
+	To         string
+	Copied     int64
+	Reembedded bool
+}
+
+func versionedIndex(alias string, version int) string {
+	return fmt.Sprintf("%s_v%d", alias, version)
+}
+
+// createAliasedIndex 创建第一个版本的物理索引,并将别名指向它
+func (tec *typedEsClient[D]) createAliasedIndex(ctx context.Context, alias string, dims int) error {
+	mapping, err := tec.typeMapping(dims)
+	if err != nil {
+		return err
+	}
+	index := versionedIndex(alias, 1)
+	isWriteIndex := true
+	_, err = tec.client.Indices.Create(index).
+		Mappings(mapping).
+		Aliases(map[string]types.Alias{alias: {IsWriteIndex: &isWriteIndex}}).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create index in es: %s", err)
+	}
+	log.Printf("创建索引 %s, 别名 %s", index, alias)
+	tec.index = alias
+	return nil
+}
+
+// resolveAlias 返回别名当前指向的物理索引;legacy为true表示存在与别名同名的普通索引(引入别名之前创建的)
+func (tec *typedEsClient[D]) resolveAlias(ctx context.Context, alias string) (index string, legacy bool, err error) {
+	isAlias, err := tec.client.Indices.ExistsAlias(alias).Do(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("检查别名失败: %w", err)
+	}
+	if isAlias {
+		resp, err := tec.client.Indices.GetAlias().Name(alias).Do(ctx)
+		if err != nil {
+			return "", false, fmt.Errorf("获取别名失败: %w", err)
+		}
+		if len(resp) != 1 {
+			return "", false, fmt.Errorf("别名 %s 指向 %d 个索引, 无法确定迁移的源索引", alias, len(resp))
+		}
+		for index := range resp {
+			return index, false, nil
+		}
+	}
+	exists, err := tec.client.Indices.Exists(alias).Do(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check index existence in es: %s", err)
+	}
+	if !exists {
+		return "", false, fmt.Errorf("%w: %s", ErrIndexNotFound, alias)
+	}
+	return alias, true, nil
+}
+
+// migrationSource 返回要迁移的别名(或普通索引):已经EnsureIndex时为实际读写的索引,
+// 否则按新维度用indexForDims确定;带维度后缀的索引还不存在时迁移文档索引本身
+func (tec *typedEsClient[D]) migrationSource(ctx context.Context, dims int) (string, error) {
+	base := tec.schemaDoc.GetIndex()
+	if tec.index != base {
+		return tec.index, nil
+	}
+	index, _, err := tec.indexForDims(ctx, dims)
+	if err != nil || index == base {
+		return index, err
+	}
+	exists, err := tec.client.Indices.Exists(index).Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check index existence in es: %s", err)
+	}
+	if !exists {
+		return base, nil
+	}
+	return index, nil
+}
+
+// nextVersion 返回已有的 "<别名>_v<版本>" 索引中最大的版本号加1
+func (tec *typedEsClient[D]) nextVersion(ctx context.Context, alias string) (int, error) {
+	resp, err := tec.client.Indices.Get(alias + "_v*").Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("查询已有索引版本失败: %w", err)
+	}
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(alias) + `_v(\d+)$`)
+	latest := 0
+	for index := range resp {
+		if match := pattern.FindStringSubmatch(index); match != nil {
+			if version, _ := strconv.Atoi(match[1]); version > latest {
+				latest = version
+			}
+		}
+	}
+	return latest + 1, nil
+}
+
+// Migrate 按当前的映射创建新版本的物理索引,复制数据后原子地将别名切换到新索引
+// 迁移的源与服务读写的索引相同(见indexForDims),开启create_index_on_dims_mismatch后服务使用的
+// "<索引名>_dims<维度>" 索引会迁移为 "<索引名>_dims<维度>_v<版本>"
+// 向量维度变化或ForceReembed时在客户端逐批重新嵌入后写入,否则使用_reindex在服务端复制
+// 引入别名之前创建的同名普通索引在切换前克隆为 "<别名>_v0" 备份,别名切换成功后才按DeleteOld删除备份
+// 迁移过程中写入旧索引的文档可能不会被复制,建议在爬虫停止时运行;复制失败时不切换别名,保留新索引以便排查
+func (tec *typedEsClient[D]) Migrate(ctx context.Context, opts MigrateOptions[D]) (*MigrateResult, error) {
+	alias, err := tec.migrationSource(ctx, opts.Dims)
+	if err != nil {
+		return nil, err
+	}
+	from, legacy, err := tec.resolveAlias(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	oldDims, err := tec.embeddingDims(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	reembed := opts.ForceReembed || (oldDims != 0 && oldDims != opts.Dims)
+	if reembed && opts.Reembed == nil {
+		return nil, fmt.Errorf("%w: 索引 %s 的embedding维度为 %d, 新维度为 %d, 迁移需要重新嵌入",
+			ErrEmbeddingDimsMismatch, from, oldDims, opts.Dims)
+	}
+
+	version, err := tec.nextVersion(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := tec.typeMapping(opts.Dims)
+	if err != nil {
+		return nil, err
+	}
+	to := versionedIndex(alias, version)
+	if _, err := tec.client.Indices.Create(to).Mappings(mapping).Do(ctx); err != nil {
+		return nil, fmt.Errorf("创建索引 %s 失败: %w", to, err)
+	}
+	log.Printf("迁移 %s: %s -> %s (重新嵌入: %t)", alias, from, to, reembed)
+
+	result := &MigrateResult{Alias: alias, From: from, To: to, Reembedded: reembed}
+	if reembed {
+		err = tec.copyWithReembed(ctx, from, to, opts, result)
+	} else {
+		err = tec.reindex(ctx, from, to, result)
+	}
+	if err != nil {
+		return result, fmt.Errorf("复制 %s 到 %s 失败, 未切换别名, 新索引已保留: %w", from, to, err)
+	}
+	if _, err := tec.client.Indices.Refresh().Index(to).Do(ctx); err != nil {
+		return result, fmt.Errorf("刷新索引 %s 失败: %w", to, err)
+	}
+
+	if err := tec.swapAlias(ctx, alias, from, to, legacy, opts.DeleteOld); err != nil {
+		return result, err
+	}
+	tec.index = alias
+	log.Printf("迁移 %s 完成: 别名已指向 %s, 复制 %d 个文档", alias, to, result.Copied)
+	return result, nil
+}
+
+// reindex 使用_reindex在服务端复制文档,以后台任务运行并轮询结果,避免大索引复制时请求超时
+func (tec *typedEsClient[D]) reindex(ctx context.Context, from, to string, result *MigrateResult) error {
+	resp, err := tec.client.Reindex().
+		Source(&types.ReindexSource{Index: []string{from}}).
+		Dest(&types.ReindexDestination{Index: to}).
+		WaitForCompletion(false).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	if resp.Task == nil {
+		return fmt.Errorf("_reindex没有返回任务ID")
+	}
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("等待_reindex任务 %s 超时: %w", *resp.Task, ctx.Err())
+		case <-ticker.C:
+		}
+		task, err := tec.client.Tasks.Get(*resp.Task).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("查询_reindex任务 %s 失败: %w", *resp.Task, err)
+		}
+		if !task.Completed {
+			continue
+		}
+		if task.Error != nil {
+			return fmt.Errorf("_reindex任务失败: %s", task.Error.Type)
+		}
+		var taskResult reindex.Response
+		if err := json.Unmarshal(task.Response, &taskResult); err != nil {
+			return fmt.Errorf("解析_reindex结果失败: %w", err)
+		}
+		if taskResult.Total != nil {
+			result.Copied = *taskResult.Total
+		}
+		if len(taskResult.Failures) > 0 {
+			first := taskResult.Failures[0]
+			return fmt.Errorf("%d 个文档复制失败, 首个失败文档 %s: %s", len(taskResult.Failures), first.Id, first.Cause.Type)
+		}
+		return nil
+	}
+}
+
+// copyWithReembed 逐批读取旧索引的文档,重新嵌入后写入新索引,任意文档写入失败时返回错误
+func (tec *typedEsClient[D]) copyWithReembed(ctx context.Context, from, to string, opts MigrateOptions[D], result *MigrateResult) error {
+	return tec.scanIndex(ctx, from, opts.BatchSize, func(docs []D) error {
+		docs, err := opts.Reembed(ctx, docs)
+		if err != nil {
+			return fmt.Errorf("重新嵌入失败: %w", err)
+		}
+		items := make([]bulkItem, 0, len(docs))
+		for _, doc := range docs {
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return fmt.Errorf("序列化文档 %s 失败: %w", doc.GetID(), err)
+			}
+			items = append(items, bulkItem{action: "index", id: doc.GetID(), body: data})
+		}
+		bulkResult := &BulkResult{}
+		if err := tec.runBulk(ctx, to, items, bulkResult); err != nil {
+			return err
+		}
+		if err := bulkResult.Err(); err != nil {
+			return err
+		}
+		result.Copied += int64(bulkResult.NumSucceeded())
+		log.Printf("已复制 %d 个文档到 %s", result.Copied, to)
+		return nil
+	})
+}
+
+// swapAlias 在一次请求中将别名从from切换到to,保证读写不会落到没有别名的时间窗口
+// 旧索引只在别名切换成功之后删除:普通别名先移除别名,成功后按deleteOld删除旧索引;
+// 与别名同名的旧索引必须在添加别名的同一个请求中移除,因此先禁止写入并克隆为备份,切换成功后按deleteOld删除备份
+func (tec *typedEsClient[D]) swapAlias(ctx context.Context, alias, from, to string, legacy, deleteOld bool) error {
+	isWriteIndex := true
+	actions := []types.IndicesActionVariant{
+		&types.IndicesAction{Add: &types.AddAction{Index: &to, Alias: &alias, IsWriteIndex: &isWriteIndex}},
+	}
+	old := from
+	if legacy {
+		backup, err := tec.backupLegacyIndex(ctx, alias, from)
+		if err != nil {
+			return err
+		}
+		old = backup
+		actions = append(actions, &types.IndicesAction{RemoveIndex: &types.RemoveIndexAction{Index: &from}})
+	} else {
+		actions = append(actions, &types.IndicesAction{Remove: &types.RemoveAction{Index: &from, Alias: &alias}})
+	}
+	if _, err := tec.client.Indices.UpdateAliases().Actions(actions...).Do(ctx); err != nil {
+		if legacy {
+			tec.setWriteBlock(ctx, from, false)
+		}
+		return fmt.Errorf("切换别名 %s 到 %s 失败: %w", alias, to, err)
+	}
+	if !deleteOld {
+		log.Printf("旧索引 %s 已保留, 可用于回滚", old)
+		return nil
+	}
+	// 别名已经切换,删除失败不影响迁移结果
+	if _, err := tec.client.Indices.Delete(old).Do(ctx); err != nil {
+		log.Printf("删除旧索引 %s 失败, 请手动删除: %v", old, err)
+	}
+	return nil
+}
+
+// backupLegacyIndex 禁止写入与别名同名的旧索引并克隆为 "<别名>_v0",返回备份索引名
+func (tec *typedEsClient[D]) backupLegacyIndex(ctx context.Context, alias, from string) (string, error) {
+	backup := versionedIndex(alias, 0)
+	if err := tec.setWriteBlock(ctx, from, true); err != nil {
+		return "", err
+	}
+	if _, err := tec.client.Indices.Clone(from, backup).Do(ctx); err != nil {
+		tec.setWriteBlock(ctx, from, false)
+		return "", fmt.Errorf("备份旧索引 %s 到 %s 失败, 未切换别名: %w", from, backup, err)
+	}
+	// 克隆出的索引继承了写入限制,解除后才能作为普通索引回滚
+	if err := tec.setWriteBlock(ctx, backup, false); err != nil {
+		log.Printf("解除备份索引 %s 的写入限制失败: %v", backup, err)
+	}
+	log.Printf("旧索引 %s 已备份为 %s", from, backup)
+	return backup, nil
+}
+
+// setWriteBlock 设置或解除索引的写入限制,解除失败只打印日志
+func (tec *typedEsClient[D]) setWriteBlock(ctx context.Context, index string, block bool) error {
+	_, err := tec.client.Indices.PutSettings().Indices(index).
+		Blocks(&types.IndexSettingBlocks{Write: block}).
+		Do(ctx)
+	if err == nil {
+		return nil
+	}
+	if !block {
+		log.Printf("解除索引 %s 的写入限制失败: %v", index, err)
+		return nil
+	}
+	return fmt.Errorf("禁止写入索引 %s 失败: %w", index, err)
+}
@@ -0,0 +1,149 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/LouYuanbo1/crawleragent/internal/infra/export"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
+)
+
+// ScanDocs 使用point in time和search_after按批遍历当前索引的全部文档(包含向量),fn返回错误时停止遍历
+// 遍历的是打开point in time时的快照,fn中写入同一个索引不影响遍历
+func (tec *typedEsClient[D]) ScanDocs(ctx context.Context, batchSize int, fn func(docs []D) error) error {
+	return tec.scanIndex(ctx, tec.index, batchSize, fn)
+}
+
+func (tec *typedEsClient[D]) scanIndex(ctx context.Context, index string, batchSize int, fn func(docs []D) error) error {
+	return tec.searchAfter(ctx, index, nil, nil, batchSize, 0, fn)
+}
+
+// SearchAfter 使用point in time和search_after按query和sort的顺序分批读取文档,最多读取limit个(<=0时不限制)
+// query为nil时读取全部文档;sort中的字段为"字段"(升序)、"-字段"或"字段:desc"(降序),
+// text字段不能排序,需使用其keyword子字段(如title.keyword);末尾自动追加_shard_doc保证翻页稳定
+func (tec *typedEsClient[D]) SearchAfter(ctx context.Context, query *types.Query, sort []string, batchSize, limit int, fn func(docs []D) error) error {
+	sortOptions, err := parseSort(sort)
+	if err != nil {
+		return err
+	}
+	return tec.searchAfter(ctx, tec.index, query, sortOptions, batchSize, limit, fn)
+}
+
+func parseSort(fields []string) ([]types.SortCombinations, error) {
+	sortOptions := make([]types.SortCombinations, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		order := sortorder.Asc
+		if name, ok := strings.CutPrefix(field, "-"); ok {
+			field, order = name, sortorder.Desc
+		} else if name, dir, ok := strings.Cut(field, ":"); ok {
+			field = name
+			switch strings.ToLower(dir) {
+			case "asc":
+			case "desc":
+				order = sortorder.Desc
+			default:
+				return nil, fmt.Errorf("无效的排序方向: %q", dir)
+			}
+		}
+		if field == "" {
+			return nil, fmt.Errorf("排序字段为空")
+		}
+		sortOptions = append(sortOptions, types.SortOptions{
+			SortOptions: map[string]types.FieldSort{field: {Order: &order}},
+		})
+	}
+	return sortOptions, nil
+}
+
+func (tec *typedEsClient[D]) searchAfter(ctx context.Context, index string, query *types.Query, sort []types.SortCombinations, batchSize, limit int, fn func(docs []D) error) error {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	pit, err := tec.client.OpenPointInTime(index).KeepAlive("1m").Do(ctx)
+	if err != nil {
+		return fmt.Errorf("打开point in time失败: %w", err)
+	}
+	pitID := pit.Id
+	defer func() {
+		if _, err := tec.client.ClosePointInTime().Id(pitID).Do(context.Background()); err != nil {
+			log.Printf("关闭point in time失败: %v", err)
+		}
+	}()
+
+	sort = append(sort, "_shard_doc")
+	var after []types.FieldValue
+	read := 0
+	for {
+		size := batchSize
+		if limit > 0 && limit-read < size {
+			size = limit - read
+		}
+		resp, err := tec.client.Search().Request(&search.Request{
+			Pit:         &types.PointInTimeReference{Id: pitID, KeepAlive: "1m"},
+			Query:       query,
+			Sort:        sort,
+			SearchAfter: after,
+			Size:        &size,
+		}).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("遍历文档失败: %w", err)
+		}
+		if resp.PitId != nil {
+			pitID = *resp.PitId
+		}
+		hits := resp.Hits.Hits
+		if len(hits) == 0 {
+			return nil
+		}
+		docs := make([]D, 0, len(hits))
+		for _, hit := range hits {
+			var doc D
+			if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+				continue
+			}
+			docs = append(docs, doc)
+		}
+		if err := fn(docs); err != nil {
+			return err
+		}
+		read += len(hits)
+		if len(hits) < size || (limit > 0 && read >= limit) {
+			return nil
+		}
+		after = hits[len(hits)-1].Sort
+	}
+}
+
+// ExportOptions 导出选项
+type ExportOptions struct {
+	// Query 为nil时导出全部文档
+	Query *types.Query
+	// Sort 排序字段,格式见SearchAfter
+	Sort []string
+	// Columns 导出的字段,为空时导出除embedding外的全部字段
+	Columns []string
+	// Format 为空时根据文件扩展名判断: csv, jsonl, parquet, xlsx
+	Format    export.Format
+	BatchSize int
+	// Limit 最多导出的文档数,<=0时不限制
+	Limit int
+}
+
+// Export 按query和sort流式导出文档到filename,返回导出的文档数
+func (tec *typedEsClient[D]) Export(ctx context.Context, filename string, opts ExportOptions) (int, error) {
+	total, err := export.Export(filename, export.Options{Format: opts.Format, Columns: opts.Columns},
+		func(fn func(docs []D) error) error {
+			return tec.SearchAfter(ctx, opts.Query, opts.Sort, opts.BatchSize, opts.Limit, fn)
+		})
+	if err != nil {
+		return total, fmt.Errorf("导出索引 %s 失败: %w", tec.index, err)
+	}
+	log.Printf("导出索引 %s 的 %d 个文档到 %s", tec.index, total, filename)
+	return total, nil
+}
@@ -7,17 +7,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"reflect"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/LouYuanbo1/crawleragent/internal/config"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/export"
 	"github.com/elastic/go-elasticsearch/v9"
-	"github.com/elastic/go-elasticsearch/v9/esutil"
 	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
-	"github.com/xuri/excelize/v2"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -26,7 +22,14 @@ type typedEsClient[D model.Document] struct {
 	// 特别说明：这个实例仅用于获取配置信息，不用于存储数据
 	// Instance used for getting schema/configuration, not for data storage
 	schemaDoc D
-	esSem     *semaphore.Weighted
+	// 实际读写的索引名称(或别名),默认为schemaDoc.GetIndex(),
+	// 向量维度不匹配且开启自动创建时会切换为带维度后缀的新索引
+	index string
+	// 向量维度与已有索引不匹配时,是否自动创建新索引而不是返回错误
+	createIndexOnDimsMismatch bool
+	// chineseAnalyzer 创建索引时analyzer=chinese的字段使用的分词器
+	chineseAnalyzer string
+	esSem           *semaphore.Weighted
 }
 
 func InitTypedEsClient[D model.Document](cfg *config.Config, esSemSize int) (TypedEsClient[D], error) {
@@ -50,45 +53,116 @@ func InitTypedEsClient[D model.Document](cfg *config.Config, esSemSize int) (Typ
 	// 初始化信号量
 	esSem := semaphore.NewWeighted(int64(esSemSize))
 
-	return &typedEsClient[D]{client: typedClient, esSem: esSem}, nil
+	var schemaDoc D
+	return &typedEsClient[D]{
+		client:                    typedClient,
+		index:                     schemaDoc.GetIndex(),
+		createIndexOnDimsMismatch: cfg.Elasticsearch.CreateIndexOnDimsMismatch,
+		chineseAnalyzer:           cfg.Elasticsearch.ChineseAnalyzer,
+		esSem:                     esSem,
+	}, nil
 }
 
 func (tec *typedEsClient[D]) GetClient() *elasticsearch.TypedClient {
 	return tec.client
 }
 
-func (tec *typedEsClient[D]) CreateIndexWithMapping(ctx context.Context) error {
-	// 检查索引是否已存在
+// Index 返回实际读写的索引名称
+func (tec *typedEsClient[D]) Index() string {
+	return tec.index
+}
+
+// CreateIndexWithMapping 创建索引并设置映射,dims为嵌入模型的向量维度
+// 新建的索引为 "<索引名>_v1",通过与文档索引名同名的别名读写,之后修改映射时使用Migrate迁移
+// 索引(或别名)已存在时检查其中embedding字段的维度,与dims不一致时返回ErrEmbeddingDimsMismatch,
+// 如果配置了create_index_on_dims_mismatch,则改为创建并切换到 "<索引名>_dims<维度>" 的新索引
+func (tec *typedEsClient[D]) CreateIndexWithMapping(ctx context.Context, dims int) error {
 	index := tec.schemaDoc.GetIndex()
-	mapping := tec.schemaDoc.GetTypeMapping()
-	exists, err := tec.client.Indices.Exists(index).Do(ctx)
+	dimsIndex, existingDims, err := tec.indexForDims(ctx, dims)
+	if err != nil {
+		return err
+	}
+	if existingDims < 0 {
+		return tec.createAliasedIndex(ctx, index, dims)
+	}
+
+	log.Printf("Index %s already exists, skip create", index)
+	if existingDims == 0 || existingDims == dims {
+		tec.index = index
+		tec.warnMappingDiffs(ctx, dims)
+		return nil
+	}
+	if dimsIndex == index {
+		return fmt.Errorf("%w: 索引 %s 的embedding维度为 %d, 当前嵌入模型维度为 %d, "+
+			"请更换嵌入模型、删除旧索引,或开启elasticsearch.create_index_on_dims_mismatch",
+			ErrEmbeddingDimsMismatch, index, existingDims, dims)
+	}
+
+	log.Printf("索引 %s 的embedding维度为 %d, 与嵌入模型维度 %d 不一致, 切换到索引 %s", index, existingDims, dims, dimsIndex)
+	exists, err := tec.client.Indices.Exists(dimsIndex).Do(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check index existence in es: %s", err)
 	}
 	if exists {
-		log.Printf("Index %s already exists, skip create", index)
-		getMappingResponse, err := tec.client.Indices.GetMapping().Index(index).Do(ctx)
+		existingDims, err := tec.embeddingDims(ctx, dimsIndex)
 		if err != nil {
-			log.Printf("Failed to get index mapping: %s", err)
-		} else {
-			// 将mapping转换为JSON格式打印
-			//json.MarshalIndent
-			// 格式化格式：生成人类可读的、带缩进和换行的 JSON
-			// 适合场景：日志记录、调试、配置文件、人类阅读等
-			// 第一个参数 "" (prefix) - 行前缀
-			// 作用：指定每一行 JSON 数据开头的前缀字符串
-			// 第二个参数 " " (indent) - 缩进字符
-			// 作用：指定每一级嵌套使用的缩进字符串
-			jsonData, err := json.MarshalIndent(getMappingResponse, "", "  ")
-			if err != nil {
-				log.Printf("Failed to marshal mapping to JSON: %s", err)
-			} else {
-				log.Printf("Index mapping for %s:\n%s", index, string(jsonData))
-			}
+			return err
+		}
+		if existingDims != 0 && existingDims != dims {
+			return fmt.Errorf("%w: 索引 %s 的embedding维度为 %d, 当前嵌入模型维度为 %d",
+				ErrEmbeddingDimsMismatch, dimsIndex, existingDims, dims)
 		}
+		tec.index = dimsIndex
 		return nil
 	}
+	return tec.createIndex(ctx, dimsIndex, dims)
+}
+
+// indexForDims 返回嵌入模型维度为dims时实际读写的索引名,即EnsureIndex之后store.Name()返回的名称,
+// CreateIndexWithMapping和Migrate都通过它确定索引,保证迁移的正是服务读写的索引
+// 文档索引(或别名)维度一致、没有embedding字段,或未开启create_index_on_dims_mismatch时为文档索引本身,
+// 否则为 "<索引名>_dims<维度>";existingDims为文档索引中embedding字段的维度,文档索引不存在时为-1
+func (tec *typedEsClient[D]) indexForDims(ctx context.Context, dims int) (index string, existingDims int, err error) {
+	index = tec.schemaDoc.GetIndex()
+	exists, err := tec.client.Indices.Exists(index).Do(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to check index existence in es: %s", err)
+	}
+	if !exists {
+		return index, -1, nil
+	}
+	existingDims, err = tec.embeddingDims(ctx, index)
+	if err != nil {
+		return "", 0, err
+	}
+	if existingDims == 0 || existingDims == dims || !tec.createIndexOnDimsMismatch {
+		return index, existingDims, nil
+	}
+	return fmt.Sprintf("%s_dims%d", index, dims), existingDims, nil
+}
 
+// warnMappingDiffs 已有索引的映射与代码中的映射不一致时打印警告,不影响继续使用已有索引
+func (tec *typedEsClient[D]) warnMappingDiffs(ctx context.Context, dims int) {
+	diffs, err := tec.ValidateMapping(ctx, dims)
+	if err != nil {
+		log.Printf("校验索引 %s 的映射失败: %v", tec.index, err)
+		return
+	}
+	if len(diffs) == 0 {
+		return
+	}
+	log.Printf("警告: 索引 %s 的映射与代码中的映射有 %d 处不一致, 可运行 go run ./cmd/migrate -index %s 迁移到新映射:",
+		tec.index, len(diffs), tec.index)
+	for _, diff := range diffs {
+		log.Printf("  %s", diff)
+	}
+}
+
+func (tec *typedEsClient[D]) createIndex(ctx context.Context, index string, dims int) error {
+	mapping, err := tec.typeMapping(dims)
+	if err != nil {
+		return err
+	}
 	if mapping == nil {
 		_, err = tec.client.Indices.Create(index).Do(ctx)
 	} else {
@@ -97,12 +171,47 @@ func (tec *typedEsClient[D]) CreateIndexWithMapping(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to create index in es: %s", err)
 	}
+	tec.index = index
 	return nil
 }
 
+// typeMapping 按配置的中文分词器生成文档的索引映射
+func (tec *typedEsClient[D]) typeMapping(dims int) (*types.TypeMapping, error) {
+	mapping, err := tec.schemaDoc.GetTypeMapping(dims, tec.chineseAnalyzer)
+	if err != nil {
+		return nil, fmt.Errorf("生成索引 %s 的映射失败: %w", tec.schemaDoc.GetIndex(), err)
+	}
+	return mapping, nil
+}
+
+// embeddingDims 读取已有索引中embedding字段的维度,索引没有embedding字段时返回0
+func (tec *typedEsClient[D]) embeddingDims(ctx context.Context, index string) (int, error) {
+	getMappingResponse, err := tec.client.Indices.GetMapping().Index(index).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get index mapping: %s", err)
+	}
+	for _, record := range getMappingResponse {
+		switch property := record.Mappings.Properties["embedding"].(type) {
+		case *types.DenseVectorProperty:
+			if property.Dims != nil {
+				return *property.Dims, nil
+			}
+		case types.DenseVectorProperty:
+			if property.Dims != nil {
+				return *property.Dims, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// DeleteIndex 删除索引,tec.index为别名时删除别名指向的物理索引
 func (tec *typedEsClient[D]) DeleteIndex(ctx context.Context) error {
-	index := tec.schemaDoc.GetIndex()
-	_, err := tec.client.Indices.Delete(index).Do(ctx)
+	index, _, err := tec.resolveAlias(ctx, tec.index)
+	if err != nil {
+		return err
+	}
+	_, err = tec.client.Indices.Delete(index).Do(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to delete index in es: %s", err)
 	}
@@ -110,7 +219,7 @@ func (tec *typedEsClient[D]) DeleteIndex(ctx context.Context) error {
 }
 
 func (tec *typedEsClient[D]) IndexDocWithID(ctx context.Context, doc D) error {
-	_, err := tec.client.Index(tec.schemaDoc.GetIndex()).
+	_, err := tec.client.Index(tec.index).
 		Id(doc.GetID()).
 		Document(doc).
 		Do(ctx)
@@ -120,95 +229,57 @@ func (tec *typedEsClient[D]) IndexDocWithID(ctx context.Context, doc D) error {
 	return nil
 }
 
-func (tec *typedEsClient[D]) BulkIndexDocsWithID(ctx context.Context, docs []D) error {
+// BulkIndexDocsWithID 以文档ID批量写入文档,返回每个文档的写入结果
+// 无法序列化的文档记录为失败,不会提交;请求整体失败时返回error
+func (tec *typedEsClient[D]) BulkIndexDocsWithID(ctx context.Context, docs []D) (*BulkResult, error) {
+	result := &BulkResult{}
+	if len(docs) == 0 {
+		return result, nil
+	}
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 	// 获取信号量（带超时）
 	if err := tec.esSem.Acquire(ctx, 1); err != nil {
-		return fmt.Errorf("等待ES索引信号量超时: %w", err)
+		return result, fmt.Errorf("等待ES索引信号量超时: %w", err)
 	}
 	defer tec.esSem.Release(1) // 保证释放
 
-	if len(docs) == 0 {
-		return nil
-	}
-	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-		Index:         tec.schemaDoc.GetIndex(), // 目标索引名称
-		Client:        tec.client,               // Elasticsearch 客户端
-		NumWorkers:    2,                        // 并发工作协程数
-		FlushBytes:    5 * 1024 * 1024,          // 5MB 时自动刷新
-		FlushInterval: 30 * time.Second,         // 30秒自动刷新
-		// 可选：错误处理回调
-		OnError: func(ctx context.Context, err error) {
-			log.Printf("Bulk indexer error: %s", err)
-		},
-	})
-	if err != nil {
-		log.Printf("Error creating bulk indexer: %s", err)
-	}
-
-	// 4. 添加文档到批量索引器
+	items := make([]bulkItem, 0, len(docs))
 	for _, doc := range docs {
-
 		data, err := json.Marshal(doc)
 		if err != nil {
-			log.Printf("Error marshaling document: %s", err)
-		}
-
-		err = bi.Add(ctx, esutil.BulkIndexerItem{
-			Action:     "index",                         // 操作类型：index, create, update, delete
-			DocumentID: doc.GetID(),                     // 文档ID
-			Body:       strings.NewReader(string(data)), // 文档内容
-			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
-				//fmt.Printf("Successfully indexed document %s\n", item.DocumentID)
-			},
-			OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
-				if err != nil {
-					log.Printf("Error indexing document %s: %s", item.DocumentID, err)
-				} else {
-					log.Printf("Failed to index document %s: %s", item.DocumentID, res.Error.Reason)
-				}
-			},
-		})
-		if err != nil {
-			log.Printf("Unexpected error: %s", err)
+			result.Failed = append(result.Failed, BulkFailure{ID: doc.GetID(), Reason: fmt.Sprintf("序列化文档失败: %s", err)})
+			continue
 		}
+		items = append(items, bulkItem{action: "index", id: doc.GetID(), body: data})
 	}
-
-	// 5. 刷新并关闭批量索引器（确保所有文档都被处理）
-	if err := bi.Close(ctx); err != nil {
-		log.Printf("Error closing bulk indexer: %s", err)
+	if err := tec.runBulk(ctx, tec.index, items, result); err != nil {
+		return result, err
 	}
-
-	// 6. 获取统计信息
-	stats := bi.Stats()
-	fmt.Printf("Bulk indexing completed:\n")
-	fmt.Printf("  Indexed: %d documents\n", stats.NumIndexed)
-	return nil
+	log.Printf("批量索引 %s 完成: 成功 %d, 失败 %d", tec.index, result.NumSucceeded(), result.NumFailed())
+	return result, nil
 }
 
 func (tec *typedEsClient[D]) GetDoc(ctx context.Context, id string) (D, error) {
-	index := tec.schemaDoc.GetIndex()
-	resp, err := tec.client.Get(index, id).Do(ctx)
+	resp, err := tec.client.Get(tec.index, id).Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get doc from es")
 	}
+	// 文档不存在是正常结果(如新会话),返回nil
 	if !resp.Found {
-		log.Println("未找到id对应doc结果.id: ", id)
 		return nil, nil
 	}
 	var doc D
 	if err := json.Unmarshal(resp.Source_, &doc); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal source: %s", err)
 	}
-	fmt.Printf("Parsed Document - ID: %s, Index: %s\n", doc.GetID(), doc.GetIndex())
 	return doc, nil
 }
 
 // 使用 []D 作为返回类型
 func (tec *typedEsClient[D]) SearchDoc(ctx context.Context, query *types.Query, from, size int) ([]D, int64, error) {
 	resp, err := tec.client.Search().
-		Index(tec.schemaDoc.GetIndex()).
+		Index(tec.index).
 		Query(query).
 		From(from).
 		Size(size).
@@ -235,7 +306,7 @@ func (tec *typedEsClient[D]) SearchDoc(ctx context.Context, query *types.Query,
 }
 
 func (tec *typedEsClient[D]) CountDocs(ctx context.Context) (int64, error) {
-	resp, err := tec.client.Count().Index(tec.schemaDoc.GetIndex()).Do(ctx)
+	resp, err := tec.client.Count().Index(tec.index).Do(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count docs in es: %s", err)
 	}
@@ -244,7 +315,7 @@ func (tec *typedEsClient[D]) CountDocs(ctx context.Context) (int64, error) {
 
 // 支持部分更新
 func (tec *typedEsClient[D]) UpdateDoc(ctx context.Context, doc D) error {
-	_, err := tec.client.Update(tec.schemaDoc.GetIndex(), doc.GetID()).
+	_, err := tec.client.Update(tec.index, doc.GetID()).
 		Doc(doc).
 		Do(ctx)
 	if err != nil {
@@ -254,233 +325,42 @@ func (tec *typedEsClient[D]) UpdateDoc(ctx context.Context, doc D) error {
 }
 
 func (tec *typedEsClient[D]) DeleteDoc(ctx context.Context, id string) error {
-	_, err := tec.client.Delete(tec.schemaDoc.GetIndex(), id).Do(ctx)
+	_, err := tec.client.Delete(tec.index, id).Do(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to delete doc from es: %s", err)
 	}
 	return nil
 }
 
-func (tec *typedEsClient[D]) BulkDeleteDocs(ctx context.Context, ids []string) error {
-	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-		Index:         tec.schemaDoc.GetIndex(), // 目标索引名称
-		Client:        tec.client,               // Elasticsearch 客户端
-		NumWorkers:    2,                        // 并发工作协程数
-		FlushBytes:    5 * 1024 * 1024,          // 5MB 时自动刷新
-		FlushInterval: 30 * time.Second,         // 30秒自动刷新
-		// 可选：错误处理回调
-		OnError: func(ctx context.Context, err error) {
-			log.Printf("Bulk indexer error: %s", err)
-		},
-	})
-	if err != nil {
-		log.Fatalf("Error creating bulk indexer: %s", err)
+// BulkDeleteDocs 按ID批量删除文档,返回每个文档的删除结果,不存在的文档记录为失败(not_found)
+func (tec *typedEsClient[D]) BulkDeleteDocs(ctx context.Context, ids []string) (*BulkResult, error) {
+	result := &BulkResult{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	if err := tec.esSem.Acquire(ctx, 1); err != nil {
+		return result, fmt.Errorf("等待ES信号量失败: %w", err)
 	}
+	defer tec.esSem.Release(1)
 
-	// 4. 添加文档到批量索引器
+	items := make([]bulkItem, 0, len(ids))
 	for _, id := range ids {
-
-		err = bi.Add(ctx, esutil.BulkIndexerItem{
-			Action:     "delete", // 操作类型：index, create, update, delete
-			DocumentID: id,       // 文档ID
-			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
-				fmt.Printf("Successfully deleted document %s\n", item.DocumentID)
-			},
-			OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
-				if err != nil {
-					log.Printf("Error deleting document %s: %s", item.DocumentID, err)
-				} else {
-					log.Printf("Failed to delete document %s: %s", item.DocumentID, res.Error.Reason)
-				}
-			},
-		})
-		if err != nil {
-			log.Fatalf("Unexpected error: %s", err)
-		}
+		items = append(items, bulkItem{action: "delete", id: id})
 	}
-
-	// 5. 刷新并关闭批量索引器（确保所有文档都被处理）
-	if err := bi.Close(ctx); err != nil {
-		log.Fatalf("Error closing bulk indexer: %s", err)
+	if err := tec.runBulk(ctx, tec.index, items, result); err != nil {
+		return result, err
 	}
-
-	// 6. 获取统计信息
-	stats := bi.Stats()
-	fmt.Printf("Bulk indexing completed:\n")
-	fmt.Printf("  Deleted: %d documents\n", stats.NumDeleted)
-	return nil
+	log.Printf("批量删除 %s 完成: 成功 %d, 失败 %d", tec.index, result.NumSucceeded(), result.NumFailed())
+	return result, nil
 }
 
+// ToExcel 将索引中的文档导出为xlsx,按sortFields降序排列,最多导出size个(<=0时不限制)
+// 新文件会覆盖已有文件;需要其他格式、查询条件或列选择时使用Export
 func (tec *typedEsClient[D]) ToExcel(ctx context.Context, filename string, sortFields []string, size int) error {
-	var f *excelize.File
-	var err error
-	f, err = excelize.OpenFile(filename)
-	if err != nil {
-		log.Printf("打开excel文件失败,创建新文件: %s", filename)
-		f = excelize.NewFile()
-		f.SetSheetName("Sheet1", "Data")
-	}
-
-	defer func() {
-		if err := f.SaveAs(filename); err != nil {
-			log.Printf("保存Excel文件失败: %v", err)
-		}
-		if err := f.Close(); err != nil {
-			log.Printf("关闭Excel文件失败: %v", err)
-		}
-	}()
-
-	/*
-
-		mapSortFields := make(map[string]types.FieldSort, len(sortFields))
-
-		for _, field := range sortFields {
-			mapSortFields[field] = types.FieldSort{
-				Order: &sortorder.Desc,
-			}
-		}
-		sortOptions := types.SortOptions{
-			SortOptions: mapSortFields,
-		}
-
-	*/
-	resp, err := tec.client.Search().
-		Index(tec.schemaDoc.GetIndex()).
-		Query(&types.Query{
-			MatchAll: &types.MatchAllQuery{},
-		}).
-		//Sort(&sortOptions).
-		Scroll("1m").
-		Size(size).
-		Do(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to scroll docs in es: %s", err)
-	}
-
-	// 获取工作表名
-	sheetName := "Data"
-	// 获取当前最大行数（如果是新文件，从第1行开始）
-	rowNum := 1
-	if rows, err := f.GetRows(sheetName); err == nil && len(rows) > 0 {
-		rowNum = len(rows) + 1
-	}
-
-	// 记录处理的总文档数
-	totalProcessed := 0
-	scrollID := resp.ScrollId_
-
-	// 处理第一批数据
-	for {
-		if len(resp.Hits.Hits) == 0 {
-			break
-		}
-
-		// 处理当前批次的文档
-		for _, hit := range resp.Hits.Hits {
-			// 解析文档数据
-			var doc D
-			if err := json.Unmarshal(hit.Source_, &doc); err != nil {
-				log.Printf("解析文档失败: %v", err)
-				continue
-			}
-
-			// 将文档写入Excel
-			// 这里需要根据D的类型来设置具体的列
-			// 假设D有ToMap()方法或者使用反射
-			if err := tec.writeDocToExcel(f, sheetName, rowNum, doc); err != nil {
-				log.Printf("写入Excel失败: %v", err)
-			}
-
-			rowNum++
-			totalProcessed++
-
-			// 如果指定了最大数量且已达到，则停止
-			if size > 0 && totalProcessed >= size {
-				break
-			}
-		}
-
-		// 检查是否已达到指定数量
-		if size > 0 && totalProcessed >= size {
-			break
-		}
-
-		// 获取下一批数据
-		resp, err := tec.client.Scroll().
-			ScrollId(*scrollID).
-			Do(ctx)
-
-		if err != nil {
-			// 尝试清除scroll
-			tec.client.ClearScroll().ScrollId(*scrollID).Do(ctx)
-			if err.Error() == "EOF" {
-				// 所有数据已读取完毕
-				break
-			}
-			return fmt.Errorf("failed to scroll: %w", err)
-		}
-
-		// 检查是否还有数据
-		if len(resp.Hits.Hits) == 0 {
-			break
-		}
-
-		scrollID = resp.ScrollId_
+	sort := make([]string, len(sortFields))
+	for i, field := range sortFields {
+		sort[i] = "-" + field
 	}
-
-	// 清理scroll
-	if scrollID != nil {
-		tec.client.ClearScroll().ScrollId(*scrollID).Do(ctx)
-	}
-
-	log.Printf("成功处理 %d 个文档到Excel文件: %s", totalProcessed, filename)
-	return nil
-}
-
-// 辅助函数：将文档写入Excel
-func (tec *typedEsClient[D]) writeDocToExcel(f *excelize.File, sheetName string, row int, doc D) error {
-	// 这里需要根据D的具体类型来写入Excel
-	// 你可以使用反射或者为D类型实现一个ToRow()方法
-
-	// 示例：使用反射获取字段值
-	val := reflect.ValueOf(doc)
-	if val.Kind() == reflect.Ptr {
-		val = val.Elem()
-	}
-
-	// 假设是结构体
-	if val.Kind() == reflect.Struct {
-		//typ := val.Type()
-		col := 1
-
-		for i := 0; i < val.NumField(); i++ {
-			field := val.Field(i)
-			//fieldName := typ.Field(i).Name
-
-			// 获取字段值
-			var cellValue string
-			switch field.Kind() {
-			case reflect.String:
-				cellValue = field.String()
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				cellValue = strconv.FormatInt(field.Int(), 10)
-			case reflect.Float32, reflect.Float64:
-				cellValue = strconv.FormatFloat(field.Float(), 'f', -1, 64)
-			case reflect.Bool:
-				cellValue = strconv.FormatBool(field.Bool())
-			default:
-				// 尝试转换为字符串
-				if field.CanInterface() {
-					cellValue = fmt.Sprintf("%v", field.Interface())
-				}
-			}
-
-			// 写入Excel
-			cell, _ := excelize.CoordinatesToCellName(col, row)
-			f.SetCellValue(sheetName, cell, cellValue)
-			col++
-		}
-	}
-
-	return nil
+	_, err := tec.Export(ctx, filename, ExportOptions{Sort: sort, Format: export.FormatXLSX, Limit: size})
+	return err
 }
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/textquerytype"
+)
+
+// esStore 基于TypedEsClient的存储,检索使用ES的kNN搜索
+// 写入经过长期运行的BulkWriter,多个服务的文档合并提交;删除和计数前先Flush,保证看到之前的写入
+type esStore[D model.Document] struct {
+	client es.TypedEsClient[D]
+	writer es.BulkWriter[D]
+}
+
+func InitEsStore[D model.Document](client es.TypedEsClient[D], bulkCfg es.BulkWriterConfig) Store[D] {
+	return &esStore[D]{
+		client: client,
+		writer: es.InitBulkWriter(client, bulkCfg),
+	}
+}
+
+func (s *esStore[D]) EsClient() es.TypedEsClient[D] {
+	return s.client
+}
+
+func (s *esStore[D]) Name() string {
+	return s.client.Index()
+}
+
+func (s *esStore[D]) EnsureIndex(ctx context.Context, dims int) error {
+	return s.client.CreateIndexWithMapping(ctx, dims)
+}
+
+// BulkPut 将文档加入批量写入队列,ES写入变慢导致队列已满时阻塞,直到有空间或ctx取消
+func (s *esStore[D]) BulkPut(ctx context.Context, docs []D) error {
+	return s.writer.Add(ctx, docs)
+}
+
+// Flush 提交队列中的文档,部分文档失败时返回*es.BulkError,可以通过errors.As取出失败的文档
+func (s *esStore[D]) Flush(ctx context.Context) error {
+	return s.writer.Flush(ctx)
+}
+
+// flushBefore 删除、计数前提交队列中的文档,写入失败只记录日志,不影响后续操作
+func (s *esStore[D]) flushBefore(ctx context.Context) {
+	if err := s.writer.Flush(ctx); err != nil {
+		log.Printf("提交 %s 的批量写入失败: %v", s.client.Index(), err)
+	}
+}
+
+func (s *esStore[D]) Get(ctx context.Context, id string) (D, error) {
+	return s.client.GetDoc(ctx, id)
+}
+
+func (s *esStore[D]) MGet(ctx context.Context, ids []string) ([]D, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	resp, err := s.client.GetClient().Search().Index(s.client.Index()).
+		Query(&types.Query{Ids: &types.IdsQuery{Values: ids}}).
+		Size(len(ids)).
+		SourceExcludes_("embedding").
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("批量获取文档失败: %w", err)
+	}
+	docs := make([]D, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		var doc D
+		if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (s *esStore[D]) Count(ctx context.Context) (int64, error) {
+	s.flushBefore(ctx)
+	return s.client.CountDocs(ctx)
+}
+
+// Delete 批量删除文档,不存在的文档不算失败
+func (s *esStore[D]) Delete(ctx context.Context, ids []string) error {
+	s.flushBefore(ctx)
+	result, err := s.client.BulkDeleteDocs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	failed := result.Failed[:0]
+	for _, failure := range result.Failed {
+		if failure.Status != http.StatusNotFound {
+			failed = append(failed, failure)
+		}
+	}
+	result.Failed = failed
+	return result.Err()
+}
+
+func (s *esStore[D]) DeleteByTerm(ctx context.Context, terms ...Term) error {
+	if err := requireTerms(terms); err != nil {
+		return err
+	}
+	s.flushBefore(ctx)
+	query := &types.Query{Bool: &types.BoolQuery{}}
+	for _, term := range terms {
+		query.Bool.Filter = append(query.Bool.Filter, *termsQuery(term))
+	}
+	_, err := s.client.GetClient().DeleteByQuery(s.client.Index()).
+		Query(query).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("按条件删除文档失败: %w", err)
+	}
+	return nil
+}
+
+// TextSearch 使用multi_match(most_fields)在fields中全文检索,字段可以用"字段^权重"指定权重,filters作为过滤条件不参与打分
+func (s *esStore[D]) TextSearch(ctx context.Context, text string, fields []string, k int, filters ...Term) ([]Hit[D], error) {
+	if k <= 0 || len(fields) == 0 {
+		return nil, nil
+	}
+	mostFields := textquerytype.Mostfields
+	query := &types.Query{
+		Bool: &types.BoolQuery{
+			Must: []types.Query{{
+				MultiMatch: &types.MultiMatchQuery{Query: text, Fields: fields, Type: &mostFields},
+			}},
+		},
+	}
+	for _, filter := range filters {
+		query.Bool.Filter = append(query.Bool.Filter, *termsQuery(filter))
+	}
+	resp, err := s.client.GetClient().Search().Index(s.client.Index()).
+		Request(&search.Request{Query: query, Size: &k}).
+		SourceExcludes_("embedding").
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("全文检索失败: %w", err)
+	}
+	return searchHits[D](resp.Hits.Hits), nil
+}
+
+func (s *esStore[D]) KNN(ctx context.Context, vector []float32, k int, filters ...Term) ([]Hit[D], error) {
+	// 候选数量取k的20倍,与之前检索节点中K=5,numCandidates=100的比例一致,ES限制最多10000
+	numCandidates := min(k*20, 10000)
+	knn := types.KnnSearch{
+		Field:         "embedding",
+		QueryVector:   vector,
+		K:             &k,
+		NumCandidates: &numCandidates,
+	}
+	for _, filter := range filters {
+		knn.Filter = append(knn.Filter, *termsQuery(filter))
+	}
+	resp, err := s.client.GetClient().Search().Index(s.client.Index()).
+		Request(&search.Request{Knn: []types.KnnSearch{knn}}).
+		SourceExcludes_("embedding").
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("向量检索失败: %w", err)
+	}
+	return searchHits[D](resp.Hits.Hits), nil
+}
+
+// searchHits 解析检索结果中的文档和得分
+func searchHits[D model.Document](results []types.Hit) []Hit[D] {
+	hits := make([]Hit[D], 0, len(results))
+	for _, hit := range results {
+		var doc D
+		if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+			continue
+		}
+		h := Hit[D]{ID: doc.GetID(), Doc: doc}
+		if hit.Id_ != nil {
+			h.ID = *hit.Id_
+		}
+		if hit.Score_ != nil {
+			h.Score = float64(*hit.Score_)
+		}
+		hits = append(hits, h)
+	}
+	return hits
+}
+
+// Scan 使用point in time和search_after遍历索引,开始前提交并刷新索引,保证之前的写入可见
+func (s *esStore[D]) Scan(ctx context.Context, batchSize int, fn func(docs []D) error) error {
+	s.flushBefore(ctx)
+	if _, err := s.client.GetClient().Indices.Refresh().Index(s.client.Index()).Do(ctx); err != nil {
+		return fmt.Errorf("刷新索引失败: %w", err)
+	}
+	return s.client.ScanDocs(ctx, batchSize, fn)
+}
+
+// Close 提交队列中剩余的文档后停止批量写入器
+func (s *esStore[D]) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	err := s.writer.Close(ctx)
+	stats := s.writer.Stats()
+	log.Printf("关闭 %s 的批量写入器: 共加入 %d 个文档, 写入 %d 个, 失败 %d 个, 提交 %d 次",
+		s.client.Index(), stats.Added, stats.Indexed, stats.Failed, stats.Flushes)
+	return err
+}
+
+func termsQuery(term Term) *types.Query {
+	if term.isRange() {
+		rangeQuery := types.NumberRangeQuery{}
+		if term.Gte != nil {
+			gte := types.Float64(*term.Gte)
+			rangeQuery.Gte = &gte
+		}
+		if term.Lte != nil {
+			lte := types.Float64(*term.Lte)
+			rangeQuery.Lte = &lte
+		}
+		return &types.Query{Range: map[string]types.RangeQuery{term.Field: rangeQuery}}
+	}
+	values := make([]types.FieldValue, 0, len(term.Values))
+	for _, value := range term.Values {
+		values = append(values, value)
+	}
+	return &types.Query{
+		Terms: &types.TermsQuery{
+			TermsQuery: map[string]types.TermsQueryField{
+				term.Field: values,
+			},
+		},
+	}
+}
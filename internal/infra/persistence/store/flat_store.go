@@ -0,0 +1,284 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+const (
+	flatOpPut    byte = 1
+	flatOpDelete byte = 2
+	// 单条记录中字符串和向量的长度上限,超过时认为文件损坏
+	flatMaxFieldLen = 64 * 1024 * 1024
+)
+
+// flatStore 纯Go实现的平面向量索引,不依赖任何外部服务
+// 数据保存在追加写入的二进制文件中,每条记录为:
+// 操作(1字节) + ID长度(uint32) + ID + 文档JSON长度(uint32) + 文档JSON(不含向量) + 维度(uint32) + 向量(float32*维度)
+// 向量以二进制保存,比JSONL更紧凑,加载更快;检索时对全部向量精确计算相似度
+type flatStore[D model.Document] struct {
+	*memoryStore[D]
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// InitFlatStore 打开 "<dir>/<索引名>.flat",文件不存在时创建
+func InitFlatStore[D model.Document](dir string) (Store[D], error) {
+	var schemaDoc D
+	path := filepath.Join(dir, schemaDoc.GetIndex()+".flat")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开存储文件失败: %w", err)
+	}
+	s := &flatStore[D]{memoryStore: newMemoryStore[D](schemaDoc.GetIndex()), path: path, file: file}
+	records, err := s.load()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if records > 2*len(s.docs)+100 {
+		if err := s.compact(); err != nil {
+			s.file.Close()
+			return nil, err
+		}
+	}
+	if _, err := s.file.Seek(0, io.SeekEnd); err != nil {
+		s.file.Close()
+		return nil, fmt.Errorf("打开存储文件失败: %w", err)
+	}
+	s.writer = bufio.NewWriter(s.file)
+	log.Printf("加载向量存储 %s, 共 %d 个文档", path, len(s.docs))
+	return s, nil
+}
+
+// load 重放文件中的记录,文件末尾不完整的记录会被截断
+func (s *flatStore[D]) load() (int, error) {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	records := 0
+	for {
+		op, id, body, vector, size, err := readFlatRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			log.Printf("存储文件 %s 在偏移 %d 处损坏,截断后继续: %v", s.path, offset, err)
+			if err := s.file.Truncate(offset); err != nil {
+				return 0, fmt.Errorf("截断存储文件失败: %w", err)
+			}
+			return records, nil
+		}
+		offset += size
+		records++
+		switch op {
+		case flatOpPut:
+			var doc D
+			if err := json.Unmarshal(body, &doc); err != nil {
+				log.Printf("跳过无法解析的文档 %s: %v", id, err)
+				continue
+			}
+			if len(vector) > 0 {
+				doc.SetEmbedding(vector)
+			}
+			s.putLocked([]D{doc})
+		case flatOpDelete:
+			s.deleteLocked([]string{id})
+		}
+	}
+}
+
+// compact 将当前文档写入临时文件后替换原文件
+func (s *flatStore[D]) compact() error {
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, id := range s.ids {
+		if err := writeFlatPut(writer, s.docs[id]); err != nil {
+			file.Close()
+			return fmt.Errorf("压缩存储文件失败: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	s.file.Close()
+	s.file, err = os.OpenFile(s.path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("打开存储文件失败: %w", err)
+	}
+	return nil
+}
+
+func (s *flatStore[D]) BulkPut(ctx context.Context, docs []D) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		if err := writeFlatPut(s.writer, doc); err != nil {
+			return fmt.Errorf("写入存储文件失败: %w", err)
+		}
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %w", err)
+	}
+	s.putLocked(docs)
+	return nil
+}
+
+func (s *flatStore[D]) Delete(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteAndLogLocked(ids)
+}
+
+func (s *flatStore[D]) DeleteByTerm(ctx context.Context, terms ...Term) error {
+	if err := requireTerms(terms); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteAndLogLocked(s.matchingLocked(terms))
+}
+
+func (s *flatStore[D]) deleteAndLogLocked(ids []string) error {
+	for _, id := range s.deleteLocked(ids) {
+		if err := writeFlatRecord(s.writer, flatOpDelete, id, nil, nil); err != nil {
+			return fmt.Errorf("写入存储文件失败: %w", err)
+		}
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %w", err)
+	}
+	return nil
+}
+
+func (s *flatStore[D]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %w", err)
+	}
+	return s.file.Close()
+}
+
+// writeFlatPut 写入文档,向量单独以二进制保存,JSON中去掉embedding字段
+func writeFlatPut[D model.Document](writer *bufio.Writer, doc D) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "embedding")
+	if data, err = json.Marshal(fields); err != nil {
+		return err
+	}
+	return writeFlatRecord(writer, flatOpPut, doc.GetID(), data, doc.GetEmbedding())
+}
+
+func writeFlatRecord(writer *bufio.Writer, op byte, id string, body []byte, vector []float32) error {
+	if err := writer.WriteByte(op); err != nil {
+		return err
+	}
+	if err := writeFlatBytes(writer, []byte(id)); err != nil {
+		return err
+	}
+	if err := writeFlatBytes(writer, body); err != nil {
+		return err
+	}
+	if err := binary.Write(writer, binary.LittleEndian, uint32(len(vector))); err != nil {
+		return err
+	}
+	return binary.Write(writer, binary.LittleEndian, vector)
+}
+
+func writeFlatBytes(writer *bufio.Writer, data []byte) error {
+	if err := binary.Write(writer, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := writer.Write(data)
+	return err
+}
+
+// readFlatRecord 读取一条记录,返回记录的字节数;恰好在记录边界读到文件末尾时返回io.EOF
+func readFlatRecord(reader *bufio.Reader) (byte, string, []byte, []float32, int64, error) {
+	op, err := reader.ReadByte()
+	if err != nil {
+		return 0, "", nil, nil, 0, err
+	}
+	if op != flatOpPut && op != flatOpDelete {
+		return 0, "", nil, nil, 0, fmt.Errorf("未知的记录类型: %d", op)
+	}
+	id, err := readFlatBytes(reader)
+	if err != nil {
+		return 0, "", nil, nil, 0, unexpectedEOF(err)
+	}
+	body, err := readFlatBytes(reader)
+	if err != nil {
+		return 0, "", nil, nil, 0, unexpectedEOF(err)
+	}
+	var dims uint32
+	if err := binary.Read(reader, binary.LittleEndian, &dims); err != nil {
+		return 0, "", nil, nil, 0, unexpectedEOF(err)
+	}
+	if dims > flatMaxFieldLen/4 {
+		return 0, "", nil, nil, 0, fmt.Errorf("非法的向量维度: %d", dims)
+	}
+	var vector []float32
+	if dims > 0 {
+		vector = make([]float32, dims)
+		if err := binary.Read(reader, binary.LittleEndian, vector); err != nil {
+			return 0, "", nil, nil, 0, unexpectedEOF(err)
+		}
+	}
+	size := 1 + 4 + int64(len(id)) + 4 + int64(len(body)) + 4 + int64(dims)*4
+	return op, string(id), body, vector, size, nil
+}
+
+func readFlatBytes(reader *bufio.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > flatMaxFieldLen {
+		return nil, fmt.Errorf("非法的字段长度: %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unexpectedEOF 记录中途读到文件末尾说明记录不完整,不能当作正常结束
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+// 混合检索的融合方式
+const (
+	// FusionRRF 倒数排名融合: 得分为各路结果中 权重/(RankConstant+名次) 之和,不依赖各路得分的量纲
+	FusionRRF = "rrf"
+	// FusionWeighted 加权融合: 各路得分按最大最小值归一化到[0,1]后按权重相加
+	FusionWeighted = "weighted"
+)
+
+// HybridQuery 全文检索 + 向量检索的混合检索参数
+type HybridQuery struct {
+	Text string
+	// Fields 全文检索的字段,可写为"字段^权重";为空时只做向量检索
+	Fields []string
+	// Vector 查询向量;为空时只做全文检索
+	Vector []float32
+	// K 融合后返回的文档数
+	K int
+	// Candidates 每一路检索返回的候选数,融合前的窗口大小,小于K时取K
+	Candidates int
+	// Fusion 融合方式,FusionRRF(默认)或FusionWeighted
+	Fusion string
+	// RankConstant RRF的常数,默认60
+	RankConstant int
+	// TextWeight、VectorWeight 两路结果的权重,都为0时各为1
+	TextWeight   float64
+	VectorWeight float64
+	Filters      []Term
+}
+
+// HybridSearch 分别做全文检索和向量检索,按Fusion融合两路结果后返回前K个文档,
+// 融合在客户端完成,各存储后端行为一致,也不依赖ES的RRF许可
+func HybridSearch[D model.Document](ctx context.Context, s Store[D], q HybridQuery) ([]Hit[D], error) {
+	if q.K <= 0 {
+		return nil, nil
+	}
+	candidates := max(q.Candidates, q.K)
+	textWeight, vectorWeight := q.TextWeight, q.VectorWeight
+	if textWeight == 0 && vectorWeight == 0 {
+		textWeight, vectorWeight = 1, 1
+	}
+
+	var lists [][]Hit[D]
+	var weights []float64
+	if len(q.Fields) > 0 && q.Text != "" && textWeight > 0 {
+		hits, err := s.TextSearch(ctx, q.Text, q.Fields, candidates, q.Filters...)
+		if err != nil {
+			return nil, err
+		}
+		lists, weights = append(lists, hits), append(weights, textWeight)
+	}
+	if len(q.Vector) > 0 && vectorWeight > 0 {
+		hits, err := s.KNN(ctx, q.Vector, candidates, q.Filters...)
+		if err != nil {
+			return nil, err
+		}
+		lists, weights = append(lists, hits), append(weights, vectorWeight)
+	}
+
+	var fused []Hit[D]
+	switch q.Fusion {
+	case "", FusionRRF:
+		rankConstant := q.RankConstant
+		if rankConstant <= 0 {
+			rankConstant = 60
+		}
+		fused = fuseRRF(lists, weights, rankConstant)
+	case FusionWeighted:
+		fused = fuseWeighted(lists, weights)
+	default:
+		return nil, fmt.Errorf("未知的融合方式: %q", q.Fusion)
+	}
+	if len(fused) > q.K {
+		fused = fused[:q.K]
+	}
+	return fused, nil
+}
+
+// fuseRRF 倒数排名融合,名次从1开始
+func fuseRRF[D model.Document](lists [][]Hit[D], weights []float64, rankConstant int) []Hit[D] {
+	scores := make([][]float64, len(lists))
+	for i, list := range lists {
+		scores[i] = make([]float64, len(list))
+		for rank := range list {
+			scores[i][rank] = weights[i] / float64(rankConstant+rank+1)
+		}
+	}
+	return fuse(lists, scores)
+}
+
+// fuseWeighted 每一路得分按最大最小值归一化后加权相加,一路中所有得分相同时归一化得分为1
+func fuseWeighted[D model.Document](lists [][]Hit[D], weights []float64) []Hit[D] {
+	scores := make([][]float64, len(lists))
+	for i, list := range lists {
+		scores[i] = make([]float64, len(list))
+		if len(list) == 0 {
+			continue
+		}
+		lo, hi := list[0].Score, list[0].Score
+		for _, hit := range list {
+			lo, hi = min(lo, hit.Score), max(hi, hit.Score)
+		}
+		for rank, hit := range list {
+			normalized := 1.0
+			if hi > lo {
+				normalized = (hit.Score - lo) / (hi - lo)
+			}
+			scores[i][rank] = weights[i] * normalized
+		}
+	}
+	return fuse(lists, scores)
+}
+
+// fuse 按文档ID累加各路得分,结果按融合得分降序,同分时先出现的在前
+func fuse[D model.Document](lists [][]Hit[D], scores [][]float64) []Hit[D] {
+	fused := make([]Hit[D], 0)
+	index := make(map[string]int)
+	for i, list := range lists {
+		for rank, hit := range list {
+			if pos, ok := index[hit.ID]; ok {
+				fused[pos].Score += scores[i][rank]
+				continue
+			}
+			index[hit.ID] = len(fused)
+			fused = append(fused, Hit[D]{ID: hit.ID, Score: scores[i][rank], Doc: hit.Doc})
+		}
+	}
+	sort.SliceStable(fused, func(a, b int) bool { return fused[a].Score > fused[b].Score })
+	return fused
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+func hits(ids ...string) []Hit[*model.BossJobDoc] {
+	list := make([]Hit[*model.BossJobDoc], 0, len(ids))
+	for _, id := range ids {
+		list = append(list, Hit[*model.BossJobDoc]{ID: id, Doc: &model.BossJobDoc{EncryptJobId: id}})
+	}
+	return list
+}
+
+func scored(pairs ...any) []Hit[*model.BossJobDoc] {
+	list := make([]Hit[*model.BossJobDoc], 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		id := pairs[i].(string)
+		list = append(list, Hit[*model.BossJobDoc]{ID: id, Score: pairs[i+1].(float64), Doc: &model.BossJobDoc{EncryptJobId: id}})
+	}
+	return list
+}
+
+type fusedHit struct {
+	id    string
+	score float64
+}
+
+func checkFused(t *testing.T, got []Hit[*model.BossJobDoc], want []fusedHit) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d hits, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].ID != want[i].id || math.Abs(got[i].Score-want[i].score) > 1e-9 {
+			t.Errorf("hit %d = (%s, %v), want (%s, %v)", i, got[i].ID, got[i].Score, want[i].id, want[i].score)
+		}
+		if got[i].Doc == nil || got[i].Doc.GetID() != got[i].ID {
+			t.Errorf("hit %d lost its document", i)
+		}
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	tests := []struct {
+		name         string
+		lists        [][]Hit[*model.BossJobDoc]
+		weights      []float64
+		rankConstant int
+		want         []fusedHit
+	}{
+		{
+			name:         "两路都命中的文档排在前面",
+			lists:        [][]Hit[*model.BossJobDoc]{hits("a", "b"), hits("b", "c")},
+			weights:      []float64{1, 1},
+			rankConstant: 60,
+			want: []fusedHit{
+				{"b", 1.0/62 + 1.0/61},
+				{"a", 1.0 / 61},
+				{"c", 1.0 / 62},
+			},
+		},
+		{
+			name:         "同分时先出现的在前",
+			lists:        [][]Hit[*model.BossJobDoc]{hits("a", "b"), hits("c", "d")},
+			weights:      []float64{1, 1},
+			rankConstant: 60,
+			want: []fusedHit{
+				{"a", 1.0 / 61},
+				{"c", 1.0 / 61},
+				{"b", 1.0 / 62},
+				{"d", 1.0 / 62},
+			},
+		},
+		{
+			name:         "名次相反时同分,保持全文检索的顺序",
+			lists:        [][]Hit[*model.BossJobDoc]{hits("a", "b"), hits("b", "a")},
+			weights:      []float64{1, 1},
+			rankConstant: 60,
+			want: []fusedHit{
+				{"a", 1.0/61 + 1.0/62},
+				{"b", 1.0/62 + 1.0/61},
+			},
+		},
+		{
+			name:         "权重",
+			lists:        [][]Hit[*model.BossJobDoc]{hits("a"), hits("b")},
+			weights:      []float64{1, 2},
+			rankConstant: 1,
+			want: []fusedHit{
+				{"b", 2.0 / 2},
+				{"a", 1.0 / 2},
+			},
+		},
+		{
+			name:         "只有一路",
+			lists:        [][]Hit[*model.BossJobDoc]{hits("a", "b")},
+			weights:      []float64{1},
+			rankConstant: 60,
+			want:         []fusedHit{{"a", 1.0 / 61}, {"b", 1.0 / 62}},
+		},
+		{
+			name:         "没有结果",
+			lists:        [][]Hit[*model.BossJobDoc]{hits(), hits()},
+			weights:      []float64{1, 1},
+			rankConstant: 60,
+			want:         []fusedHit{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFused(t, fuseRRF(tt.lists, tt.weights, tt.rankConstant), tt.want)
+		})
+	}
+}
+
+func TestFuseWeighted(t *testing.T) {
+	tests := []struct {
+		name    string
+		lists   [][]Hit[*model.BossJobDoc]
+		weights []float64
+		want    []fusedHit
+	}{
+		{
+			name:    "按最大最小值归一化后相加",
+			lists:   [][]Hit[*model.BossJobDoc]{scored("a", 10.0, "b", 6.0, "c", 2.0), scored("c", 0.9, "a", 0.5)},
+			weights: []float64{1, 1},
+			want: []fusedHit{
+				{"a", 1},
+				{"c", 1},
+				{"b", 0.5},
+			},
+		},
+		{
+			name:    "一路中得分都相同时归一化为1",
+			lists:   [][]Hit[*model.BossJobDoc]{scored("a", 3.0, "b", 3.0), scored("b", 0.8, "c", 0.2)},
+			weights: []float64{1, 1},
+			want: []fusedHit{
+				{"b", 2},
+				{"a", 1},
+				{"c", 0},
+			},
+		},
+		{
+			name:    "权重",
+			lists:   [][]Hit[*model.BossJobDoc]{scored("a", 5.0, "b", 1.0), scored("b", 0.9, "a", 0.1)},
+			weights: []float64{1, 3},
+			want: []fusedHit{
+				{"b", 3},
+				{"a", 1},
+			},
+		},
+		{
+			name:    "空的一路不影响另一路",
+			lists:   [][]Hit[*model.BossJobDoc]{scored(), scored("a", 0.7, "b", 0.3)},
+			weights: []float64{1, 1},
+			want:    []fusedHit{{"a", 1}, {"b", 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFused(t, fuseWeighted(tt.lists, tt.weights), tt.want)
+		})
+	}
+}
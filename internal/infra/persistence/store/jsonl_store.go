@@ -0,0 +1,201 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+type jsonlRecord[D model.Document] struct {
+	Op  string `json:"op"`
+	ID  string `json:"id,omitempty"`
+	Doc D      `json:"doc,omitempty"`
+}
+
+const (
+	jsonlOpPut    = "put"
+	jsonlOpDelete = "delete"
+)
+
+// jsonlStore JSONL文件存储,每次写入和删除都追加一行记录,启动时按顺序重放到内存中
+// 文件可以直接用文本工具查看,适合在本地调试和保存爬取结果
+type jsonlStore[D model.Document] struct {
+	*memoryStore[D]
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// InitJSONLStore 打开 "<dir>/<索引名>.jsonl",文件不存在时创建
+func InitJSONLStore[D model.Document](dir string) (Store[D], error) {
+	var schemaDoc D
+	path := filepath.Join(dir, schemaDoc.GetIndex()+".jsonl")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	s := &jsonlStore[D]{memoryStore: newMemoryStore[D](schemaDoc.GetIndex()), path: path}
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.truncatePartialLine(); err != nil {
+		return nil, err
+	}
+	// 记录数远多于现有文档时(大量覆盖写入和删除),重写文件只保留最新的文档
+	if records > 2*len(s.docs)+100 {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开存储文件失败: %w", err)
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	log.Printf("加载JSONL存储 %s, 共 %d 个文档", path, len(s.docs))
+	return s, nil
+}
+
+func (s *jsonlStore[D]) load() (int, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("打开存储文件失败: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	// 单个文档可能较大(网页正文+向量),放宽单行长度限制
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	records := 0
+	for scanner.Scan() {
+		records++
+		var record jsonlRecord[D]
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 进程中途退出时最后一行可能不完整,跳过即可
+			log.Printf("跳过损坏的记录 %s:%d: %v", s.path, records, err)
+			continue
+		}
+		switch record.Op {
+		case jsonlOpPut:
+			s.putLocked([]D{record.Doc})
+		case jsonlOpDelete:
+			s.deleteLocked([]string{record.ID})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("读取存储文件失败: %w", err)
+	}
+	return records, nil
+}
+
+// truncatePartialLine 进程中途退出时最后一行可能没有换行符,截断到最后一个完整行,
+// 否则之后追加的记录会和这一行拼在一起,导致两条记录都无法解析
+func (s *jsonlStore[D]) truncatePartialLine() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) || len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取存储文件失败: %w", err)
+	}
+	if err := os.Truncate(s.path, int64(bytes.LastIndexByte(data, '\n')+1)); err != nil {
+		return fmt.Errorf("截断存储文件失败: %w", err)
+	}
+	return nil
+}
+
+// compact 将当前文档写入临时文件后替换原文件
+func (s *jsonlStore[D]) compact() error {
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, id := range s.ids {
+		if err := writeJSONLine(writer, jsonlRecord[D]{Op: jsonlOpPut, Doc: s.docs[id]}); err != nil {
+			file.Close()
+			return fmt.Errorf("压缩存储文件失败: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *jsonlStore[D]) BulkPut(ctx context.Context, docs []D) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		if err := writeJSONLine(s.writer, jsonlRecord[D]{Op: jsonlOpPut, Doc: doc}); err != nil {
+			return fmt.Errorf("写入存储文件失败: %w", err)
+		}
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %w", err)
+	}
+	s.putLocked(docs)
+	return nil
+}
+
+func (s *jsonlStore[D]) Delete(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteAndLogLocked(ids)
+}
+
+func (s *jsonlStore[D]) DeleteByTerm(ctx context.Context, terms ...Term) error {
+	if err := requireTerms(terms); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteAndLogLocked(s.matchingLocked(terms))
+}
+
+func (s *jsonlStore[D]) deleteAndLogLocked(ids []string) error {
+	for _, id := range s.deleteLocked(ids) {
+		if err := writeJSONLine(s.writer, jsonlRecord[D]{Op: jsonlOpDelete, ID: id}); err != nil {
+			return fmt.Errorf("写入存储文件失败: %w", err)
+		}
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %w", err)
+	}
+	return nil
+}
+
+func (s *jsonlStore[D]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %w", err)
+	}
+	return s.file.Close()
+}
+
+func writeJSONLine(writer *bufio.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	return writer.WriteByte('\n')
+}
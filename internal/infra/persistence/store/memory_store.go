@@ -0,0 +1,277 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+)
+
+// memoryStore 内存存储,向量检索为暴力计算余弦相似度,适合测试和小规模数据
+// 保存和返回的都是调用方传入的文档指针,调用方不应修改已写入的文档
+// jsonl和flat存储在它的基础上增加持久化
+type memoryStore[D model.Document] struct {
+	name string
+	mu   sync.RWMutex
+	docs map[string]D
+	// 按写入顺序保存ID,保证遍历顺序稳定
+	ids  []string
+	dims int
+}
+
+func InitMemoryStore[D model.Document](name string) Store[D] {
+	return newMemoryStore[D](name)
+}
+
+func newMemoryStore[D model.Document](name string) *memoryStore[D] {
+	return &memoryStore[D]{name: name, docs: make(map[string]D)}
+}
+
+func (s *memoryStore[D]) Name() string {
+	return s.name
+}
+
+// EnsureIndex 记录向量维度,已有文档的向量维度不一致时返回ErrEmbeddingDimsMismatch
+func (s *memoryStore[D]) EnsureIndex(ctx context.Context, dims int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.ids {
+		if existing := len(s.docs[id].GetEmbedding()); existing != 0 && existing != dims {
+			return fmt.Errorf("%w: %s 中已有向量维度为 %d, 当前嵌入模型维度为 %d, 请更换嵌入模型或删除旧数据",
+				es.ErrEmbeddingDimsMismatch, s.name, existing, dims)
+		}
+	}
+	s.dims = dims
+	return nil
+}
+
+func (s *memoryStore[D]) BulkPut(ctx context.Context, docs []D) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putLocked(docs)
+	return nil
+}
+
+func (s *memoryStore[D]) putLocked(docs []D) {
+	for _, doc := range docs {
+		id := doc.GetID()
+		if _, ok := s.docs[id]; !ok {
+			s.ids = append(s.ids, id)
+		}
+		s.docs[id] = doc
+	}
+}
+
+func (s *memoryStore[D]) Get(ctx context.Context, id string) (D, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.docs[id], nil
+}
+
+func (s *memoryStore[D]) MGet(ctx context.Context, ids []string) ([]D, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]D, 0, len(ids))
+	for _, id := range ids {
+		if doc, ok := s.docs[id]; ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (s *memoryStore[D]) Count(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.docs)), nil
+}
+
+func (s *memoryStore[D]) Delete(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLocked(ids)
+	return nil
+}
+
+// deleteLocked 删除文档,返回实际删除的ID
+func (s *memoryStore[D]) deleteLocked(ids []string) []string {
+	deleted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := s.docs[id]; ok {
+			delete(s.docs, id)
+			deleted = append(deleted, id)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	kept := s.ids[:0]
+	for _, id := range s.ids {
+		if _, ok := s.docs[id]; ok {
+			kept = append(kept, id)
+		}
+	}
+	s.ids = kept
+	return deleted
+}
+
+func (s *memoryStore[D]) DeleteByTerm(ctx context.Context, terms ...Term) error {
+	if err := requireTerms(terms); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLocked(s.matchingLocked(terms))
+	return nil
+}
+
+func (s *memoryStore[D]) matchingLocked(terms []Term) []string {
+	ids := make([]string, 0)
+	for _, id := range s.ids {
+		if matchTerms(s.docs[id], terms) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *memoryStore[D]) KNN(ctx context.Context, vector []float32, k int, filters ...Term) ([]Hit[D], error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	queryNorm := norm(vector)
+	if queryNorm == 0 {
+		return nil, fmt.Errorf("查询向量为零向量")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hits := make([]Hit[D], 0, len(s.docs))
+	for _, id := range s.ids {
+		doc := s.docs[id]
+		embedding := doc.GetEmbedding()
+		if len(embedding) != len(vector) {
+			continue
+		}
+		docNorm := norm(embedding)
+		if docNorm == 0 {
+			continue
+		}
+		cos := dot(vector, embedding) / (queryNorm * docNorm)
+		hits = append(hits, Hit[D]{ID: id, Score: (1 + cos) / 2, Doc: doc})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	// 先按得分排序再过滤,只需要对排在前面的候选文档解析字段
+	results := make([]Hit[D], 0, k)
+	for _, hit := range hits {
+		if len(filters) > 0 && !matchTerms(hit.Doc, filters) {
+			continue
+		}
+		results = append(results, hit)
+		if len(results) == k {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryStore[D]) Scan(ctx context.Context, batchSize int, fn func(docs []D) error) error {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	// 先复制快照再释放锁,fn中写入同一个存储时不会死锁
+	s.mu.RLock()
+	snapshot := make([]D, 0, len(s.ids))
+	for _, id := range s.ids {
+		snapshot = append(snapshot, s.docs[id])
+	}
+	s.mu.RUnlock()
+	for start := 0; start < len(snapshot); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(snapshot[start:min(start+batchSize, len(snapshot))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore[D]) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore[D]) Close() error {
+	return nil
+}
+
+// matchTerms 判断文档是否满足所有条件,字段按JSON字段名取值,
+// "字段.keyword"这样的子字段与原字段取值相同
+func matchTerms[D model.Document](doc D, terms []Term) bool {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return false
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	for _, term := range terms {
+		value, ok := fields[strings.TrimSuffix(term.Field, ".keyword")]
+		if !ok || value == nil {
+			return false
+		}
+		if term.isRange() {
+			if !matchRange(value, term) {
+				return false
+			}
+			continue
+		}
+		values := []any{value}
+		if items, ok := value.([]any); ok {
+			values = items
+		}
+		if !slices.ContainsFunc(values, func(item any) bool {
+			return slices.Contains(term.Values, fmt.Sprint(item))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRange 数值字段是否在范围内,数组字段有任意一个元素在范围内即可
+func matchRange(value any, term Term) bool {
+	values := []any{value}
+	if items, ok := value.([]any); ok {
+		values = items
+	}
+	for _, item := range values {
+		number, ok := item.(float64)
+		if !ok {
+			continue
+		}
+		if (term.Gte == nil || number >= *term.Gte) && (term.Lte == nil || number <= *term.Lte) {
+			return true
+		}
+	}
+	return false
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func norm(v []float32) float64 {
+	return math.Sqrt(dot(v, v))
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+)
+
+// 存储后端,通过配置storage.backend选择,为空时默认使用elasticsearch
+const (
+	BackendElasticsearch = "elasticsearch"
+	BackendFlat          = "flat"
+	BackendJSONL         = "jsonl"
+	BackendMemory        = "memory"
+)
+
+// Term 过滤条件,字段值等于Values中任意一个即匹配,数组字段有任意一个元素匹配即可;
+// Values为空、Gte或Lte不为nil时为数值范围条件,字段缺失的文档不匹配
+type Term struct {
+	Field  string
+	Values []string
+	Gte    *float64
+	Lte    *float64
+}
+
+// RangeTerm 数值范围条件,gte、lte为nil表示该侧不限
+func RangeTerm(field string, gte, lte *float64) Term {
+	return Term{Field: field, Gte: gte, Lte: lte}
+}
+
+// requireTerms 按条件删除时至少需要一个条件,避免误删全部文档
+func requireTerms(terms []Term) error {
+	if len(terms) == 0 {
+		return fmt.Errorf("按条件删除文档时至少需要一个条件")
+	}
+	return nil
+}
+
+func (t Term) isRange() bool {
+	return len(t.Values) == 0 && (t.Gte != nil || t.Lte != nil)
+}
+
+// Hit 向量检索命中的文档,Score与ES的cosine相似度得分一致,为(1+cos)/2
+type Hit[D model.Document] struct {
+	ID    string
+	Score float64
+	Doc   D
+}
+
+// Store 文档存储接口,爬虫服务、分块索引和智能体检索只依赖这个接口,
+// 可以在Elasticsearch和本地存储之间切换,本地运行时不需要ES集群
+type Store[D model.Document] interface {
+	// Name 返回实际读写的索引名称
+	Name() string
+	// EnsureIndex 创建索引(或本地存储文件),并校验已有数据的向量维度与dims一致
+	EnsureIndex(ctx context.Context, dims int) error
+	// BulkPut 写入文档,Elasticsearch后端只加入后台写入队列,写入失败在Flush或Close时返回
+	BulkPut(ctx context.Context, docs []D) error
+	// Flush 等待已经写入的文档全部落盘或提交到ES,本地存储每次写入都会落盘,直接返回
+	Flush(ctx context.Context) error
+	// Get 按ID获取文档,不存在时返回nil
+	Get(ctx context.Context, id string) (D, error)
+	// MGet 按ID批量获取文档,不存在的ID会被跳过
+	MGet(ctx context.Context, ids []string) ([]D, error)
+	Count(ctx context.Context) (int64, error)
+	Delete(ctx context.Context, ids []string) error
+	// DeleteByTerm 删除满足全部条件的文档,terms之间为且的关系
+	DeleteByTerm(ctx context.Context, terms ...Term) error
+	// KNN 返回与vector最相似的k个文档,filters之间为且的关系
+	KNN(ctx context.Context, vector []float32, k int, filters ...Term) ([]Hit[D], error)
+	// TextSearch 在fields(可写为"字段^权重")中全文检索text,返回得分最高的k个文档,Score为BM25得分
+	TextSearch(ctx context.Context, text string, fields []string, k int, filters ...Term) ([]Hit[D], error)
+	// Scan 按批遍历全部文档(包含向量),遍历开始前的写入都可见,fn返回错误时停止遍历
+	// fn中可以写入同一个存储,遍历的是开始时的快照
+	Scan(ctx context.Context, batchSize int, fn func(docs []D) error) error
+	Close() error
+}
+
+// InitStore 根据配置中的storage.backend初始化文档存储,esSemSize限制同时写入ES的请求数量
+// Elasticsearch后端的写入经过elasticsearch.bulk配置的批量写入器;本地存储的文件保存在storage.dir目录下,以文档的索引名命名
+func InitStore[D model.Document](cfg *config.Config, esSemSize int) (Store[D], error) {
+	var schemaDoc D
+	switch cfg.Storage.Backend {
+	case "", BackendElasticsearch:
+		client, err := es.InitTypedEsClient[D](cfg, esSemSize)
+		if err != nil {
+			return nil, err
+		}
+		bulk := cfg.Elasticsearch.Bulk
+		return InitEsStore(client, es.BulkWriterConfig{
+			FlushCount:    bulk.FlushCount,
+			FlushBytes:    bulk.FlushBytes,
+			FlushInterval: time.Duration(bulk.FlushIntervalMs) * time.Millisecond,
+			QueueSize:     bulk.QueueSize,
+		}), nil
+	case BackendMemory:
+		return InitMemoryStore[D](schemaDoc.GetIndex()), nil
+	case BackendJSONL:
+		return InitJSONLStore[D](cfg.Storage.Dir)
+	case BackendFlat:
+		return InitFlatStore[D](cfg.Storage.Dir)
+	default:
+		return nil, fmt.Errorf("未知的存储后端: %s", cfg.Storage.Backend)
+	}
+}
+
+type esBacked[D model.Document] interface {
+	EsClient() es.TypedEsClient[D]
+}
+
+// AsEs 如果存储后端是Elasticsearch,返回底层的TypedEsClient,用于导出Excel等ES特有的功能
+func AsEs[D model.Document](s Store[D]) (es.TypedEsClient[D], bool) {
+	backed, ok := s.(esBacked[D])
+	if !ok {
+		return nil, false
+	}
+	return backed.EsClient(), true
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// BM25参数,与ES的默认值一致
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// textField 全文检索的字段,Boost由"字段^权重"的写法指定
+type textField struct {
+	Name  string
+	Boost float64
+}
+
+func parseTextFields(fields []string) ([]textField, error) {
+	parsed := make([]textField, 0, len(fields))
+	for _, field := range fields {
+		name, boostText, ok := strings.Cut(strings.TrimSpace(field), "^")
+		boost := 1.0
+		if ok {
+			var err error
+			if boost, err = strconv.ParseFloat(boostText, 64); err != nil || boost <= 0 {
+				return nil, fmt.Errorf("无效的字段权重: %q", field)
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("全文检索字段为空")
+		}
+		parsed = append(parsed, textField{Name: name, Boost: boost})
+	}
+	return parsed, nil
+}
+
+// TextSearch 在内存中按BM25为各字段打分,文档得分为各字段得分乘以权重之和,与ES的multi_match(most_fields)接近
+// 中文按相邻两字切分(单字的词保留单字),英文和数字按单词切分并转为小写
+func (s *memoryStore[D]) TextSearch(ctx context.Context, text string, fields []string, k int, filters ...Term) ([]Hit[D], error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	parsedFields, err := parseTextFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	queryTerms := tokenize(text)
+	if len(queryTerms) == 0 || len(parsedFields) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	type candidate struct {
+		id     string
+		doc    D
+		tokens [][]string
+	}
+	candidates := make([]candidate, 0, len(s.ids))
+	for _, id := range s.ids {
+		doc := s.docs[id]
+		if len(filters) > 0 && !matchTerms(doc, filters) {
+			continue
+		}
+		values := fieldTexts(doc, parsedFields)
+		tokens := make([][]string, len(parsedFields))
+		for i, value := range values {
+			tokens[i] = tokenize(value)
+		}
+		candidates = append(candidates, candidate{id: id, doc: doc, tokens: tokens})
+	}
+	s.mu.RUnlock()
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// 每个字段单独统计平均长度和文档频率
+	hits := make([]Hit[D], 0, len(candidates))
+	scores := make([]float64, len(candidates))
+	for f, field := range parsedFields {
+		var totalLen float64
+		docFreq := make(map[string]int)
+		for _, c := range candidates {
+			totalLen += float64(len(c.tokens[f]))
+			seen := make(map[string]bool)
+			for _, token := range c.tokens[f] {
+				if !seen[token] {
+					seen[token] = true
+					docFreq[token]++
+				}
+			}
+		}
+		avgLen := totalLen / float64(len(candidates))
+		if avgLen == 0 {
+			continue
+		}
+		n := float64(len(candidates))
+		for i, c := range candidates {
+			termFreq := make(map[string]int)
+			for _, token := range c.tokens[f] {
+				termFreq[token]++
+			}
+			docLen := float64(len(c.tokens[f]))
+			for _, term := range queryTerms {
+				tf := float64(termFreq[term])
+				if tf == 0 {
+					continue
+				}
+				df := float64(docFreq[term])
+				idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+				scores[i] += field.Boost * idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+			}
+		}
+	}
+	for i, c := range candidates {
+		if scores[i] > 0 {
+			hits = append(hits, Hit[D]{ID: c.id, Score: scores[i], Doc: c.doc})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// fieldTexts 按JSON字段名取出文档中各字段的文本,数组字段用空格连接
+func fieldTexts(doc any, fields []textField) []string {
+	texts := make([]string, len(fields))
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return texts
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return texts
+	}
+	for i, field := range fields {
+		switch value := values[field.Name].(type) {
+		case string:
+			texts[i] = value
+		case []any:
+			parts := make([]string, 0, len(value))
+			for _, item := range value {
+				parts = append(parts, fmt.Sprint(item))
+			}
+			texts[i] = strings.Join(parts, " ")
+		case nil:
+		default:
+			texts[i] = fmt.Sprint(value)
+		}
+	}
+	return texts
+}
+
+// tokenize 简单的分词: 连续的字母数字为一个词(小写),连续的中日韩字符按相邻两字切分
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
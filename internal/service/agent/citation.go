@@ -0,0 +1,249 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+// 引用校验方式,见param.Citation
+const (
+	citationFlag  = "flag"
+	citationStrip = "strip"
+	citationOff   = "off"
+)
+
+var (
+	// citationPattern 匹配"[文档1]"、"【文档2】"、"[文档1,3]"、"[文档1、文档3]"形式的引用
+	citationPattern = regexp.MustCompile(`[\[【]文档\s*\d+(?:\s*[,，、]\s*(?:文档)?\s*\d+)*\s*[\]】]`)
+	numberPattern   = regexp.MustCompile(`\d+`)
+	urlPattern      = regexp.MustCompile(`https?://[^\s<>"'()（）\[\]【】，。；！、]+`)
+)
+
+// 网址末尾可能带上的标点和Markdown标记
+const urlTrailing = ".,;:!?*_"
+
+// citationLabel 参考文档中文档的编号,模型按该编号引用
+func citationLabel(n int) string {
+	return fmt.Sprintf("[文档%d]", n)
+}
+
+// urlKey 比较网址时只使用域名(去掉www.)和路径,模型经常省略或改写查询参数
+func urlKey(raw string) string {
+	raw = strings.TrimRight(raw, urlTrailing)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	return urlHost(u) + strings.TrimSuffix(u.Path, "/")
+}
+
+// urlHost 小写并去掉www.的域名
+func urlHost(u *url.URL) string {
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// isSiteRoot 网站首页(如推荐的招聘平台)不是具体的岗位或文章,不校验
+func isSiteRoot(raw string) bool {
+	u, err := url.Parse(strings.TrimRight(raw, urlTrailing))
+	return err == nil && strings.Trim(u.Path, "/") == ""
+}
+
+// entryLine 回答中的一行,indent为行首空白的宽度,marker为列表或标题标记(见lineMarker)
+type entryLine struct {
+	indent int
+	marker string
+}
+
+var numberedMarker = regexp.MustCompile(`^\d+[.、)）]`)
+
+func parseEntryLine(line string) entryLine {
+	trimmed := strings.TrimLeft(line, " \t")
+	return entryLine{indent: len(line) - len(trimmed), marker: lineMarker(trimmed)}
+}
+
+// lineMarker 返回行首的列表或标题标记: "#"(Markdown标题)、"**"(加粗的标题)、"1."(编号)、
+// "-"/"*"/"+"(Markdown列表),或行首的其他符号(如"🔹"、"•");普通文字和括号、引号开头的行返回空
+func lineMarker(line string) string {
+	switch {
+	case line == "":
+		return ""
+	case strings.HasPrefix(line, "#"):
+		return "#"
+	case strings.HasPrefix(line, "**"):
+		return "**"
+	case numberedMarker.MatchString(line):
+		return "1."
+	}
+	for _, marker := range []string{"- ", "* ", "+ "} {
+		if strings.HasPrefix(line, marker) {
+			return marker[:1]
+		}
+	}
+	// "•"属于标点,括号和引号开头的行(如"【精准岗位推荐】")是普通文字
+	r, _ := utf8.DecodeRuneInString(line)
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.In(r, unicode.Ps, unicode.Pi) {
+		return ""
+	}
+	return string(r)
+}
+
+// answerEntries 将回答按条目切分,不依赖具体的输出格式: 空行结束当前条目;
+// 比条目首行缩进更深的行,以及与首行缩进相同但列表标记不同的行(如"🔹 岗位"下的"• 字段"、
+// "1. 岗位"下的"- 字段"、"**岗位**"下的"- 字段")属于当前条目;其余的行开始新的条目
+func answerEntries(answer string) []string {
+	var entries []string
+	var head entryLine
+	open := false
+	for _, line := range strings.Split(answer, "\n") {
+		if strings.TrimSpace(line) == "" {
+			entries = append(entries, line)
+			open = false
+			continue
+		}
+		current := parseEntryLine(line)
+		continuation := open && (current.indent > head.indent ||
+			(current.indent == head.indent && head.marker != "" && current.marker != "" && current.marker != head.marker))
+		if continuation {
+			entries[len(entries)-1] += "\n" + line
+			continue
+		}
+		entries = append(entries, line)
+		head, open = current, true
+	}
+	return entries
+}
+
+// verifyCitations 校验回答中的引用: [文档N]的编号必须在检索到的文档范围内;
+// 域名与检索到的文档相同的网址(如zhipin.com的岗位详情页、爬取的网页所在的网站)必须是检索到的文档或网络搜索结果的网址,
+// 其他网站的链接不是知识库中的内容,不校验;被引用的文档标记Cited。
+// strip为true时删除包含无效引用的条目,否则在无效引用后标注"(未在检索结果中)"
+func verifyCitations(answer string, docs []model.RetrievedDoc, webResults []string, strip bool) (string, *model.CitationCheck) {
+	check := &model.CitationCheck{}
+	known := make(map[string]int, len(docs)+len(webResults))
+	for _, result := range webResults {
+		known[urlKey(result)] = 0
+	}
+	// 只校验检索到的文档所在网站的网址
+	hosts := make(map[string]bool, len(docs))
+	for i, doc := range docs {
+		if doc.Url == "" {
+			continue
+		}
+		known[urlKey(doc.Url)] = i + 1
+		if u, err := url.Parse(doc.Url); err == nil && u.Host != "" {
+			hosts[urlHost(u)] = true
+		}
+	}
+	invalid := func(ref string) {
+		if !slices.Contains(check.Invalid, ref) {
+			check.Invalid = append(check.Invalid, ref)
+		}
+	}
+
+	entries := answerEntries(answer)
+	kept := entries[:0]
+	for _, entry := range entries {
+		// 条目被删除时,其中引用的文档不算被引用
+		valid, cited := true, []int{}
+		entry = citationPattern.ReplaceAllStringFunc(entry, func(ref string) string {
+			found := true
+			for _, number := range numberPattern.FindAllString(ref, -1) {
+				n, _ := strconv.Atoi(number)
+				if n < 1 || n > len(docs) {
+					found = false
+					invalid(citationLabel(n))
+					continue
+				}
+				cited = append(cited, n)
+			}
+			if !found {
+				valid = false
+				return ref + "(未在检索结果中)"
+			}
+			return ref
+		})
+		entry = urlPattern.ReplaceAllStringFunc(entry, func(match string) string {
+			// 句末的标点和Markdown标记不属于网址,标注加在网址和标点之间
+			link := strings.TrimRight(match, urlTrailing)
+			trailing := match[len(link):]
+			u, err := url.Parse(link)
+			if err != nil || !hosts[urlHost(u)] || isSiteRoot(link) {
+				return match
+			}
+			n, ok := known[urlKey(link)]
+			if !ok {
+				valid = false
+				invalid(link)
+				return link + " (未在检索结果中)" + trailing
+			}
+			if n > 0 {
+				cited = append(cited, n)
+			}
+			return match
+		})
+		if strip && !valid {
+			check.Stripped++
+			continue
+		}
+		for _, n := range cited {
+			docs[n-1].Cited = true
+			if !slices.Contains(check.Cited, n) {
+				check.Cited = append(check.Cited, n)
+			}
+		}
+		kept = append(kept, entry)
+	}
+	slices.Sort(check.Cited)
+	check.Uncited = len(docs) > 0 && len(check.Cited) == 0
+	if !strip {
+		return strings.Join(kept, "\n"), check
+	}
+	// 删除条目后可能留下连续的空行
+	result := strings.Join(kept, "\n")
+	for strings.Contains(result, "\n\n\n") {
+		result = strings.ReplaceAll(result, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(result), check
+}
+
+// verifyAnswer 查询了知识库时校验回答的引用,结果记录在turn.Check中;
+// 返回校验后的回答(flag模式标注、strip模式删除无效引用,末尾附上提示)和提示本身,没有无效引用时提示为空。
+// 流式回答已经输出的片段无法修改,调用方只能在末尾补充提示
+func (as *agentService[D]) verifyAnswer(turn *model.SessionTurn, answer string) (string, string) {
+	if as.citationMode == citationOff || !slices.Contains(turn.Route, "retriever") {
+		return answer, ""
+	}
+	checked, check := verifyCitations(answer, turn.Documents, turn.WebResults, as.citationMode == citationStrip)
+	turn.Check = check
+	if check.Uncited {
+		log.Printf("回答没有引用检索到的文档")
+	}
+	if len(check.Invalid) == 0 {
+		return checked, ""
+	}
+	log.Printf("回答中有检索结果之外的引用: %s", strings.Join(check.Invalid, ", "))
+	note := fmt.Sprintf("⚠ 注意: 回答中的%s不在检索到的结果中,可能是模型编造的,请以参考文档为准。", strings.Join(check.Invalid, "、"))
+	if check.Stripped > 0 {
+		note = fmt.Sprintf("⚠ 注意: 回答中的%s不在检索到的结果中,可能是模型编造的,已删除相关的%d条内容。", strings.Join(check.Invalid, "、"), check.Stripped)
+	}
+	return checked + "\n\n" + note, note
+}
+
+// citationMode 引用校验方式,未配置或取值无效时为flag
+func citationMode(mode string) string {
+	switch mode {
+	case citationStrip, citationOff:
+		return mode
+	default:
+		return citationFlag
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+)
+
+func TestAnswerEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		want   []string
+	}{
+		{
+			name:   "岗位和字段",
+			answer: "【精准岗位推荐】\n🔹 Go开发 - 甲公司 [文档1]\n• 薪资范围：15-25K\n• 网址：https://www.zhipin.com/job_detail/a.html\n🔹 后端开发 - 乙公司 [文档2]\n• 薪资范围：面议",
+			want: []string{
+				"【精准岗位推荐】",
+				"🔹 Go开发 - 甲公司 [文档1]\n• 薪资范围：15-25K\n• 网址：https://www.zhipin.com/job_detail/a.html",
+				"🔹 后端开发 - 乙公司 [文档2]\n• 薪资范围：面议",
+			},
+		},
+		{
+			name:   "编号列表和缩进的子项",
+			answer: "1. Go开发 [文档1]\n   - 城市：北京\n2. Java开发 [文档2]\n- 城市：上海",
+			want: []string{
+				"1. Go开发 [文档1]\n   - 城市：北京",
+				"2. Java开发 [文档2]\n- 城市：上海",
+			},
+		},
+		{
+			name:   "加粗标题",
+			answer: "**Go开发** [文档1]\n- 薪资：20K\n\n**Java开发** [文档2]\n- 薪资：18K",
+			want: []string{
+				"**Go开发** [文档1]\n- 薪资：20K",
+				"",
+				"**Java开发** [文档2]\n- 薪资：18K",
+			},
+		},
+		{
+			name:   "平铺列表每项一个条目",
+			answer: "- 甲公司 [文档1]\n- 乙公司 [文档2]",
+			want:   []string{"- 甲公司 [文档1]", "- 乙公司 [文档2]"},
+		},
+		{
+			name:   "普通段落每行一个条目",
+			answer: "根据您的需求推荐如下。\n以上岗位供参考。",
+			want:   []string{"根据您的需求推荐如下。", "以上岗位供参考。"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answerEntries(tt.answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answerEntries() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCitations(t *testing.T) {
+	docs := func() []model.RetrievedDoc {
+		return []model.RetrievedDoc{
+			{Id: "a", Url: "https://www.zhipin.com/job_detail/a.html"},
+			{Id: "b", Url: "https://www.zhipin.com/job_detail/b.html"},
+			{Id: "c", Url: "https://blog.example.com/posts/go"},
+		}
+	}
+	tests := []struct {
+		name       string
+		answer     string
+		webResults []string
+		strip      bool
+		want       string
+		wantCheck  model.CitationCheck
+	}{
+		{
+			name:      "有效的编号",
+			answer:    "🔹 Go开发 [文档1]\n🔹 后端开发 [文档2]",
+			want:      "🔹 Go开发 [文档1]\n🔹 后端开发 [文档2]",
+			wantCheck: model.CitationCheck{Cited: []int{1, 2}},
+		},
+		{
+			name:      "一个引用中的多个编号",
+			answer:    "🔹 Go开发 [文档1、文档3]",
+			want:      "🔹 Go开发 [文档1、文档3]",
+			wantCheck: model.CitationCheck{Cited: []int{1, 3}},
+		},
+		{
+			name:      "超出范围的编号,flag模式下其余编号仍算被引用",
+			answer:    "🔹 Go开发 [文档1,7]",
+			want:      "🔹 Go开发 [文档1,7](未在检索结果中)",
+			wantCheck: model.CitationCheck{Cited: []int{1}, Invalid: []string{"[文档7]"}},
+		},
+		{
+			name:      "网址末尾的标点",
+			answer:    "详情见https://www.zhipin.com/job_detail/a.html。\n网址：https://zhipin.com/job_detail/b.html.",
+			want:      "详情见https://www.zhipin.com/job_detail/a.html。\n网址：https://zhipin.com/job_detail/b.html.",
+			wantCheck: model.CitationCheck{Cited: []int{1, 2}},
+		},
+		{
+			name:      "同一网站上编造的网址标注在标点之前",
+			answer:    "网址：https://www.zhipin.com/job_detail/x.html.",
+			want:      "网址：https://www.zhipin.com/job_detail/x.html (未在检索结果中).",
+			wantCheck: model.CitationCheck{Invalid: []string{"https://www.zhipin.com/job_detail/x.html"}, Uncited: true},
+		},
+		{
+			name:      "其他网站的链接不校验",
+			answer:    "参考 https://go.dev/doc/effective_go 和 https://www.zhaopin.com/jobs/123",
+			want:      "参考 https://go.dev/doc/effective_go 和 https://www.zhaopin.com/jobs/123",
+			wantCheck: model.CitationCheck{Uncited: true},
+		},
+		{
+			name:       "网络搜索结果中的网址",
+			answer:     "来源：https://blog.example.com/news/1",
+			webResults: []string{"https://blog.example.com/news/1?from=ddg"},
+			want:       "来源：https://blog.example.com/news/1",
+			wantCheck:  model.CitationCheck{Uncited: true},
+		},
+		{
+			name:      "招聘平台首页不校验",
+			answer:    "• BOSS直聘（https://www.zhipin.com/）",
+			want:      "• BOSS直聘（https://www.zhipin.com/）",
+			wantCheck: model.CitationCheck{Uncited: true},
+		},
+		{
+			name:      "strip删除包含无效引用的条目",
+			answer:    "【推荐】\n🔹 Go开发 [文档1]\n• 网址：https://www.zhipin.com/job_detail/a.html\n🔹 编造岗位 [文档2]\n• 网址：https://www.zhipin.com/job_detail/x.html\n\n💡 建议：完善简历",
+			strip:     true,
+			want:      "【推荐】\n🔹 Go开发 [文档1]\n• 网址：https://www.zhipin.com/job_detail/a.html\n\n💡 建议：完善简历",
+			wantCheck: model.CitationCheck{Cited: []int{1}, Invalid: []string{"https://www.zhipin.com/job_detail/x.html"}, Stripped: 1},
+		},
+		{
+			name:      "strip不删除其他网站的链接",
+			answer:    "🔹 Go开发 [文档1]\n• 参考：https://go.dev/doc/",
+			strip:     true,
+			want:      "🔹 Go开发 [文档1]\n• 参考：https://go.dev/doc/",
+			wantCheck: model.CitationCheck{Cited: []int{1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retrieved := docs()
+			got, check := verifyCitations(tt.answer, retrieved, tt.webResults, tt.strip)
+			if got != tt.want {
+				t.Errorf("verifyCitations() answer = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(*check, tt.wantCheck) {
+				t.Errorf("verifyCitations() check = %+v, want %+v", *check, tt.wantCheck)
+			}
+			for i, doc := range retrieved {
+				cited := false
+				for _, n := range tt.wantCheck.Cited {
+					cited = cited || n == i+1
+				}
+				if doc.Cited != cited {
+					t.Errorf("docs[%d].Cited = %t, want %t", i, doc.Cited, cited)
+				}
+			}
+		})
+	}
+}
+
+func TestUrlKey(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://www.zhipin.com/job_detail/a.html?ka=search", "zhipin.com/job_detail/a.html"},
+		{"https://ZHIPIN.com/job_detail/a.html/", "zhipin.com/job_detail/a.html"},
+		{"https://zhipin.com/job_detail/a.html**", "zhipin.com/job_detail/a.html"},
+		{"https://zhipin.com:443/job_detail/a.html", "zhipin.com/job_detail/a.html"},
+	}
+	for _, tt := range tests {
+		if got := urlKey(tt.raw); got != tt.want {
+			t.Errorf("urlKey(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCitationPattern(t *testing.T) {
+	answer := "岗位A[文档1] 岗位B【文档2】 岗位C[文档1, 3] 岗位D[文档1、文档3] 岗位E[文件1]"
+	want := []string{"[文档1]", "【文档2】", "[文档1, 3]", "[文档1、文档3]"}
+	if got := citationPattern.FindAllString(answer, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("citationPattern = %q, want %q", got, want)
+	}
+}
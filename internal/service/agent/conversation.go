@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/LouYuanbo1/crawleragent/param"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// DefaultRewritePrompt 追问改写的默认系统提示
+const DefaultRewritePrompt = `你负责把多轮对话中用户的最新问题改写为不依赖上下文、可以直接用于检索的独立问题。
+根据对话记录补全指代(如"第二个岗位"、"这家公司"、"那边")和省略的条件(城市、岗位、薪资等),保持原意,不要回答问题。
+问题本身已经完整时原样输出。只输出改写后的问题。`
+
+// DefaultSummaryPrompt 压缩对话记录的默认系统提示,%d为摘要的最大字数
+const DefaultSummaryPrompt = `你负责压缩对话记录。把已有摘要和新的对话合并为一段简洁的摘要,
+保留用户的求职背景和偏好(城市、薪资、经验、技能等)、提到过的岗位和公司名称以及关键结论,不超过%d字,只输出摘要。`
+
+// memoryConfig 填充对话记录配置的默认值
+func memoryConfig(cfg param.Memory) param.Memory {
+	if cfg.MaxTurns <= 0 {
+		cfg.MaxTurns = 4
+	}
+	if cfg.SummaryMaxChars <= 0 {
+		cfg.SummaryMaxChars = 800
+	}
+	if cfg.RewritePrompt == "" {
+		cfg.RewritePrompt = DefaultRewritePrompt
+	}
+	if cfg.SummaryPrompt == "" {
+		cfg.SummaryPrompt = fmt.Sprintf(DefaultSummaryPrompt, cfg.SummaryMaxChars)
+	}
+	return cfg
+}
+
+// formatHistory 将对话记录格式化为文本,用于改写和摘要的提示
+func formatHistory(messages []*schema.Message) string {
+	var builder strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case schema.User:
+			builder.WriteString("用户: ")
+		case schema.Assistant:
+			builder.WriteString("助手: ")
+		default:
+			builder.WriteString("摘要: ")
+		}
+		builder.WriteString(msg.Content)
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// QueryRewrite 追问改写节点: state["history"]中有对话记录时,由rewriter模型结合对话记录把追问
+// (如"第二个岗位的公司规模呢?")改写为独立的问题,用于意图识别和检索;原始问题保存在state["originalQuery"]中。
+// 请求的模式前缀在改写时保留;没有对话记录、rewriter为nil或改写失败时使用原始问题
+func QueryRewrite(rewriter model.BaseChatModel, systemPrompt string) *compose.Lambda {
+	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
+		query, ok := state["query"].(string)
+		if !ok {
+			return nil, errors.New("query not found in state")
+		}
+		state["originalQuery"] = query
+		history, _ := state["history"].([]*schema.Message)
+		if rewriter == nil || len(history) == 0 {
+			return state, nil
+		}
+		prefix, rest, hasPrefix := cutIntentPrefix(query)
+		msg, err := rewriter.Generate(ctx, []*schema.Message{
+			schema.SystemMessage(systemPrompt),
+			schema.UserMessage(fmt.Sprintf("对话记录:\n%s\n最新问题: %s", formatHistory(history), rest)),
+		})
+		if err != nil {
+			log.Printf("改写追问失败,使用原始问题: %v", err)
+			return state, nil
+		}
+		rewritten := strings.TrimSpace(msg.Content)
+		if rewritten == "" {
+			return state, nil
+		}
+		if hasPrefix {
+			rewritten = prefix.prefix + " " + rewritten
+		}
+		if rewritten != query {
+			log.Printf("追问改写: %s -> %s", query, rewritten)
+			stateTurn(state).RewrittenQuery = rewritten
+		}
+		state["query"] = rewritten
+		return state, nil
+	})
+}
+
+// Summarizer 返回压缩对话记录的函数,由summarizer模型把已有摘要和较早的轮次合并为不超过SummaryMaxChars字的摘要
+func Summarizer(summarizer model.BaseChatModel, cfg param.Memory) func(ctx context.Context, messages []*schema.Message) (string, error) {
+	return func(ctx context.Context, messages []*schema.Message) (string, error) {
+		msg, err := summarizer.Generate(ctx, []*schema.Message{
+			schema.SystemMessage(cfg.SummaryPrompt),
+			schema.UserMessage(formatHistory(messages)),
+		})
+		if err != nil {
+			return "", err
+		}
+		summary := []rune(strings.TrimSpace(msg.Content))
+		if len(summary) > cfg.SummaryMaxChars {
+			summary = summary[:cfg.SummaryMaxChars]
+		}
+		return string(summary), nil
+	}
+}
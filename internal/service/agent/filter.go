@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 岗位的经验和学历要求,与Boss直聘的取值一致
+var (
+	experienceValues = []string{"在校/应届", "1年以内", "1-3年", "3-5年", "5-10年", "10年以上"}
+	degreeValues     = []string{"初中及以下", "中专/中技", "高中", "大专", "本科", "硕士", "博士"}
+)
+
+const (
+	experienceAny = "经验不限"
+	degreeAny     = "学历不限"
+)
+
+// QueryFilters 从请求中抽取的岗位筛选条件,保存在图状态的"filters"键中,零值字段表示不限
+// jsonschema_description用于工具调用模式中检索工具的参数说明
+type QueryFilters struct {
+	Cities []string `json:"cities,omitempty" jsonschema_description:"城市名,不带市,如北京"`
+	// SalaryMin、SalaryMax 期望月薪范围(单位K),0表示不限
+	SalaryMin   int      `json:"salaryMin,omitempty" jsonschema_description:"期望月薪下限,单位K,0表示不限"`
+	SalaryMax   int      `json:"salaryMax,omitempty" jsonschema_description:"期望月薪上限,单位K,0表示不限"`
+	Experiences []string `json:"experiences,omitempty" jsonschema_description:"工作经验,取值为 在校/应届、1年以内、1-3年、3-5年、5-10年、10年以上"`
+	Degrees     []string `json:"degrees,omitempty" jsonschema_description:"学历要求,取值为 初中及以下、中专/中技、高中、大专、本科、硕士、博士"`
+	Skills      []string `json:"skills,omitempty" jsonschema_description:"技能关键词,给出招聘网站上常见的写法,如Go写为Go和Golang"`
+}
+
+// FilterFormat 约束筛选条件抽取模型输出的JSON Schema
+var FilterFormat = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"cities": {"type": "array", "items": {"type": "string"}},
+		"salaryMin": {"type": "integer"},
+		"salaryMax": {"type": "integer"},
+		"experiences": {"type": "array", "items": {"type": "string", "enum": ["在校/应届", "1年以内", "1-3年", "3-5年", "5-10年", "10年以上"]}},
+		"degrees": {"type": "array", "items": {"type": "string", "enum": ["初中及以下", "中专/中技", "高中", "大专", "本科", "硕士", "博士"]}},
+		"skills": {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["cities", "salaryMin", "salaryMax", "experiences", "degrees", "skills"]
+}`)
+
+// DefaultFilterPrompt 筛选条件抽取的默认系统提示
+const DefaultFilterPrompt = `你从用户的找工作请求中抽取岗位筛选条件,只输出JSON,请求中没有提到的条件输出空数组或0:
+- cities: 城市名,不带"市",如["北京","上海"]
+- salaryMin、salaryMax: 期望月薪范围,单位K(千元),如"20K以上"为salaryMin=20,salaryMax=0;"15-25K"为15和25;"年薪30万"约为salaryMin=25
+- experiences: 工作经验,只能取 在校/应届、1年以内、1-3年、3-5年、5-10年、10年以上,"3-5年经验"为["3-5年"]
+- degrees: 学历要求,只能取 初中及以下、中专/中技、高中、大专、本科、硕士、博士
+- skills: 技术栈或技能关键词,给出招聘网站上常见的写法,如"Go"写为["Go","Golang"]
+不要臆测请求中没有的条件。`
+
+// 筛选条件对应的boss_jobs字段
+const (
+	filterFieldCity       = "cityName"
+	filterFieldSalaryMin  = "salaryMin"
+	filterFieldSalaryMax  = "salaryMax"
+	filterFieldExperience = "jobExperience"
+	filterFieldDegree     = "jobDegree"
+	filterFieldSkills     = "skills.keyword"
+)
+
+// IsEmpty 是否没有任何筛选条件
+func (f *QueryFilters) IsEmpty() bool {
+	return f == nil || len(f.Terms()) == 0
+}
+
+// Terms 将筛选条件转换为存储的过滤条件,各条件之间为且的关系:
+// 薪资按区间重叠匹配(岗位薪资上限不低于期望下限,下限不高于期望上限),
+// 经验和学历同时匹配"经验不限"、"学历不限"的岗位,技能匹配任意一个即可
+func (f *QueryFilters) Terms() []store.Term {
+	if f == nil {
+		return nil
+	}
+	var terms []store.Term
+	if len(f.Cities) > 0 {
+		terms = append(terms, store.Term{Field: filterFieldCity, Values: f.Cities})
+	}
+	if f.SalaryMin > 0 {
+		gte := float64(f.SalaryMin)
+		terms = append(terms, store.RangeTerm(filterFieldSalaryMax, &gte, nil))
+	}
+	if f.SalaryMax > 0 {
+		lte := float64(f.SalaryMax)
+		terms = append(terms, store.RangeTerm(filterFieldSalaryMin, nil, &lte))
+	}
+	if len(f.Experiences) > 0 {
+		terms = append(terms, store.Term{Field: filterFieldExperience, Values: append(slices.Clone(f.Experiences), experienceAny)})
+	}
+	if len(f.Degrees) > 0 {
+		terms = append(terms, store.Term{Field: filterFieldDegree, Values: append(slices.Clone(f.Degrees), degreeAny)})
+	}
+	if len(f.Skills) > 0 {
+		terms = append(terms, store.Term{Field: filterFieldSkills, Values: f.Skills})
+	}
+	return terms
+}
+
+// String 筛选条件的中文描述,写入参考文档的开头,让模型知道检索时使用的条件
+func (f *QueryFilters) String() string {
+	if f == nil {
+		return ""
+	}
+	var parts []string
+	if len(f.Cities) > 0 {
+		parts = append(parts, "城市: "+strings.Join(f.Cities, "/"))
+	}
+	switch {
+	case f.SalaryMin > 0 && f.SalaryMax > 0:
+		parts = append(parts, fmt.Sprintf("月薪: %d-%dK", f.SalaryMin, f.SalaryMax))
+	case f.SalaryMin > 0:
+		parts = append(parts, fmt.Sprintf("月薪: %dK以上", f.SalaryMin))
+	case f.SalaryMax > 0:
+		parts = append(parts, fmt.Sprintf("月薪: %dK以下", f.SalaryMax))
+	}
+	if len(f.Experiences) > 0 {
+		parts = append(parts, "经验: "+strings.Join(f.Experiences, "/"))
+	}
+	if len(f.Degrees) > 0 {
+		parts = append(parts, "学历: "+strings.Join(f.Degrees, "/"))
+	}
+	if len(f.Skills) > 0 {
+		parts = append(parts, "技能: "+strings.Join(f.Skills, "/"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// normalize 去掉空值和重复值,经验和学历只保留合法取值,城市去掉"市"后缀,薪资范围颠倒时交换
+func (f *QueryFilters) normalize() {
+	clean := func(values []string, allowed []string, trimSuffix string) []string {
+		result := make([]string, 0, len(values))
+		for _, value := range values {
+			value = strings.TrimSuffix(strings.TrimSpace(value), trimSuffix)
+			if value == "" || slices.Contains(result, value) {
+				continue
+			}
+			if allowed != nil && !slices.Contains(allowed, value) {
+				continue
+			}
+			result = append(result, value)
+		}
+		return result
+	}
+	f.Cities = clean(f.Cities, nil, "市")
+	f.Experiences = clean(f.Experiences, experienceValues, "")
+	f.Degrees = clean(f.Degrees, degreeValues, "")
+	f.Skills = clean(f.Skills, nil, "")
+	f.SalaryMin, f.SalaryMax = max(f.SalaryMin, 0), max(f.SalaryMax, 0)
+	if f.SalaryMax > 0 && f.SalaryMin > f.SalaryMax {
+		f.SalaryMin, f.SalaryMax = f.SalaryMax, f.SalaryMin
+	}
+}
+
+// FilterExtractor 返回由extractor模型按FilterFormat从请求中抽取筛选条件的函数,systemPrompt为空时使用默认提示
+func FilterExtractor(extractor model.BaseChatModel, systemPrompt string) func(ctx context.Context, query string) (*QueryFilters, error) {
+	if systemPrompt == "" {
+		systemPrompt = DefaultFilterPrompt
+	}
+	return func(ctx context.Context, query string) (*QueryFilters, error) {
+		msg, err := extractor.Generate(ctx, []*schema.Message{
+			schema.SystemMessage(systemPrompt),
+			schema.UserMessage(query),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("调用模型失败: %w", err)
+		}
+		content, err := jsonObject(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		var filters QueryFilters
+		if err := json.Unmarshal([]byte(content), &filters); err != nil {
+			return nil, fmt.Errorf("解析模型输出失败: %w", err)
+		}
+		filters.normalize()
+		return &filters, nil
+	}
+}
+
+// QueryUnderstanding 查询理解节点,在检索知识库之前用extract(见FilterExtractor)从请求中抽取城市、薪资、经验、学历和技能,
+// 结果保存在state["filters"]中供检索节点过滤;extract为nil时不抽取,抽取失败时只记录日志,按不带条件检索
+func QueryUnderstanding(extract func(ctx context.Context, query string) (*QueryFilters, error)) *compose.Lambda {
+	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
+		query, ok := state["query"].(string)
+		if !ok {
+			return nil, errors.New("query not found in state")
+		}
+		if extract == nil {
+			return state, nil
+		}
+		filters, err := extract(ctx, query)
+		if err != nil {
+			log.Printf("抽取筛选条件失败,不带条件检索: %v", err)
+			return state, nil
+		}
+		state["filters"] = filters
+		stateTurn(state).Filters = filters.String()
+		log.Printf("筛选条件: %s", filters)
+		return state, nil
+	})
+}
+
+// stateFilters 取出查询理解节点抽取的筛选条件,没有时返回nil
+func stateFilters(state map[string]any) *QueryFilters {
+	filters, _ := state["filters"].(*QueryFilters)
+	return filters
+}
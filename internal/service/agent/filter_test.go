@@ -0,0 +1,146 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestQueryFiltersTerms(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters *QueryFilters
+		want    []store.Term
+	}{
+		{
+			name:    "nil",
+			filters: nil,
+			want:    nil,
+		},
+		{
+			name:    "没有条件",
+			filters: &QueryFilters{},
+			want:    nil,
+		},
+		{
+			name:    "城市",
+			filters: &QueryFilters{Cities: []string{"北京", "上海"}},
+			want:    []store.Term{{Field: filterFieldCity, Values: []string{"北京", "上海"}}},
+		},
+		{
+			name:    "只有薪资下限: 岗位薪资上限不低于下限",
+			filters: &QueryFilters{SalaryMin: 20},
+			want:    []store.Term{store.RangeTerm(filterFieldSalaryMax, float(20), nil)},
+		},
+		{
+			name:    "只有薪资上限: 岗位薪资下限不高于上限",
+			filters: &QueryFilters{SalaryMax: 25},
+			want:    []store.Term{store.RangeTerm(filterFieldSalaryMin, nil, float(25))},
+		},
+		{
+			name:    "薪资区间按重叠匹配",
+			filters: &QueryFilters{SalaryMin: 15, SalaryMax: 25},
+			want: []store.Term{
+				store.RangeTerm(filterFieldSalaryMax, float(15), nil),
+				store.RangeTerm(filterFieldSalaryMin, nil, float(25)),
+			},
+		},
+		{
+			name:    "经验同时匹配经验不限",
+			filters: &QueryFilters{Experiences: []string{"3-5年"}},
+			want:    []store.Term{{Field: filterFieldExperience, Values: []string{"3-5年", experienceAny}}},
+		},
+		{
+			name:    "学历同时匹配学历不限",
+			filters: &QueryFilters{Degrees: []string{"本科", "硕士"}},
+			want:    []store.Term{{Field: filterFieldDegree, Values: []string{"本科", "硕士", degreeAny}}},
+		},
+		{
+			name:    "技能匹配任意一个",
+			filters: &QueryFilters{Skills: []string{"Go", "Golang"}},
+			want:    []store.Term{{Field: filterFieldSkills, Values: []string{"Go", "Golang"}}},
+		},
+		{
+			name: "全部条件",
+			filters: &QueryFilters{
+				Cities:      []string{"北京"},
+				SalaryMin:   20,
+				Experiences: []string{"1-3年"},
+				Degrees:     []string{"大专"},
+				Skills:      []string{"Java"},
+			},
+			want: []store.Term{
+				{Field: filterFieldCity, Values: []string{"北京"}},
+				store.RangeTerm(filterFieldSalaryMax, float(20), nil),
+				{Field: filterFieldExperience, Values: []string{"1-3年", experienceAny}},
+				{Field: filterFieldDegree, Values: []string{"大专", degreeAny}},
+				{Field: filterFieldSkills, Values: []string{"Java"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filters.Terms(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Terms() = %+v, want %+v", got, tt.want)
+			}
+			if empty := tt.filters.IsEmpty(); empty != (len(tt.want) == 0) {
+				t.Errorf("IsEmpty() = %t, want %t", empty, len(tt.want) == 0)
+			}
+		})
+	}
+}
+
+func TestQueryFiltersTermsDoesNotModifyFilters(t *testing.T) {
+	filters := &QueryFilters{Experiences: make([]string, 1, 4), Degrees: make([]string, 1, 4)}
+	filters.Experiences[0], filters.Degrees[0] = "3-5年", "本科"
+	filters.Terms()
+	filters.Terms()
+	if !reflect.DeepEqual(filters.Experiences, []string{"3-5年"}) || !reflect.DeepEqual(filters.Degrees, []string{"本科"}) {
+		t.Errorf("Terms() modified filters: %+v", filters)
+	}
+	if extra := filters.Experiences[:2]; extra[1] != "" {
+		t.Errorf("Terms() wrote into the spare capacity of Experiences: %q", extra)
+	}
+}
+
+func TestQueryFiltersNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters QueryFilters
+		want    QueryFilters
+	}{
+		{
+			name:    "城市去掉市后缀并去重",
+			filters: QueryFilters{Cities: []string{"北京市", " 北京", "", "上海"}},
+			want:    QueryFilters{Cities: []string{"北京", "上海"}, Experiences: []string{}, Degrees: []string{}, Skills: []string{}},
+		},
+		{
+			name:    "经验不限和学历不限不是筛选条件",
+			filters: QueryFilters{Experiences: []string{"经验不限", "3-5年", "三年"}, Degrees: []string{"学历不限"}},
+			want:    QueryFilters{Cities: []string{}, Experiences: []string{"3-5年"}, Degrees: []string{}, Skills: []string{}},
+		},
+		{
+			name:    "薪资范围颠倒时交换",
+			filters: QueryFilters{SalaryMin: 30, SalaryMax: 20},
+			want:    QueryFilters{SalaryMin: 20, SalaryMax: 30, Cities: []string{}, Experiences: []string{}, Degrees: []string{}, Skills: []string{}},
+		},
+		{
+			name:    "负数薪资视为不限",
+			filters: QueryFilters{SalaryMin: -5, SalaryMax: 10},
+			want:    QueryFilters{SalaryMax: 10, Cities: []string{}, Experiences: []string{}, Degrees: []string{}, Skills: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.normalize()
+			if !reflect.DeepEqual(tt.filters, tt.want) {
+				t.Errorf("normalize() = %+v, want %+v", tt.filters, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Intent 用户请求需要的信息来源
+type Intent string
+
+const (
+	// IntentKnowledgeBase 使用ES知识库(爬取的数据)检索
+	IntentKnowledgeBase Intent = "knowledge_base"
+	// IntentWebSearch 使用网络搜索
+	IntentWebSearch Intent = "web_search"
+	// IntentBoth 同时使用知识库和网络搜索
+	IntentBoth Intent = "both"
+	// IntentNone 不需要外部信息,直接回答
+	IntentNone Intent = "none"
+)
+
+// 意图的来源
+const (
+	IntentSourcePrefix   = "prefix"
+	IntentSourceLLM      = "llm"
+	IntentSourceFallback = "fallback"
+)
+
+// IntentDecision 意图识别结果,保存在图状态的"intent"键中,便于排查路由问题
+type IntentDecision struct {
+	Intent Intent `json:"intent"`
+	Reason string `json:"reason,omitempty"`
+	// Source 决策来源: prefix(请求前缀显式指定), llm(模型判断), fallback(模型调用或解析失败时的默认值)
+	Source string `json:"source"`
+	// Raw 模型的原始输出,只在Source为llm或fallback时记录
+	Raw string `json:"raw,omitempty"`
+}
+
+// intentPrefix 请求的显式意图前缀
+type intentPrefix struct {
+	prefix string
+	intent Intent
+}
+
+// intentPrefixes 以这些前缀开头的请求直接使用对应意图,不调用模型,前缀会从请求中去掉
+var intentPrefixes = []intentPrefix{
+	{"查询模式", IntentKnowledgeBase},
+	{"搜索模式", IntentKnowledgeBase},
+	{"联网模式", IntentWebSearch},
+	{"混合模式", IntentBoth},
+	{"聊天模式", IntentNone},
+}
+
+// IntentFormat 约束意图识别模型输出的JSON Schema
+var IntentFormat = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"intent": {"type": "string", "enum": ["knowledge_base", "web_search", "both", "none"]},
+		"reason": {"type": "string"}
+	},
+	"required": ["intent", "reason"]
+}`)
+
+// DefaultIntentPrompt 意图识别的默认系统提示
+const DefaultIntentPrompt = `你是一个请求路由器,判断回答用户的请求需要哪些信息来源,只输出JSON: {"intent": "...", "reason": "..."}
+intent的取值:
+- knowledge_base: 需要查询本地知识库,知识库中是爬取的招聘岗位(职位、公司、薪资、城市、技能要求、福利等)和网页
+- web_search: 需要互联网上的最新信息或知识库之外的内容,如新闻、行业动态、公司背景、政策
+- both: 既要推荐知识库中的岗位,又需要网络上的补充信息
+- none: 闲聊、情绪倾诉、一般性的职业建议等不需要检索就能回答的请求
+reason用一句话说明理由。`
+
+// cutIntentPrefix 拆出请求的显式意图前缀和去掉前缀(及其后的冒号)的请求,追问改写和意图识别共用;
+// 前缀后面没有内容时(如只发送"查询模式")不算作前缀,按普通请求处理
+func cutIntentPrefix(query string) (intentPrefix, string, bool) {
+	trimmed := strings.TrimSpace(query)
+	for _, p := range intentPrefixes {
+		if rest, ok := strings.CutPrefix(trimmed, p.prefix); ok {
+			if rest = strings.TrimLeft(rest, ":： "); rest != "" {
+				return p, rest, true
+			}
+		}
+	}
+	return intentPrefix{}, query, false
+}
+
+// ParseIntent 解析配置中的意图名称,为空时返回def
+func ParseIntent(name string, def Intent) (Intent, error) {
+	switch intent := Intent(name); intent {
+	case "":
+		return def, nil
+	case IntentKnowledgeBase, IntentWebSearch, IntentBoth, IntentNone:
+		return intent, nil
+	default:
+		return "", fmt.Errorf("未知的意图: %q", name)
+	}
+}
+
+// IntentDetection 意图识别节点: 请求以显式前缀(如"查询模式")开头时直接使用前缀对应的意图,
+// 否则由router模型按IntentFormat输出意图;模型调用或解析失败(包括输出未知的意图)时使用fallback,
+// 即智能体配置的默认路由(param.Agent.DefaultIntent)。
+// 结果保存在state["intent"]中;hybrid为false(没有配置混合模式提示)时both降级为knowledge_base
+func IntentDetection(router model.BaseChatModel, systemPrompt string, fallback Intent, hybrid bool) *compose.Lambda {
+	if systemPrompt == "" {
+		systemPrompt = DefaultIntentPrompt
+	}
+	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
+		query, ok := state["query"].(string)
+		if !ok {
+			return nil, errors.New("query not found in state")
+		}
+		var decision *IntentDecision
+		if prefix, rest, ok := cutIntentPrefix(query); ok {
+			state["query"] = rest
+			decision = &IntentDecision{Intent: prefix.intent, Source: IntentSourcePrefix}
+		} else {
+			decision = classifyIntent(ctx, router, systemPrompt, query, fallback)
+		}
+		if decision.Intent == IntentBoth && !hybrid {
+			decision.Intent = IntentKnowledgeBase
+		}
+		// 没有经过对应检索节点时,提示模板中的变量也需要有值
+		if _, ok := state["referenceDocs"]; !ok {
+			state["referenceDocs"] = "无(未查询知识库)"
+		}
+		if _, ok := state["duckDuckGoResults"]; !ok {
+			state["duckDuckGoResults"] = "无(未进行网络搜索)"
+		}
+		state["intent"] = decision
+		turn := stateTurn(state)
+		turn.Intent, turn.IntentReason = string(decision.Intent), decision.Reason
+		turn.Route = routeNodes(decision.Intent)
+		log.Printf("意图识别: %s (来源: %s) %s", decision.Intent, decision.Source, decision.Reason)
+		return state, nil
+	})
+}
+
+func classifyIntent(ctx context.Context, router model.BaseChatModel, systemPrompt, query string, fallback Intent) *IntentDecision {
+	if router == nil {
+		return &IntentDecision{Intent: fallback, Reason: "未配置意图识别模型", Source: IntentSourceFallback}
+	}
+	msg, err := router.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(systemPrompt),
+		schema.UserMessage(query),
+	})
+	if err != nil {
+		return &IntentDecision{Intent: fallback, Reason: fmt.Sprintf("调用模型失败: %v", err), Source: IntentSourceFallback}
+	}
+	decision, err := parseIntent(msg.Content)
+	if err != nil {
+		return &IntentDecision{Intent: fallback, Reason: err.Error(), Source: IntentSourceFallback, Raw: msg.Content}
+	}
+	decision.Source = IntentSourceLLM
+	decision.Raw = msg.Content
+	return decision
+}
+
+// parseIntent 解析模型输出的JSON,兼容输出前后带有多余文本(如思考过程)的情况
+func parseIntent(content string) (*IntentDecision, error) {
+	object, err := jsonObject(content)
+	if err != nil {
+		return nil, err
+	}
+	var decision IntentDecision
+	if err := json.Unmarshal([]byte(object), &decision); err != nil {
+		return nil, fmt.Errorf("解析模型输出失败: %w", err)
+	}
+	switch decision.Intent {
+	case IntentKnowledgeBase, IntentWebSearch, IntentBoth, IntentNone:
+		return &decision, nil
+	default:
+		return nil, fmt.Errorf("未知的意图: %q", decision.Intent)
+	}
+}
+
+// jsonObject 取出模型输出中第一个"{"到最后一个"}"之间的JSON对象
+func jsonObject(content string) (string, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("模型输出不是JSON: %q", content)
+	}
+	return content[start : end+1], nil
+}
+
+func stateIntent(state map[string]any) (Intent, error) {
+	decision, ok := state["intent"].(*IntentDecision)
+	if !ok {
+		return "", errors.New("intent not found in state")
+	}
+	return decision.Intent, nil
+}
+
+// BranchCondition 意图识别后的分支: 需要知识库时先经过查询理解再检索知识库,只需要网络搜索时搜索,不需要检索时直接进入聊天模式提示
+func BranchCondition(ctx context.Context, state map[string]any) (string, error) {
+	intent, err := stateIntent(state)
+	if err != nil {
+		return "", err
+	}
+	switch intent {
+	case IntentKnowledgeBase, IntentBoth:
+		return "queryUnderstanding", nil
+	case IntentNone:
+		return "chatModePrompt", nil
+	default:
+		return "duckDuckGoSearch", nil
+	}
+}
+
+// AfterRetrieverCondition 检索知识库后的分支: 混合模式继续网络搜索,否则进入知识库模式提示
+func AfterRetrieverCondition(ctx context.Context, state map[string]any) (string, error) {
+	intent, err := stateIntent(state)
+	if err != nil {
+		return "", err
+	}
+	if intent == IntentBoth {
+		return "duckDuckGoSearch", nil
+	}
+	return "searchModePrompt", nil
+}
+
+// AfterSearchCondition 网络搜索后的分支: 混合模式进入混合模式提示,否则进入聊天模式提示
+func AfterSearchCondition(ctx context.Context, state map[string]any) (string, error) {
+	intent, err := stateIntent(state)
+	if err != nil {
+		return "", err
+	}
+	if intent == IntentBoth {
+		return "hybridModePrompt", nil
+	}
+	return "chatModePrompt", nil
+}
+
+// routeNodes 意图对应的流程图路径,与BranchCondition、AfterRetrieverCondition、AfterSearchCondition的分支一致,
+// 进入工具调用模式时由ToolAgentInput替换为工具调用模式的节点
+func routeNodes(intent Intent) []string {
+	route := []string{"queryRewrite", "intentDetection"}
+	switch intent {
+	case IntentKnowledgeBase:
+		route = append(route, "queryUnderstanding", "retriever", "searchModePrompt")
+	case IntentBoth:
+		route = append(route, "queryUnderstanding", "retriever", "duckDuckGoSearch", "hybridModePrompt")
+	case IntentNone:
+		route = append(route, "chatModePrompt")
+	default:
+		route = append(route, "duckDuckGoSearch", "chatModePrompt")
+	}
+	return append(route, "llm")
+}
@@ -6,51 +6,75 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
 	"github.com/LouYuanbo1/crawleragent/param"
 	"github.com/cloudwego/eino-ext/components/tool/duckduckgo/v2"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
-	"github.com/elastic/go-elasticsearch/v9/typedapi/core/search"
-	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
 )
 
-// IntentDetection 意图检测节点,用于识别用户查询的意图,当用户输入以查询模式或搜索模式开头时,将意图设置为"retriever",
-// 否则将意图设置为"chatModePrompt"
-func IntentDetection() *compose.Lambda {
-	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
-		query, ok := state["query"].(string)
-		if !ok {
-			return nil, errors.New("query not found in state")
-		}
-		isEsRAGMode := strings.HasPrefix(query, "查询模式")
-		if isEsRAGMode {
-			state["isEsRAGMode"] = true
-		} else {
-			state["isEsRAGMode"] = false
-		}
-		println("isEsRAGMode: ", state["isEsRAGMode"].(bool))
-		return state, nil
-	})
+// hybridQuery 按检索配置生成混合检索参数,未配置的字段使用默认值(K=5,每路候选20个)
+func hybridQuery(cfg param.Retrieval, text string, vector []float32, textFields []string, k int) store.HybridQuery {
+	candidates := cfg.Candidates
+	if candidates <= 0 {
+		candidates = 20
+	}
+	return store.HybridQuery{
+		Text:         text,
+		Fields:       textFields,
+		Vector:       vector,
+		K:            k,
+		Candidates:   candidates,
+		Fusion:       cfg.Fusion,
+		RankConstant: cfg.RankConstant,
+		TextWeight:   cfg.TextWeight,
+		VectorWeight: cfg.VectorWeight,
+	}
+}
+
+func retrievalK(cfg param.Retrieval) int {
+	if cfg.K <= 0 {
+		return 5
+	}
+	return cfg.K
+}
+
+func maxSearchK(cfg param.Retrieval) int {
+	if cfg.MaxK <= 0 {
+		return retrievalK(cfg) * 10
+	}
+	return cfg.MaxK
 }
 
-// BranchCondition 分支条件节点,根据用户查询意图,选择下一个节点,当用户输入以查询模式或搜索模式开头时,将选择"retriever"节点,
-// 否则将选择"chatModePrompt"节点
-func BranchCondition(ctx context.Context, state map[string]any) (string, error) {
-	isEsRAGMode, ok := state["isEsRAGMode"].(bool)
-	if !ok {
-		return "", errors.New("isEsRAGMode not found in state")
+// retrieve 按检索配置做混合检索,filters作为过滤条件;
+// 条件过严或旧文档缺少薪资等字段时可能一个都检索不到,此时去掉筛选条件重新检索,relaxed为true
+func retrieve[D model.Document](ctx context.Context, docStore store.Store[D], cfg param.Retrieval,
+	query string, vector []float32, k int, filters *QueryFilters) (hits []store.Hit[D], relaxed bool, err error) {
+	hybrid := hybridQuery(cfg, query, vector, cfg.TextFields, k)
+	hybrid.Filters = filters.Terms()
+	if hits, err = store.HybridSearch(ctx, docStore, hybrid); err != nil {
+		return nil, false, err
 	}
-	if isEsRAGMode {
-		return "retriever", nil
+	if len(hits) == 0 && len(hybrid.Filters) > 0 {
+		log.Printf("按筛选条件(%s)没有检索到文档,去掉筛选条件重新检索", filters)
+		hybrid.Filters = nil
+		if hits, err = store.HybridSearch(ctx, docStore, hybrid); err != nil {
+			return nil, false, err
+		}
+		relaxed = true
 	}
-	return "duckDuckGoSearch", nil
+	return hits, relaxed, nil
 }
 
-// Retriever 检索节点,用于根据用户查询意图,从索引中检索相关文档
-func Retriever[D model.Document]() *compose.Lambda {
+// Retriever 检索节点,用于根据用户查询意图,从知识库中检索相关文档
+// 配置了TextFields时同时做全文检索和向量检索并融合结果,城市、技能等精确词也能命中;
+// 状态中有查询理解节点抽取的筛选条件时作为过滤条件,过滤后没有结果时去掉条件重新检索
+func Retriever[D model.Document](docStore store.Store[D], cfg param.Retrieval) *compose.Lambda {
 	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
 		query, ok := state["query"].(string)
 		if !ok {
@@ -59,40 +83,42 @@ func Retriever[D model.Document]() *compose.Lambda {
 		fmt.Printf("query: %s", query)
 		var embeddings [][]float32
 		var err error
+		start := time.Now()
 		err = compose.ProcessState(ctx, func(ctx context.Context, s *State) error {
 			embeddings, err = s.Embedder.Embed(ctx, []string{query})
 			if err != nil {
 				return err
 			}
-			embedding := embeddings[0]
-			//这里搜索不要设置太多,否则会超出模型上下文导致上下文清空
-			K := 5
-			numCandidates := 100
-			searchResp, err := s.TypedEsClient.Search().Index(s.IndexName).
-				Request(&search.Request{
-					Knn: []types.KnnSearch{
-						{
-							Field:         "embedding",
-							QueryVector:   embedding,
-							K:             &K,
-							NumCandidates: &numCandidates,
-						},
-					},
-				}).Do(ctx)
+			//这里K不要设置太大,否则会超出模型上下文导致上下文清空
+			filters := stateFilters(state)
+			hits, relaxed, err := retrieve(ctx, docStore, cfg, query, embeddings[0], retrievalK(cfg), filters)
 			if err != nil {
 				return err
 			}
 
+			turn := stateTurn(state)
+			turn.FiltersRelaxed = relaxed
+			turn.Timing.RetrievalMs = time.Since(start).Milliseconds()
+			for _, hit := range hits {
+				turn.Documents = append(turn.Documents, retrievedDoc(hit.Doc, hit.ID, hit.Score))
+			}
+
 			var Builder strings.Builder
-			Builder.WriteString("参考文档(JSON格式):\n\n")
-			for i, hit := range searchResp.Hits.Hits {
-				//fmt.Printf("文档%d原始JSON: %s\n", i+1, string(hit.Source_))
-				Builder.WriteString(fmt.Sprintf("文档%d:\n", i+1))
-				Builder.WriteString(string(hit.Source_))
+			if !filters.IsEmpty() {
+				Builder.WriteString(fmt.Sprintf("检索条件: %s\n", filters))
+				if relaxed {
+					Builder.WriteString("知识库中没有完全满足条件的文档,以下为相近的文档,请向用户说明\n")
+				}
+				Builder.WriteString("\n")
+			}
+			Builder.WriteString("参考文档(JSON格式,回答时用编号引用):\n\n")
+			for i, hit := range hits {
+				Builder.WriteString(citationLabel(i + 1))
+				Builder.WriteString("\n")
+				Builder.WriteString(docSource(hit.Doc))
 				Builder.WriteString("\n\n")
 			}
 			state["referenceDocs"] = Builder.String()
-			//fmt.Print(state)
 			return nil
 		})
 		if err != nil {
@@ -103,6 +129,141 @@ func Retriever[D model.Document]() *compose.Lambda {
 	})
 }
 
+// ChunkRetriever 分块检索节点,在分块存储中做kNN检索(配置了TextFields时与分块内容的全文检索融合),
+// 再按ParentId将命中的分块聚合回原文档,原文档得分取其分块的最高分;
+// 筛选条件针对的是岗位字段,分块中没有这些字段,分块检索不使用筛选条件
+func ChunkRetriever[D model.Document](docStore store.Store[D], chunkStore store.Store[*model.ChunkDoc], cfg param.Retrieval) *compose.Lambda {
+	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
+		query, ok := state["query"].(string)
+		if !ok {
+			return nil, errors.New("query not found in state")
+		}
+		start := time.Now()
+		err := compose.ProcessState(ctx, func(ctx context.Context, s *State) error {
+			embeddings, err := s.Embedder.Embed(ctx, []string{query})
+			if err != nil {
+				return err
+			}
+			// 分块中记录的是文档类型的逻辑索引名,实际检索的索引可能带有维度后缀
+			var schemaDoc D
+			// 分块比原文档多,候选数量需要相应放大,聚合后再截取前maxParents个原文档
+			maxParents := retrievalK(cfg)
+			var textFields []string
+			if len(cfg.TextFields) > 0 {
+				textFields = []string{"content"}
+			}
+			chunkQuery := hybridQuery(cfg, query, embeddings[0], textFields, maxParents*4)
+			chunkQuery.Filters = []store.Term{{Field: "parentIndex", Values: []string{schemaDoc.GetIndex()}}}
+			chunkHits, err := store.HybridSearch(ctx, chunkStore, chunkQuery)
+			if err != nil {
+				return err
+			}
+
+			type parentHit struct {
+				id       string
+				score    float64
+				snippets []string
+			}
+			parents := make([]*parentHit, 0, maxParents)
+			parentMap := make(map[string]*parentHit)
+			for _, hit := range chunkHits {
+				chunk := hit.Doc
+				parent, ok := parentMap[chunk.ParentId]
+				if !ok {
+					parent = &parentHit{id: chunk.ParentId}
+					parentMap[chunk.ParentId] = parent
+					parents = append(parents, parent)
+				}
+				parent.score = max(parent.score, hit.Score)
+				// 每个原文档最多保留2个命中分块作为相关片段
+				if len(parent.snippets) < 2 {
+					parent.snippets = append(parent.snippets, chunk.Content)
+				}
+			}
+			sort.SliceStable(parents, func(i, j int) bool { return parents[i].score > parents[j].score })
+			if len(parents) > maxParents {
+				parents = parents[:maxParents]
+			}
+
+			var Builder strings.Builder
+			Builder.WriteString("参考文档(JSON格式,回答时用编号引用):\n\n")
+			if len(parents) > 0 {
+				ids := make([]string, 0, len(parents))
+				for _, parent := range parents {
+					ids = append(ids, parent.id)
+				}
+				docs, err := docStore.MGet(ctx, ids)
+				if err != nil {
+					return err
+				}
+				docMap := make(map[string]D, len(docs))
+				for _, doc := range docs {
+					docMap[doc.GetID()] = doc
+				}
+				turn := stateTurn(state)
+				turn.Timing.RetrievalMs = time.Since(start).Milliseconds()
+				for _, parent := range parents {
+					doc, ok := docMap[parent.id]
+					if !ok {
+						continue
+					}
+					// 编号与turn.Documents的顺序一致,原文档已被删除的分块不占用编号
+					turn.Documents = append(turn.Documents, retrievedDoc(doc, parent.id, parent.score))
+					Builder.WriteString(citationLabel(len(turn.Documents)))
+					Builder.WriteString("\n")
+					Builder.WriteString(docSource(doc))
+					Builder.WriteString("\n相关片段:\n")
+					for _, snippet := range parent.snippets {
+						Builder.WriteString(snippet)
+						Builder.WriteString("\n")
+					}
+					Builder.WriteString("\n")
+				}
+			}
+			state["referenceDocs"] = Builder.String()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return state, nil
+	})
+}
+
+// docSource 将文档转换为JSON作为参考文档,去掉向量字段,避免占用模型上下文
+func docSource[D model.Document](doc D) string {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return ""
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return string(data)
+	}
+	delete(fields, "embedding")
+	if data, err = json.Marshal(fields); err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// retrievedDoc 检索到的文档的记录,带上文档的标题和网址,便于调用方展示引用来源
+func retrievedDoc[D model.Document](doc D, id string, score float64) model.RetrievedDoc {
+	retrieved := model.RetrievedDoc{Index: doc.GetIndex(), Id: id, Score: score}
+	switch doc := any(doc).(type) {
+	case *model.BossJobDoc:
+		retrieved.Title = doc.JobName
+		if doc.BrandName != "" {
+			retrieved.Title += " - " + doc.BrandName
+		}
+		retrieved.Url = doc.DetailAddress
+	case *model.WebPageDoc:
+		retrieved.Title, retrieved.Url = doc.Title, doc.Url
+	}
+	return retrieved
+}
+
 func DuckDuckGoSearch(tool tool.InvokableTool, param *param.SearchConfig) *compose.Lambda {
 	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) (map[string]any, error) {
 		query, ok := state["query"].(string)
@@ -114,9 +275,10 @@ func DuckDuckGoSearch(tool tool.InvokableTool, param *param.SearchConfig) *compo
 		}
 		jsonReq, err := json.Marshal(searchReq)
 		if err != nil {
-			log.Fatalf("Marshal of search request failed, err=%v", err)
+			return nil, fmt.Errorf("Marshal of search request failed, err=%w", err)
 		}
 		results := make([]*duckduckgo.TextSearchResult, 0, param.MaxResults)
+		start := time.Now()
 		resp, err := tool.InvokableRun(ctx, string(jsonReq))
 		if err != nil {
 			log.Printf("Invoke of duckduckgo failed, err=%v", err)
@@ -124,13 +286,17 @@ func DuckDuckGoSearch(tool tool.InvokableTool, param *param.SearchConfig) *compo
 		}
 		var searchResp duckduckgo.TextSearchResponse
 		if err = json.Unmarshal([]byte(resp), &searchResp); err != nil {
-			log.Fatalf("Unmarshal of search response failed, err=%v", err)
+			log.Printf("Unmarshal of search response failed, err=%v", err)
+			return nil, fmt.Errorf("Unmarshal of search response failed, err=%w", err)
 		}
 
 		results = append(results, searchResp.Results...)
 		var Builder strings.Builder
 		Builder.WriteString("参考文档(JSON格式):\n\n")
+		turn := stateTurn(state)
+		turn.Timing.WebSearchMs = time.Since(start).Milliseconds()
 		for i, result := range results {
+			turn.WebResults = append(turn.WebResults, result.URL)
 			Builder.WriteString(fmt.Sprintf("\n%d. Title: %s\n", i+1, result.Title))
 			Builder.WriteString(fmt.Sprintf("   URL: %s\n", result.URL))
 			Builder.WriteString(fmt.Sprintf("   Summary: %s\n", result.Summary))
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Memory 会话的存储,按会话ID读写
+type Memory interface {
+	// Load 读取会话,不存在时返回nil
+	Load(ctx context.Context, id string) (*model.SessionDoc, error)
+	Save(ctx context.Context, session *model.SessionDoc) error
+	Delete(ctx context.Context, id string) error
+	// List 返回全部会话,按最后更新时间从新到旧排序
+	List(ctx context.Context) ([]*model.SessionDoc, error)
+}
+
+// memory 进程内的会话存储,进程退出后会话丢失
+type memory struct {
+	mu       sync.Mutex
+	sessions map[string]*model.SessionDoc
+}
+
+func InitMemory() Memory {
+	return &memory{sessions: make(map[string]*model.SessionDoc)}
+}
+
+func (m *memory) Load(ctx context.Context, id string) (*model.SessionDoc, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	// 返回副本,调用方修改后通过Save写回
+	copied := *session
+	copied.Turns = append([]model.SessionTurn(nil), session.Turns...)
+	return &copied, nil
+}
+
+func (m *memory) Save(ctx context.Context, session *model.SessionDoc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.SessionId] = session
+	return nil
+}
+
+func (m *memory) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memory) List(ctx context.Context) ([]*model.SessionDoc, error) {
+	m.mu.Lock()
+	sessions := make([]*model.SessionDoc, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.Unlock()
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// storeMemory 保存在文档存储中的会话,按storage.backend保存到ES的agent_sessions索引或本地文件
+type storeMemory struct {
+	sessionStore store.Store[*model.SessionDoc]
+}
+
+// InitStoreMemory 使用文档存储保存会话,进程重启后可以继续之前的会话
+func InitStoreMemory(sessionStore store.Store[*model.SessionDoc]) Memory {
+	return &storeMemory{sessionStore: sessionStore}
+}
+
+func (m *storeMemory) Load(ctx context.Context, id string) (*model.SessionDoc, error) {
+	return m.sessionStore.Get(ctx, id)
+}
+
+// Save 写入会话后立即提交,下一轮对话读取时能看到本轮
+func (m *storeMemory) Save(ctx context.Context, session *model.SessionDoc) error {
+	if err := m.sessionStore.BulkPut(ctx, []*model.SessionDoc{session}); err != nil {
+		return err
+	}
+	return m.sessionStore.Flush(ctx)
+}
+
+func (m *storeMemory) Delete(ctx context.Context, id string) error {
+	return m.sessionStore.Delete(ctx, []string{id})
+}
+
+func (m *storeMemory) List(ctx context.Context) ([]*model.SessionDoc, error) {
+	sessions := make([]*model.SessionDoc, 0)
+	err := m.sessionStore.Scan(ctx, 100, func(docs []*model.SessionDoc) error {
+		sessions = append(sessions, docs...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取会话列表失败: %w", err)
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func sortSessions(sessions []*model.SessionDoc) {
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+}
+
+// historyMessages 将摘要和摘要之后的轮次转换为提示模板中history占位符的消息,出错的轮次没有回答,不放入对话记录
+func historyMessages(session *model.SessionDoc) []*schema.Message {
+	messages := make([]*schema.Message, 0, 2*len(session.Turns)+1)
+	if session.Summary != "" {
+		messages = append(messages, schema.SystemMessage("之前对话的摘要:\n"+session.Summary))
+	}
+	for _, turn := range session.Turns[min(session.Compacted, len(session.Turns)):] {
+		if turn.Error != "" {
+			continue
+		}
+		messages = append(messages, schema.UserMessage(turn.Query), schema.AssistantMessage(turn.Answer, nil))
+	}
+	return messages
+}
+
+// compactSession 摘要之后的轮次超过maxTurns时,由summarize把较早的轮次合并进摘要,只保留最近maxTurns轮在提示中;
+// 摘要失败时跳过较早的轮次并保留原摘要,保证提示中对话记录的长度有上限。全部轮次仍然保存在会话中
+func compactSession(ctx context.Context, session *model.SessionDoc, maxTurns int,
+	summarize func(ctx context.Context, messages []*schema.Message) (string, error)) {
+	compacted := min(session.Compacted, len(session.Turns))
+	if len(session.Turns)-compacted <= maxTurns {
+		return
+	}
+	keepFrom := len(session.Turns) - maxTurns
+	evicted := &model.SessionDoc{Summary: session.Summary, Turns: session.Turns[compacted:keepFrom]}
+	session.Compacted = keepFrom
+	summary, err := summarize(ctx, historyMessages(evicted))
+	if err != nil {
+		log.Printf("压缩会话 %s 的对话记录失败,跳过较早的 %d 轮对话: %v", session.SessionId, len(evicted.Turns), err)
+		return
+	}
+	session.Summary = summary
+}
+
+// stateTurn 取出本轮对话的记录,各节点把中间结果(改写后的问题、意图、检索到的文档等)写入其中
+func stateTurn(state map[string]any) *model.SessionTurn {
+	turn, ok := state["turn"].(*model.SessionTurn)
+	if !ok {
+		return &model.SessionTurn{}
+	}
+	return turn
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"github.com/LouYuanbo1/crawleragent/param"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+)
+
+// JobAgentParam 求职顾问智能体的提示模板和检索配置,知识库为boss_jobs岗位索引,命令行和HTTP服务共用
+func JobAgentParam() *param.Agent {
+	//定义搜索模式的提示模板
+	searchModePrompt := prompt.FromMessages(
+		schema.FString,
+		schema.SystemMessage(`
+
+		角色：你是一位专业的职业顾问，擅长根据用户背景和需求匹配合适的工作岗位，并能灵活利用知识库资源。
+
+		任务：根据用户提供的求职需求，结合ES知识库中的岗位信息，为用户推荐最匹配的工作岗位。当知识库中无相关结果时，转而推荐优质招聘平台。
+
+		输入信息：
+
+		用户需求：包括但不限于行业偏好、工作地点、薪资期望、工作经验、技能要求、学历背景等
+		ES知识库内容：从企业知识库中检索到的相关岗位信息（可能为空）
+		处理逻辑：
+
+		优先使用知识库：仔细分析Elasticsearch知识库返回的岗位数据，根据用户需求进行精准匹配
+		匹配维度：考虑岗位职责、任职要求、薪资范围、工作地点、发展空间等关键因素
+		知识库为空时：当知识库未返回任何相关岗位时，立即切换到推荐招聘网站模式
+		推荐原则：始终以用户需求为中心，提供实用、可操作的建议
+		输出格式：
+
+		当知识库有结果时：
+		【精准岗位推荐】
+		根据您的需求，为您推荐以下岗位：
+		🔹 [岗位名称] - [公司名称] [文档N]
+		• 工作地点：[地点]
+		• 薪资范围：[薪资]
+		• 核心要求：[2-3个关键要求]
+		• 网址：[参考文档中的detailAddress，原样复制]
+		• 匹配理由：[说明为何匹配用户需求]
+		💡 建议：[1-2条具体求职建议]
+
+		当知识库为空时：
+		【招聘平台推荐】
+		不要编造任何数据,不要进行任何假设。
+		直接回答:当前知识库中暂无完全匹配的岗位，建议您通过以下专业招聘平台自主搜索：
+		综合类平台：
+		• 智联招聘（www.zhaopin.com）- 覆盖全行业，岗位数量丰富
+		• 前程无忧（www.51job.com）- 企业质量高，适合中高端求职
+		垂直类平台：
+		• 拉勾网（www.lagou.com）- 专注互联网/科技行业
+		• 猎聘（www.liepin.com）- 高端职位和猎头服务
+		新兴平台：
+		• BOSS直聘（www.zhipin.com）- 直接与招聘方沟通，效率高
+		• 脉脉（www.maimai.cn）- 职场社交+内推机会
+		💡 使用建议：建议在搜索时使用关键词组合（如"行业+职位+地点"），并完善个人简历以提高匹配度。
+		注意事项：
+
+		保持推荐的专业性和实用性
+		避免推荐明显不匹配的岗位
+		当知识库结果较少时，可适当补充招聘网站建议
+		用简洁清晰的语言表达，避免过于技术化的术语
+		始终以帮助用户成功求职为目标
+		`),
+		schema.SystemMessage(`以下是根据您的查询检索到的相关岗位信息：\n{referenceDocs}\n\n只能推荐参考文档中的岗位,每个岗位都必须在岗位名称后标注参考文档的编号,如[文档1];网址必须原样使用参考文档中的detailAddress,不要编造或添加任何额外信息。如果知识库为空,则直接回答:当前知识库中暂无完全匹配的岗位。`),
+		//之前的对话记录(较早轮次的摘要和最近几轮对话),用于回答追问
+		schema.MessagesPlaceholder("history", true),
+		schema.UserMessage("{query}"),
+	)
+
+	//定义聊天模式的提示模板
+	chatModePrompt := prompt.FromMessages(
+		schema.FString,
+		schema.SystemMessage(`
+		角色：你是一个专业的职业顾问，擅长根据用户背景和需求匹配合适的工作岗位，并于用户交流职业规划，倾听用户求助时的烦恼，提供专业的建议并鼓励用户。
+		任务：与用户进行互动，倾听用户的问题、需求和建议，根据用户的背景和需求提供专业的职业规划建议。
+		`),
+		schema.SystemMessage(`以下是根据您经过网络查询得到的信息：\n{duckDuckGoResults}\n\n请结合这些信息回答用户的请求。`),
+		//之前的对话记录(较早轮次的摘要和最近几轮对话),用于回答追问
+		schema.MessagesPlaceholder("history", true),
+		schema.UserMessage("{query}"),
+	)
+
+	//定义混合模式的提示模板,同时使用知识库和网络搜索的结果
+	hybridModePrompt := prompt.FromMessages(
+		schema.FString,
+		schema.SystemMessage(`
+		角色：你是一位专业的职业顾问，擅长根据用户背景和需求匹配合适的工作岗位，并结合行业动态给出建议。
+		任务：优先根据知识库中的岗位信息为用户推荐岗位，再结合网络查询得到的信息补充公司背景、行业动态等内容。
+		知识库中的岗位信息必须如实展示，不要编造，每个岗位都在岗位名称后标注参考文档的编号，如[文档1]，网址原样使用参考文档中的detailAddress；
+		网络信息只作为补充，并说明来源网址。
+		`),
+		schema.SystemMessage(`以下是根据您的查询检索到的相关岗位信息：\n{referenceDocs}\n\n以下是网络查询得到的信息：\n{duckDuckGoResults}`),
+		//之前的对话记录(较早轮次的摘要和最近几轮对话),用于回答追问
+		schema.MessagesPlaceholder("history", true),
+		schema.UserMessage("{query}"),
+	)
+
+	return &param.Agent{
+		Prompt: map[param.PromptType]*prompt.DefaultChatTemplate{
+			param.PromptEsRAGMode:  searchModePrompt,
+			param.PromptChatMode:   chatModePrompt,
+			param.PromptHybridMode: hybridModePrompt,
+		},
+		//意图识别失败时查询知识库,知识库是智能体的主要信息来源
+		DefaultIntent: string(IntentKnowledgeBase),
+		//全文检索的字段需要是text类型,城市等keyword字段只能整体匹配,不放在这里
+		Retrieval: param.Retrieval{
+			TextFields: []string{"jobName^3", "skills^2", "jobLabels", "brandName", "welfareList", "detailAddress"},
+			//从"北京 20K以上 3-5年经验的Go岗位"这样的请求中抽取城市、薪资等条件过滤岗位
+			ExtractFilters: true,
+		},
+	}
+}
+
+// Boss直聘岗位搜索页和岗位列表接口,与cmd/browserparallel一致
+const (
+	BossJobsUrlTemplate = "https://www.zhipin.com/web/geek/jobs?city={city}&query={query}"
+	BossJobListPattern  = "https://www.zhipin.com/wapi/zpgeek/search/joblist.json*"
+)
+
+// BossCrawlTemplate Boss直聘的按需爬取模板: 打开岗位搜索页滚动加载,listener监听岗位列表接口,
+// 监听到的响应需要由调用方消费并写入boss_jobs(如ParallelService.ProcessRespChanWithIndexDocs)
+func BossCrawlTemplate(listener *param.ListenerConfig) *param.CrawlTemplate {
+	return &param.CrawlTemplate{
+		Name:        "boss",
+		Description: "Boss直聘岗位搜索",
+		UrlTemplate: BossJobsUrlTemplate,
+		Cities:      param.BossCities,
+		DefaultCity: param.BossCities["全国"],
+		Operation: param.UrlOperation{
+			OperationType: param.OperationScroll,
+			//按需爬取时用户在等待,只滚动3次
+			NumActions:           3,
+			StandardSleepSeconds: 1,
+			RandomDelaySeconds:   1,
+			ListenerConfig:       listener,
+		},
+	}
+}
+
+// WebAgentParam 网页问答智能体的提示模板和检索配置,知识库为web_pages网页索引,配合doc_chunks分块检索使用
+func WebAgentParam() *param.Agent {
+	//定义搜索模式的提示模板
+	searchModePrompt := prompt.FromMessages(
+		schema.FString,
+		schema.SystemMessage(`
+		角色：你是一个知识库问答助手，根据从网页知识库中检索到的文章回答用户的问题。
+		要求：
+		只根据参考文档回答，不要编造文档中没有的内容；参考文档不足以回答时，直接说明知识库中没有相关内容。
+		回答时在相关内容后标注参考文档的编号，如[文档1]，需要给出网址时原样使用参考文档中的url。
+		用简洁清晰的语言表达。
+		`),
+		schema.SystemMessage(`以下是根据您的查询检索到的相关文章：\n{referenceDocs}`),
+		//之前的对话记录(较早轮次的摘要和最近几轮对话),用于回答追问
+		schema.MessagesPlaceholder("history", true),
+		schema.UserMessage("{query}"),
+	)
+
+	//定义聊天模式的提示模板
+	chatModePrompt := prompt.FromMessages(
+		schema.FString,
+		schema.SystemMessage(`
+		角色：你是一个知识渊博的助手，与用户交流并回答用户的问题。
+		`),
+		schema.SystemMessage(`以下是根据您经过网络查询得到的信息：\n{duckDuckGoResults}\n\n请结合这些信息回答用户的请求，并说明来源网址。`),
+		//之前的对话记录(较早轮次的摘要和最近几轮对话),用于回答追问
+		schema.MessagesPlaceholder("history", true),
+		schema.UserMessage("{query}"),
+	)
+
+	//定义混合模式的提示模板,同时使用知识库和网络搜索的结果
+	hybridModePrompt := prompt.FromMessages(
+		schema.FString,
+		schema.SystemMessage(`
+		角色：你是一个知识库问答助手，优先根据网页知识库中的文章回答用户的问题，再结合网络查询得到的信息补充。
+		知识库中的内容必须如实引用，不要编造，在相关内容后标注参考文档的编号，如[文档1]；网络信息只作为补充，并说明来源网址。
+		`),
+		schema.SystemMessage(`以下是根据您的查询检索到的相关文章：\n{referenceDocs}\n\n以下是网络查询得到的信息：\n{duckDuckGoResults}`),
+		//之前的对话记录(较早轮次的摘要和最近几轮对话),用于回答追问
+		schema.MessagesPlaceholder("history", true),
+		schema.UserMessage("{query}"),
+	)
+
+	return &param.Agent{
+		Prompt: map[param.PromptType]*prompt.DefaultChatTemplate{
+			param.PromptEsRAGMode:  searchModePrompt,
+			param.PromptChatMode:   chatModePrompt,
+			param.PromptHybridMode: hybridModePrompt,
+		},
+		//意图识别失败时查询知识库,知识库是智能体的主要信息来源
+		DefaultIntent: string(IntentKnowledgeBase),
+		//分块检索时全文检索分块的content字段,这里的字段只在不使用分块检索时生效
+		Retrieval: param.Retrieval{
+			TextFields: []string{"title^2", "content"},
+		},
+	}
+}
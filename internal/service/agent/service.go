@@ -6,64 +6,137 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/llm"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
 	"github.com/LouYuanbo1/crawleragent/param"
 
 	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent/react"
 	"github.com/cloudwego/eino/schema"
-	"github.com/elastic/go-elasticsearch/v9"
 )
 
+// ErrInvalidK Search请求的文档数超过检索配置的MaxK
+var ErrInvalidK = errors.New("k超出允许的范围")
+
 type State struct {
-	IndexName     string
-	TypedEsClient *elasticsearch.TypedClient
-	Embedder      embedding.Embedder
+	Embedder embedding.Embedder
+}
+
+// Request 一次对话请求
+type Request struct {
+	// SessionID 不为空时读取并保存会话的对话记录,SessionID相同的请求可以追问
+	SessionID string
+	Query     string
+	// History 调用方自己维护的对话记录(如OpenAI兼容接口请求中之前的消息),只在SessionID为空时使用,不会保存
+	History []*schema.Message
+}
+
+// Response 一轮对话的结果: 回答以及产生回答的上下文,包括意图和经过的节点、筛选条件、
+// 检索到的文档(ID、得分、标题和网址)、网络搜索结果和各阶段耗时,与会话中保存的轮次一致
+type Response struct {
+	SessionID string `json:"sessionId,omitempty"`
+	model.SessionTurn
 }
 
+// AgentService 智能体服务
 type AgentService[D model.Document] interface {
-	Stream(ctx context.Context, query string) error
-	Invoke(ctx context.Context, query string) error
+	// Stream 流式生成回答,模型输出的每个片段写入out(为nil时不写入),完整回答在返回的Response中;
+	// 出错时也返回已经生成的部分
+	Stream(ctx context.Context, req Request, out io.Writer) (*Response, error)
+	// Invoke 生成完整回答
+	Invoke(ctx context.Context, req Request) (*Response, error)
+	// Search 只检索知识库不生成回答,filters为nil且开启了筛选条件抽取时从query中抽取,k<=0时使用检索配置的K,
+	// k超过检索配置的MaxK时返回ErrInvalidK
+	Search(ctx context.Context, query string, k int, filters *QueryFilters) (*SearchResult[D], error)
+	// ListSessions 列出全部会话,按最后更新时间从新到旧排序
+	ListSessions(ctx context.Context) ([]*model.SessionDoc, error)
+	// GetSession 获取会话的全部轮次及每轮的检索上下文,不存在时返回nil;用同一个sessionID继续提问即可恢复会话
+	GetSession(ctx context.Context, sessionID string) (*model.SessionDoc, error)
+	DeleteSession(ctx context.Context, sessionID string) error
 }
 
 type agentService[D model.Document] struct {
-	llm      llm.LLM
-	es       es.TypedEsClient[D]
-	embedder embedding.Embedder
-	graph    compose.Runnable[map[string]any, map[string]any]
+	llm       llm.LLM
+	docStore  store.Store[D]
+	embedder  embedding.Embedder
+	graph     compose.Runnable[map[string]any, map[string]any]
+	memory    Memory
+	memoryCfg param.Memory
+	summarize func(ctx context.Context, messages []*schema.Message) (string, error)
+	// retrievalCfg和extractFilters用于只检索的Search
+	retrievalCfg   param.Retrieval
+	extractFilters func(ctx context.Context, query string) (*QueryFilters, error)
+	// citationMode 回答的引用校验方式,见param.Citation
+	citationMode string
+	// sessionLocks 会话ID到会话锁,同一会话的对话从读取到保存串行执行,避免并发请求互相覆盖轮次;
+	// 只保存正在使用的锁,最后一个持有或等待的请求解锁时移除,会话ID由客户端指定,不能无限增长
+	locksMu      sync.Mutex
+	sessionLocks map[string]*sessionLock
 }
 
+// InitAgentService 初始化智能体服务,chunkStore不为nil时使用分块检索并聚合回原文档,
+// memory为nil时会话保存在进程内存中,需要持久化时使用InitStoreMemory
 func InitAgentService[D model.Document](
 	ctx context.Context,
 	llm llm.LLM,
-	es es.TypedEsClient[D],
+	docStore store.Store[D],
+	chunkStore store.Store[*model.ChunkDoc],
 	embedder embedding.Embedder,
+	memory Memory,
 	param *param.Agent,
 ) (AgentService[D], error) {
-	graph, err := initAgentGraph(ctx, llm, es, embedder, param)
+	// 开启筛选条件抽取时,查询理解节点和只检索的Search共用同一个抽取函数
+	var extractFilters func(ctx context.Context, query string) (*QueryFilters, error)
+	if param.Retrieval.ExtractFilters {
+		extractor, err := llm.StructuredModel(ctx, FilterFormat)
+		if err != nil {
+			return nil, err
+		}
+		extractFilters = FilterExtractor(extractor, param.Retrieval.FilterPrompt)
+	}
+	graph, err := initAgentGraph(ctx, llm, docStore, chunkStore, embedder, extractFilters, param)
 	if err != nil {
 		return nil, fmt.Errorf("创建流程图失败: %w", err)
 	}
-	return &agentService[D]{llm: llm, es: es, embedder: embedder, graph: graph}, nil
+	if memory == nil {
+		memory = InitMemory()
+	}
+	memoryCfg := memoryConfig(param.Memory)
+	return &agentService[D]{
+		llm:            llm,
+		docStore:       docStore,
+		embedder:       embedder,
+		graph:          graph,
+		memory:         memory,
+		memoryCfg:      memoryCfg,
+		summarize:      Summarizer(llm.Model(), memoryCfg),
+		retrievalCfg:   param.Retrieval,
+		extractFilters: extractFilters,
+		citationMode:   citationMode(param.Citation.Mode),
+		sessionLocks:   make(map[string]*sessionLock),
+	}, nil
 }
 
 // InitAgent 初始化AgentClient,根据options配置模型和节点
 func initAgentGraph[D model.Document](
 	ctx context.Context,
 	llm llm.LLM,
-	typedEsClient es.TypedEsClient[D],
+	docStore store.Store[D],
+	chunkStore store.Store[*model.ChunkDoc],
 	embedder embedding.Embedder,
+	extractFilters func(ctx context.Context, query string) (*QueryFilters, error),
 	param *param.Agent,
 ) (compose.Runnable[map[string]any, map[string]any], error) {
-	// 生成State,包含索引名称, TypedEsClient, Embedder 等状态信息
+	// 生成State,包含Embedder等状态信息
 	genState := func(ctx context.Context) *State {
 		return &State{
-			IndexName:     param.IndexName,
-			TypedEsClient: typedEsClient.GetClient(),
-			Embedder:      embedder,
+			Embedder: embedder,
 		}
 	}
 
@@ -76,15 +149,44 @@ func initAgentGraph[D model.Document](
 
 	// 初始化Compose图,设置全局状态生成函数
 	graph := compose.NewGraph[map[string]any, map[string]any](compose.WithGenLocalState(genState))
-	// 添加意图检测节点,用于识别用户查询的意图,当用户输入以查询模式或搜索模式开头时,将意图设置为"retriever",
-	// 使用爬取的信息做RAG增强
-	err = graph.AddLambdaNode("intentDetection", IntentDetection())
+	// 添加追问改写节点,有对话记录时把追问改写为独立的问题
+	memoryCfg := memoryConfig(param.Memory)
+	err = graph.AddLambdaNode("queryRewrite", QueryRewrite(llm.Model(), memoryCfg.RewritePrompt))
+	if err != nil {
+		log.Printf("Error adding lambda node: %v", err)
+		return nil, err
+	}
+	// 添加意图识别节点,由模型判断请求需要知识库、网络搜索、两者都需要还是都不需要,
+	// 请求以"查询模式"等前缀开头时直接使用前缀对应的意图
+	router, err := llm.StructuredModel(ctx, IntentFormat)
+	if err != nil {
+		return nil, err
+	}
+	hybridPrompt, hybrid := param.Prompt["HybridMode"]
+	hybrid = hybrid && hybridPrompt != nil
+	// 模型判断失败时使用智能体配置的默认路由
+	defaultIntent, err := ParseIntent(param.DefaultIntent, IntentKnowledgeBase)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultIntent配置错误: %w", err)
+	}
+	err = graph.AddLambdaNode("intentDetection", IntentDetection(router, param.IntentPrompt, defaultIntent, hybrid))
+	if err != nil {
+		log.Printf("Error adding lambda node: %v", err)
+		return nil, err
+	}
+	// 添加查询理解节点,从请求中抽取城市、薪资等筛选条件,未开启时直接进入检索节点
+	err = graph.AddLambdaNode("queryUnderstanding", QueryUnderstanding(extractFilters))
 	if err != nil {
 		log.Printf("Error adding lambda node: %v", err)
 		return nil, err
 	}
 	// 添加检索节点,用于根据用户查询意图,从索引中检索相关文档
-	err = graph.AddLambdaNode("retriever", Retriever())
+	// 配置了分块存储时,使用分块检索并聚合回原文档
+	retriever := Retriever(docStore, param.Retrieval)
+	if chunkStore != nil {
+		retriever = ChunkRetriever(docStore, chunkStore, param.Retrieval)
+	}
+	err = graph.AddLambdaNode("retriever", retriever)
 	if err != nil {
 		log.Printf("Error adding lambda node: %v", err)
 		return nil, err
@@ -109,42 +211,86 @@ func initAgentGraph[D model.Document](
 		return nil, err
 	}
 
+	// 添加混合模式提示节点,同时使用知识库和网络搜索的结果
+	if hybrid {
+		err = graph.AddChatTemplateNode("hybridModePrompt", hybridPrompt)
+		if err != nil {
+			log.Printf("Error adding prompt template node: %v", err)
+			return nil, err
+		}
+	}
+
 	err = graph.AddChatModelNode("llm", llm.Model(), compose.WithOutputKey("finalResponse"))
 	if err != nil {
 		log.Printf("Error adding LLM node: %v", err)
 		return nil, err
 	}
 
-	err = graph.AddEdge(compose.START, "intentDetection")
+	err = graph.AddEdge(compose.START, "queryRewrite")
+	if err != nil {
+		log.Printf("Error adding edge: %v", err)
+		return nil, err
+	}
+
+	err = graph.AddEdge("queryRewrite", "intentDetection")
 	if err != nil {
 		log.Printf("Error adding edge: %v", err)
 		return nil, err
 	}
 
 	err = graph.AddBranch("intentDetection", compose.NewGraphBranch(BranchCondition, map[string]bool{
-		"retriever":        true,
-		"duckDuckGoSearch": true,
+		"queryUnderstanding": true,
+		"duckDuckGoSearch":   true,
+		"chatModePrompt":     true,
 	}))
 	if err != nil {
 		log.Printf("Error adding branch: %v", err)
 		return nil, err
 	}
 
-	err = graph.AddEdge("retriever", "searchModePrompt")
+	err = graph.AddEdge("queryUnderstanding", "retriever")
 	if err != nil {
 		log.Printf("Error adding edge: %v", err)
 		return nil, err
 	}
 
+	// 开启工具调用模式时,检索后按配置进入工具调用模式,由模型多轮调用检索、获取文档和爬取工具后回答
+	afterRetriever := map[string]bool{
+		"searchModePrompt": true,
+		"duckDuckGoSearch": true,
+	}
+	afterRetrieverCondition := AfterRetrieverCondition
+	if mode := toolsMode(param.Tools.Mode); mode != toolsOff {
+		if err = addToolAgentNodes(ctx, graph, llm, docStore, embedder, param); err != nil {
+			return nil, err
+		}
+		afterRetriever["toolAgentInput"] = true
+		afterRetrieverCondition = ToolAgentCondition(mode)
+	}
+	err = graph.AddBranch("retriever", compose.NewGraphBranch(afterRetrieverCondition, afterRetriever))
+	if err != nil {
+		log.Printf("Error adding branch: %v", err)
+		return nil, err
+	}
+
 	err = graph.AddEdge("searchModePrompt", "llm")
 	if err != nil {
 		log.Printf("Error adding edge: %v", err)
 		return nil, err
 	}
 
-	err = graph.AddEdge("duckDuckGoSearch", "chatModePrompt")
+	afterSearch := map[string]bool{"chatModePrompt": true}
+	if hybrid {
+		afterSearch["hybridModePrompt"] = true
+		err = graph.AddEdge("hybridModePrompt", "llm")
+		if err != nil {
+			log.Printf("Error adding edge: %v", err)
+			return nil, err
+		}
+	}
+	err = graph.AddBranch("duckDuckGoSearch", compose.NewGraphBranch(AfterSearchCondition, afterSearch))
 	if err != nil {
-		log.Printf("Error adding edge: %v", err)
+		log.Printf("Error adding branch: %v", err)
 		return nil, err
 	}
 
@@ -160,52 +306,266 @@ func initAgentGraph[D model.Document](
 		return nil, err
 	}
 
-	compiledGraph, _ := graph.Compile(ctx)
+	compiledGraph, err := graph.Compile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("编译流程图失败: %w", err)
+	}
 	return compiledGraph, nil
 
 }
 
-func (as *agentService[D]) Invoke(ctx context.Context, query string) error {
-	result, err := as.graph.Invoke(ctx, map[string]any{
-		"query": query,
+// addToolAgentNodes 添加工具调用模式的节点: toolAgentInput生成消息,toolAgent为ReAct智能体的子图,
+// 输出的最终回答与llm节点一样写入"finalResponse"
+func addToolAgentNodes[D model.Document](
+	ctx context.Context,
+	graph *compose.Graph[map[string]any, map[string]any],
+	llm llm.LLM,
+	docStore store.Store[D],
+	embedder embedding.Embedder,
+	param *param.Agent,
+) error {
+	tools, err := agentTools(docStore, embedder, param.Retrieval, param.Tools)
+	if err != nil {
+		return err
+	}
+	maxStep := param.Tools.MaxStep
+	if maxStep <= 0 {
+		maxStep = 12
+	}
+	agent, err := react.NewAgent(ctx, &react.AgentConfig{
+		ToolCallingModel: llm.Model(),
+		// 工具依次执行,调用过程和检索到的文档按顺序记录到本轮记录中
+		ToolsConfig:           compose.ToolsNodeConfig{Tools: tools, ExecuteSequentially: true},
+		MaxStep:               maxStep,
+		StreamToolCallChecker: toolCallChecker,
 	})
 	if err != nil {
-		log.Printf("Failed to invoke graph: %v", err)
+		return fmt.Errorf("创建工具调用智能体失败: %w", err)
+	}
+	systemPrompt := param.Tools.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = DefaultToolAgentPrompt
+	}
+	err = graph.AddLambdaNode("toolAgentInput", ToolAgentInput(systemPrompt))
+	if err != nil {
+		log.Printf("Error adding lambda node: %v", err)
+		return err
+	}
+	subGraph, opts := agent.ExportGraph()
+	err = graph.AddGraphNode("toolAgent", subGraph, append(opts, compose.WithOutputKey("finalResponse"))...)
+	if err != nil {
+		log.Printf("Error adding graph node: %v", err)
+		return err
+	}
+	err = graph.AddEdge("toolAgentInput", "toolAgent")
+	if err != nil {
+		log.Printf("Error adding edge: %v", err)
+		return err
+	}
+	err = graph.AddEdge("toolAgent", compose.END)
+	if err != nil {
+		log.Printf("Error adding edge: %v", err)
 		return err
 	}
+	return nil
+}
 
-	// 从结果中提取最终回复
-	if finalResponse, ok := result["finalResponse"].(*schema.Message); ok {
-		fmt.Println(finalResponse.Content)
-		return nil
+// sessionLock 会话锁,refs为持有和等待该锁的请求数
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockSession 锁定会话直到返回的函数被调用,SessionID为空(不保存会话)时不加锁
+// 引用计数在locksMu下增减,等待中的请求仍持有引用,所以与新请求拿到的是同一个锁
+func (as *agentService[D]) lockSession(sessionID string) (unlock func()) {
+	if sessionID == "" {
+		return func() {}
+	}
+	as.locksMu.Lock()
+	lock, ok := as.sessionLocks[sessionID]
+	if !ok {
+		lock = &sessionLock{}
+		as.sessionLocks[sessionID] = lock
 	}
+	lock.refs++
+	as.locksMu.Unlock()
 
-	fmt.Println("抱歉，我无法理解您的请求。")
-	return nil
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		as.locksMu.Lock()
+		defer as.locksMu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(as.sessionLocks, sessionID)
+		}
+	}
 }
 
-func (as *agentService[D]) Stream(ctx context.Context, query string) error {
-	result, err := as.graph.Stream(ctx, map[string]any{
-		"query": query,
-	})
+// loadSession 读取会话,生成流程图的输入,state["turn"]用于记录本轮的检索上下文;
+// SessionID为空时返回nil会话,使用请求中的对话记录,不保存
+func (as *agentService[D]) loadSession(ctx context.Context, req Request) (*model.SessionDoc, map[string]any, error) {
+	sessionID, query := req.SessionID, req.Query
+	turn := &model.SessionTurn{Query: query, Time: time.Now()}
+	input := map[string]any{"query": query, "turn": turn}
+	if sessionID == "" {
+		if len(req.History) > 0 {
+			//与会话记录一样只保留最近MaxTurns轮
+			input["history"] = req.History[max(len(req.History)-2*as.memoryCfg.MaxTurns, 0):]
+		}
+		return nil, input, nil
+	}
+	session, err := as.memory.Load(ctx, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取会话 %s 失败: %w", sessionID, err)
+	}
+	if session == nil {
+		session = &model.SessionDoc{SessionId: sessionID, Title: query, Created: turn.Time}
+	}
+	input["history"] = historyMessages(session)
+	return session, input, nil
+}
+
+// finishTurn 结束一轮对话,记录回答、错误和总耗时,返回本轮的结果;
+// 有会话时保存到会话中,超过轮数上限时压缩较早的轮次,保存失败只记录日志,不影响本次回答
+func (as *agentService[D]) finishTurn(ctx context.Context, session *model.SessionDoc, input map[string]any, answer string, runErr error) *Response {
+	turn := stateTurn(input)
+	turn.Answer = answer
+	if runErr != nil {
+		turn.Error = runErr.Error()
+	}
+	turn.Timing.TotalMs = time.Since(turn.Time).Milliseconds()
+	resp := &Response{SessionTurn: *turn}
+	if session == nil {
+		return resp
+	}
+	resp.SessionID = session.SessionId
+	session.Turns = append(session.Turns, *turn)
+	session.Updated = time.Now()
+	compactSession(ctx, session, as.memoryCfg.MaxTurns, as.summarize)
+	if err := as.memory.Save(ctx, session); err != nil {
+		log.Printf("保存会话 %s 失败: %v", session.SessionId, err)
+	}
+	return resp
+}
+
+func (as *agentService[D]) ListSessions(ctx context.Context) ([]*model.SessionDoc, error) {
+	return as.memory.List(ctx)
+}
+
+func (as *agentService[D]) GetSession(ctx context.Context, sessionID string) (*model.SessionDoc, error) {
+	return as.memory.Load(ctx, sessionID)
+}
+
+// DeleteSession 等待进行中的对话保存后再删除,避免删除后又被保存
+func (as *agentService[D]) DeleteSession(ctx context.Context, sessionID string) error {
+	defer as.lockSession(sessionID)()
+	return as.memory.Delete(ctx, sessionID)
+}
+
+// SearchResult 只检索的结果
+type SearchResult[D model.Document] struct {
+	Hits []store.Hit[D]
+	// Filters 检索使用的筛选条件,Relaxed为true表示按条件没有检索到文档,结果是去掉条件后检索的
+	Filters *QueryFilters
+	Relaxed bool
+}
+
+func (as *agentService[D]) Search(ctx context.Context, query string, k int, filters *QueryFilters) (*SearchResult[D], error) {
+	if k <= 0 {
+		k = retrievalK(as.retrievalCfg)
+	}
+	// 混合检索的候选数不小于k,不限制时一个请求就可以让ES检索大量候选
+	if maxK := maxSearchK(as.retrievalCfg); k > maxK {
+		return nil, fmt.Errorf("%w: 最多返回 %d 个文档", ErrInvalidK, maxK)
+	}
+	if filters == nil && as.extractFilters != nil {
+		extracted, err := as.extractFilters(ctx, query)
+		if err != nil {
+			log.Printf("抽取筛选条件失败,不带条件检索: %v", err)
+		}
+		filters = extracted
+	}
+	embeddings, err := as.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("生成查询向量失败: %w", err)
+	}
+	hits, relaxed, err := retrieve(ctx, as.docStore, as.retrievalCfg, query, embeddings[0], k, filters)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResult[D]{Hits: hits, Filters: filters, Relaxed: relaxed}, nil
+}
+
+func (as *agentService[D]) Invoke(ctx context.Context, req Request) (*Response, error) {
+	defer as.lockSession(req.SessionID)()
+	session, input, err := as.loadSession(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// 工具调用模式的工具通过上下文记录本轮检索到的文档
+	result, err := as.graph.Invoke(withTurn(ctx, stateTurn(input)), input)
 	if err != nil {
 		log.Printf("Failed to invoke graph: %v", err)
-		return err
+		return as.finishTurn(ctx, session, input, "", err), err
 	}
 
+	// 从结果中提取最终回复
+	finalResponse, ok := result["finalResponse"].(*schema.Message)
+	if !ok {
+		return as.finishTurn(ctx, session, input, "抱歉，我无法理解您的请求。", nil), nil
+	}
+	// 校验回答中引用的文档编号和网址,编造的岗位按配置标注或删除
+	answer, _ := as.verifyAnswer(stateTurn(input), finalResponse.Content)
+	return as.finishTurn(ctx, session, input, answer, nil), nil
+}
+
+func (as *agentService[D]) Stream(ctx context.Context, req Request, out io.Writer) (*Response, error) {
+	defer as.lockSession(req.SessionID)()
+	session, input, err := as.loadSession(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	result, err := as.graph.Stream(withTurn(ctx, stateTurn(input)), input)
+	if err != nil {
+		log.Printf("Failed to invoke graph: %v", err)
+		return as.finishTurn(ctx, session, input, "", err), err
+	}
+	defer result.Close()
+
+	turn := stateTurn(input)
+	var answer strings.Builder
 	for {
 		chunk, err := result.Recv()
 		if errors.Is(err, io.EOF) {
-			fmt.Printf("\n\n")
 			break
 		}
 		if err != nil {
 			log.Printf("Error receiving chunk: %v", err)
-			return err
+			return as.finishTurn(ctx, session, input, answer.String(), err), err
+		}
+		msg, ok := chunk["finalResponse"].(*schema.Message)
+		if !ok || msg.Content == "" {
+			continue
+		}
+		if answer.Len() == 0 {
+			turn.Timing.FirstTokenMs = time.Since(turn.Time).Milliseconds()
 		}
-		if msg, ok := chunk["finalResponse"].(*schema.Message); ok {
-			fmt.Print(msg.Content)
+		answer.WriteString(msg.Content)
+		if out == nil {
+			continue
+		}
+		// 写入失败(如HTTP客户端断开)时停止生成,已生成的部分仍然保存到会话中
+		if _, err := io.WriteString(out, msg.Content); err != nil {
+			return as.finishTurn(ctx, session, input, answer.String(), err), err
 		}
 	}
-	return nil
+	// 已经输出的片段无法修改,有无效引用时在末尾补充提示,返回和保存的回答按配置标注或删除
+	checked, note := as.verifyAnswer(turn, answer.String())
+	if note != "" && out != nil {
+		if _, err := io.WriteString(out, "\n\n"+note); err != nil {
+			return as.finishTurn(ctx, session, input, checked, err), err
+		}
+	}
+	return as.finishTurn(ctx, session, input, checked, nil), nil
 }
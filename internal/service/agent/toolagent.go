@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	"github.com/LouYuanbo1/crawleragent/param"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 工具调用模式的使用时机,见param.Tools
+const (
+	toolsOff      = "off"
+	toolsFallback = "fallback"
+	toolsAlways   = "always"
+)
+
+// 工具名称
+const (
+	toolSearch       = "search_knowledge_base"
+	toolGetDocuments = "get_documents"
+	toolCrawl        = "crawl_site"
+)
+
+const (
+	// toolResultMaxChars 会话中记录的工具结果的最大字数,返回给模型的结果不截断
+	toolResultMaxChars = 500
+	// crawlSettleInterval 爬取结束后检查文档数是否稳定的间隔
+	crawlSettleInterval = 2 * time.Second
+)
+
+// DefaultToolAgentPrompt 工具调用模式的默认系统提示
+const DefaultToolAgentPrompt = `你是一位专业的职业顾问,可以调用工具查询知识库和爬取招聘网站,根据工具返回的真实数据为用户推荐岗位。
+工作方式:
+1. 用户消息中附有知识库的初步检索结果,满足需求时直接回答
+2. 结果为空或不满足条件时,先用search_knowledge_base换用其他关键词或筛选条件检索
+3. 知识库中仍然没有合适的岗位时,用crawl_site爬取招聘网站上的最新岗位,爬取完成后再用search_knowledge_base检索新写入的数据
+4. 需要岗位的完整信息时用get_documents按ID获取
+5. 同样的爬取不要重复调用,爬取失败或超时时如实告诉用户
+回答要求:
+- 只推荐工具返回的岗位,不要编造岗位、公司、薪资和网址
+- 每个岗位按"🔹 岗位名称 - 公司名称 [文档N]"开头,下面用"• 字段: 内容"列出工作地点、薪资、核心要求和网址,网址原样复制文档中的detailAddress或url
+- 说明数据是否来自刚刚爬取的结果,最后给出1-2条求职建议`
+
+// toolsMode 工具调用模式的使用时机,未配置或取值无效时不使用
+func toolsMode(mode string) string {
+	switch mode {
+	case toolsFallback, toolsAlways:
+		return mode
+	default:
+		return toolsOff
+	}
+}
+
+// turnKey 上下文中本轮对话记录的键。工具在工具调用模式的子图中执行,读不到主图的状态,
+// 检索到的文档和调用过程通过上下文中的本轮记录保存,供引用校验和会话回顾使用
+type turnKey struct{}
+
+func withTurn(ctx context.Context, turn *model.SessionTurn) context.Context {
+	return context.WithValue(ctx, turnKey{}, turn)
+}
+
+// contextTurn 返回上下文中的本轮记录,不在对话中调用时返回nil
+func contextTurn(ctx context.Context) *model.SessionTurn {
+	turn, _ := ctx.Value(turnKey{}).(*model.SessionTurn)
+	return turn
+}
+
+// ToolAgentCondition 开启工具调用模式时检索知识库后的分支: always模式下只需要知识库的请求都进入工具调用模式,
+// fallback模式下只在没有检索到文档或去掉了筛选条件时进入,其余与AfterRetrieverCondition相同
+func ToolAgentCondition(mode string) func(ctx context.Context, state map[string]any) (string, error) {
+	return func(ctx context.Context, state map[string]any) (string, error) {
+		next, err := AfterRetrieverCondition(ctx, state)
+		if err != nil || next != "searchModePrompt" {
+			return next, err
+		}
+		turn := stateTurn(state)
+		if mode == toolsAlways || len(turn.Documents) == 0 || turn.FiltersRelaxed {
+			return "toolAgentInput", nil
+		}
+		return next, nil
+	}
+}
+
+// ToolAgentInput 工具调用模式的输入节点: 系统提示、对话记录和附有初步检索结果的请求,
+// 初步检索到的文档已经按[文档N]编号,工具检索到的文档接着编号
+func ToolAgentInput(systemPrompt string) *compose.Lambda {
+	return compose.InvokableLambda(func(ctx context.Context, state map[string]any) ([]*schema.Message, error) {
+		query, ok := state["query"].(string)
+		if !ok {
+			return nil, errors.New("query not found in state")
+		}
+		messages := []*schema.Message{schema.SystemMessage(systemPrompt)}
+		if history, ok := state["history"].([]*schema.Message); ok {
+			messages = append(messages, history...)
+		}
+		turn := stateTurn(state)
+		turn.Route = toolRoute(turn.Route)
+
+		var builder strings.Builder
+		builder.WriteString(query)
+		builder.WriteString("\n\n知识库初步检索结果:\n")
+		if len(turn.Documents) == 0 {
+			builder.WriteString("没有检索到相关文档")
+		} else if referenceDocs, ok := state["referenceDocs"].(string); ok {
+			builder.WriteString(referenceDocs)
+		}
+		return append(messages, schema.UserMessage(builder.String())), nil
+	})
+}
+
+// toolRoute 进入工具调用模式时,用工具调用模式的节点替换路径中知识库模式的提示和模型节点
+func toolRoute(route []string) []string {
+	if i := slices.Index(route, "searchModePrompt"); i >= 0 {
+		route = route[:i]
+	}
+	return append(route, "toolAgentInput", "toolAgent")
+}
+
+// toolCallChecker 读完整个流式输出再判断是否有工具调用: ollama上的部分模型会先输出思考内容再输出工具调用,
+// 只看第一个片段会把工具调用误判为最终回答。代价是工具调用模式的回答要等模型输出完才开始流式返回
+func toolCallChecker(ctx context.Context, output *schema.StreamReader[*schema.Message]) (bool, error) {
+	defer output.Close()
+	found := false
+	for {
+		msg, err := output.Recv()
+		if errors.Is(err, io.EOF) {
+			return found, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if len(msg.ToolCalls) > 0 {
+			found = true
+		}
+	}
+}
+
+type searchToolInput struct {
+	Query string `json:"query" jsonschema_description:"检索的问题或关键词,如北京 Go后端开发"`
+	K     int    `json:"k,omitempty" jsonschema_description:"返回的文档数,默认5,最多10"`
+	// Filters 由模型直接给出,不再调用筛选条件抽取
+	Filters *QueryFilters `json:"filters,omitempty" jsonschema_description:"岗位筛选条件,条件之间为且的关系,不需要时不填"`
+}
+
+type getDocumentsInput struct {
+	Ids []string `json:"ids" jsonschema_description:"文档ID,即检索结果中的ID"`
+}
+
+type crawlToolInput struct {
+	Site    string `json:"site" jsonschema_description:"爬取的网站名称"`
+	Keyword string `json:"keyword" jsonschema_description:"在网站上搜索的关键词,如Golang"`
+	City    string `json:"city,omitempty" jsonschema_description:"城市名,不带市,不填时搜索全国"`
+}
+
+// agentTools 工具调用模式的工具: 检索知识库、按ID获取文档,配置了爬虫和网站模板时还有按需爬取
+func agentTools[D model.Document](docStore store.Store[D], embedder embedding.Embedder, cfg param.Retrieval, toolsCfg param.Tools) ([]tool.BaseTool, error) {
+	search, err := utils.InferTool(toolSearch,
+		"检索知识库中的文档,混合使用全文检索和向量检索;带筛选条件没有结果时自动去掉条件重新检索。返回的文档按[文档N]编号,回答时按编号引用",
+		func(ctx context.Context, input *searchToolInput) (string, error) {
+			k := input.K
+			if k <= 0 {
+				k = retrievalK(cfg)
+			}
+			k = min(k, 10)
+			embeddings, err := embedder.Embed(ctx, []string{input.Query})
+			if err != nil {
+				return "", fmt.Errorf("生成查询向量失败: %w", err)
+			}
+			hits, relaxed, err := retrieve(ctx, docStore, cfg, input.Query, embeddings[0], k, input.Filters)
+			if err != nil {
+				return "", err
+			}
+			if len(hits) == 0 {
+				return "知识库中没有相关文档", nil
+			}
+			var builder strings.Builder
+			if relaxed {
+				builder.WriteString(fmt.Sprintf("知识库中没有满足筛选条件(%s)的文档,以下为去掉条件后检索到的相近文档\n\n", input.Filters))
+			}
+			writeToolDocs(ctx, &builder, hits)
+			return builder.String(), nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("创建检索工具失败: %w", err)
+	}
+
+	getDocuments, err := utils.InferTool(toolGetDocuments,
+		"按ID获取知识库中文档的完整内容",
+		func(ctx context.Context, input *getDocumentsInput) (string, error) {
+			if len(input.Ids) == 0 {
+				return "", errors.New("ids不能为空")
+			}
+			docs, err := docStore.MGet(ctx, input.Ids)
+			if err != nil {
+				return "", err
+			}
+			hits := make([]store.Hit[D], 0, len(docs))
+			for _, doc := range docs {
+				hits = append(hits, store.Hit[D]{ID: doc.GetID(), Doc: doc})
+			}
+			var builder strings.Builder
+			if len(hits) < len(input.Ids) {
+				builder.WriteString(fmt.Sprintf("%d个ID在知识库中不存在\n\n", len(input.Ids)-len(hits)))
+			}
+			writeToolDocs(ctx, &builder, hits)
+			return builder.String(), nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("创建获取文档工具失败: %w", err)
+	}
+
+	tools := []tool.BaseTool{recordTool(toolSearch, search), recordTool(toolGetDocuments, getDocuments)}
+	if toolsCfg.Crawler == nil || len(toolsCfg.CrawlTemplates) == 0 {
+		return tools, nil
+	}
+	crawl, err := crawlTool(docStore, toolsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建爬取工具失败: %w", err)
+	}
+	return append(tools, recordTool(toolCrawl, crawl)), nil
+}
+
+// writeToolDocs 按检索节点的格式输出文档,文档记录到本轮的Documents中;
+// 已经记录过的文档沿用原来的编号,保证同一轮中[文档N]始终指向同一个文档
+func writeToolDocs[D model.Document](ctx context.Context, builder *strings.Builder, hits []store.Hit[D]) {
+	turn := contextTurn(ctx)
+	for i, hit := range hits {
+		number := i + 1
+		if turn != nil {
+			index := slices.IndexFunc(turn.Documents, func(doc model.RetrievedDoc) bool {
+				return doc.Id == hit.ID && doc.Index == hit.Doc.GetIndex()
+			})
+			if index < 0 {
+				turn.Documents = append(turn.Documents, retrievedDoc(hit.Doc, hit.ID, hit.Score))
+				index = len(turn.Documents) - 1
+			}
+			number = index + 1
+		}
+		builder.WriteString(fmt.Sprintf("%s ID: %s\n", citationLabel(number), hit.ID))
+		builder.WriteString(docSource(hit.Doc))
+		builder.WriteString("\n\n")
+	}
+}
+
+// recordedTool 记录每次调用到本轮的ToolCalls中;工具出错时把错误作为结果返回给模型,
+// 由模型换用其他参数或如实告诉用户,不中断整个流程图
+type recordedTool struct {
+	tool.InvokableTool
+	name string
+}
+
+func recordTool(name string, invokable tool.InvokableTool) tool.InvokableTool {
+	return &recordedTool{InvokableTool: invokable, name: name}
+}
+
+func (rt *recordedTool) InvokableRun(ctx context.Context, arguments string, opts ...tool.Option) (string, error) {
+	start := time.Now()
+	result, err := rt.InvokableTool.InvokableRun(ctx, arguments, opts...)
+	call := model.ToolCall{Name: rt.name, Arguments: arguments}
+	if err != nil {
+		log.Printf("工具 %s 调用失败: %v", rt.name, err)
+		call.Error = err.Error()
+		result = fmt.Sprintf("工具调用失败: %v", err)
+	}
+	call.Ms = time.Since(start).Milliseconds()
+	call.Result = result
+	if runes := []rune(result); len(runes) > toolResultMaxChars {
+		call.Result = string(runes[:toolResultMaxChars]) + "..."
+	}
+	if turn := contextTurn(ctx); turn != nil {
+		turn.ToolCalls = append(turn.ToolCalls, call)
+	}
+	return result, nil
+}
+
+// crawlJob 爬取队列中的一次爬取,done在爬取结束后收到爬虫返回的错误
+type crawlJob struct {
+	operation *param.UrlOperation
+	done      chan error
+}
+
+// crawlQueue 按需爬取的队列,浏览器池由所有会话共用,爬取逐个执行;
+// 爬取使用独立的上下文,请求超时或取消后仍然在后台完成,爬到的数据照常写入知识库
+type crawlQueue struct {
+	crawler param.Crawler
+	jobs    chan *crawlJob
+}
+
+func initCrawlQueue(crawler param.Crawler) *crawlQueue {
+	queue := &crawlQueue{crawler: crawler, jobs: make(chan *crawlJob, 8)}
+	go queue.run()
+	return queue
+}
+
+func (cq *crawlQueue) run() {
+	for job := range cq.jobs {
+		log.Printf("开始按需爬取: %s", job.operation.Url)
+		err := cq.crawler.PerformAllUrlOperations(context.Background(), []*param.UrlOperation{job.operation})
+		if err != nil {
+			log.Printf("按需爬取失败 (%s): %v", job.operation.Url, err)
+		}
+		job.done <- err
+	}
+}
+
+// enqueue 加入爬取队列,队列已满时返回错误
+func (cq *crawlQueue) enqueue(operation *param.UrlOperation) (<-chan error, error) {
+	job := &crawlJob{operation: operation, done: make(chan error, 1)}
+	select {
+	case cq.jobs <- job:
+		return job.done, nil
+	default:
+		return nil, errors.New("爬取队列已满,请稍后再试")
+	}
+}
+
+// crawlTool 按网站模板生成爬取操作加入爬取队列,等待爬取完成且新数据写入知识库后返回文档数的变化
+func crawlTool[D model.Document](docStore store.Store[D], toolsCfg param.Tools) (tool.InvokableTool, error) {
+	timeout := toolsCfg.CrawlTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Minute
+	}
+	templates := make(map[string]*param.CrawlTemplate, len(toolsCfg.CrawlTemplates))
+	var sites []string
+	for _, template := range toolsCfg.CrawlTemplates {
+		templates[template.Name] = template
+		cities := make([]string, 0, len(template.Cities))
+		for city := range template.Cities {
+			cities = append(cities, city)
+		}
+		slices.Sort(cities)
+		sites = append(sites, fmt.Sprintf("%s(%s,支持的城市: %s)", template.Name, template.Description, strings.Join(cities, "、")))
+	}
+	queue := initCrawlQueue(toolsCfg.Crawler)
+
+	return utils.InferTool(toolCrawl,
+		fmt.Sprintf("在招聘网站上按关键词和城市爬取最新数据并写入知识库,耗时较长,知识库中没有合适结果时才使用。可爬取的网站: %s", strings.Join(sites, "; ")),
+		func(ctx context.Context, input *crawlToolInput) (string, error) {
+			template, ok := templates[input.Site]
+			if !ok {
+				return "", fmt.Errorf("不支持的网站: %s", input.Site)
+			}
+			operation, err := template.UrlOperation(input.Keyword, input.City)
+			if err != nil {
+				return "", err
+			}
+			before, err := docStore.Count(ctx)
+			if err != nil {
+				return "", err
+			}
+			done, err := queue.enqueue(operation)
+			if err != nil {
+				return "", err
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			select {
+			case err := <-done:
+				if err != nil {
+					return "", fmt.Errorf("爬取失败: %w", err)
+				}
+			case <-ctx.Done():
+				return fmt.Sprintf("爬取在%s内没有完成,仍在后台进行,请先根据已有结果回答,并告诉用户稍后再问", timeout), nil
+			}
+			after, err := waitIndexed(ctx, docStore)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("已爬取%s上关键词为%s的数据,知识库新增%d个文档(共%d个,已有的文档按最新数据更新)。请用%s检索后回答",
+				input.Site, input.Keyword, max(after-before, 0), after, toolSearch), nil
+		})
+}
+
+// waitIndexed 爬取结束时监听到的响应可能仍在词嵌入和写入,等待文档数连续两次检查不变后返回;
+// 超时时返回当时的文档数
+func waitIndexed[D model.Document](ctx context.Context, docStore store.Store[D]) (int64, error) {
+	last := int64(-1)
+	ticker := time.NewTicker(crawlSettleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return max(last, 0), nil
+		case <-ticker.C:
+		}
+		if err := docStore.Flush(ctx); err != nil {
+			return 0, fmt.Errorf("提交写入失败: %w", err)
+		}
+		count, err := docStore.Count(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if count == last {
+			return count, nil
+		}
+		last = count
+	}
+}
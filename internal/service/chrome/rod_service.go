@@ -4,36 +4,42 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/chrome"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
 
 	"github.com/LouYuanbo1/crawleragent/param"
 )
 
 type rodService[C entity.Crawlable[D], D model.Document] struct {
 	chromeCrawler chrome.ChromeCrawler
-	typedEsClient es.TypedEsClient[D]
+	docStore      store.Store[D]
 	embedder      embedding.Embedder
+	sink          sink.Sink[D]
 }
 
 func InitRodService[C entity.Crawlable[D], D model.Document](
 	chromeCrawler chrome.ChromeCrawler,
-	typedEsClient es.TypedEsClient[D],
+	docStore store.Store[D],
 	embedder embedding.Embedder,
 ) ChromeService[C, D] {
 	return &rodService[C, D]{
 		chromeCrawler: chromeCrawler,
-		typedEsClient: typedEsClient,
+		docStore:      docStore,
 		embedder:      embedder,
+		sink:          sink.InitSink(embedder, docStore),
 	}
 }
 
+func (cs *rodService[C, D]) Sink() sink.Sink[D] {
+	return cs.sink
+}
+
 func (cs *rodService[C, D]) ScrollStrategy(ctx context.Context, param *param.Scroll) error {
 	log.Printf("开始滚动策略: %s", param.Url)
 
@@ -80,34 +86,13 @@ func (cs *rodService[C, D]) SetNetworkListenerWithIndexDocs(ctx context.Context,
 			log.Printf("关闭监听: %s", urlPattern)
 			cancel()
 		}()
-		for {
-			select {
-			case resp, ok := <-RespChan:
-				if !ok {
-					log.Printf("响应通道已关闭: %s", urlPattern)
-					return
-				}
-				crawlables, err := toCrawlable(resp.Body)
-				if err != nil {
-					log.Printf("处理响应体失败 (URL: %s): %v",
-						resp.Url, err)
-					continue
-				}
-				if len(crawlables) == 0 {
-					continue
-				}
-				docs := make([]D, 0, len(crawlables))
-				for _, crawlable := range crawlables {
-					doc := crawlable.ToDocument()
-					docs = append(docs, doc)
-				}
-				cs.embeddingDocs(docs)
-				cs.indexDocs(docs)
-			case <-ctx.Done():
-				log.Printf("取消监听: %s", urlPattern)
-				return
+		sink.Consume(ctx, cs.sink, RespChan, urlPattern, func(resp *types.NetworkResponse) ([]C, error) {
+			crawlables, err := toCrawlable(resp.Body)
+			if err != nil {
+				return nil, fmt.Errorf("处理响应体失败 (URL: %s): %w", resp.Url, err)
 			}
-		}
+			return crawlables, nil
+		})
 	}()
 }
 
@@ -138,49 +123,3 @@ func (cs *rodService[C, D]) SetNetworkListener(ctx context.Context, urlPattern s
 		}
 	}()
 }
-
-func (rs *rodService[C, D]) embeddingDocs(docs []D) {
-	// 从配置中获取批量处理大小
-	batchSizeEmbedding := rs.embedder.BatchSize()
-	reqCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	embeddingStrings := make([]string, 0, len(docs))
-	for _, doc := range docs {
-		embeddingStrings = append(embeddingStrings, doc.GetEmbeddingString())
-	}
-	var embeddingVectors [][]float32
-	var err error
-	if len(embeddingStrings) < batchSizeEmbedding {
-		embeddingVectors, err = rs.embedder.Embed(reqCtx, embeddingStrings)
-		if err != nil {
-			log.Printf("Embed error: %v", err)
-		}
-		for i := range embeddingVectors {
-			docs[i].SetEmbedding(embeddingVectors[i])
-		}
-	} else {
-		for i := 0; i < len(embeddingStrings); i += batchSizeEmbedding {
-			end := i + batchSizeEmbedding
-			end = min(end, len(embeddingStrings))
-			embeddingVectors, err = rs.embedder.Embed(reqCtx, embeddingStrings[i:end])
-			if err != nil {
-				log.Printf("Embed error: %v", err)
-			}
-			for j := range embeddingVectors {
-				docs[i+j].SetEmbedding(embeddingVectors[j])
-				//log.Printf("Indexed doc %s with embedding len %d", docs[i+j].GetID(), len(docs[i+j].GetEmbedding()))
-			}
-		}
-	}
-}
-
-func (rs *rodService[C, D]) indexDocs(docs []D) {
-
-	reqCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
-	if err := rs.typedEsClient.BulkIndexDocsWithID(reqCtx, docs); err != nil {
-		log.Printf("Bulk index error: %v", err)
-		return
-	}
-}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
 	"github.com/LouYuanbo1/crawleragent/param"
 )
 
@@ -13,4 +14,6 @@ type ChromeService[C entity.Crawlable[D], D model.Document] interface {
 	SetNetworkListener(ctx context.Context, urlPattern string, RespChanSize int)
 	ScrollStrategy(ctx context.Context, param *param.Scroll) error
 	ClickStrategy(ctx context.Context, param *param.Click) error
+	// Sink 返回服务使用的文档处理流水线,可以添加转换、校验和写入阶段
+	Sink() sink.Sink[D]
 }
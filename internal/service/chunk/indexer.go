@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/chunking"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
+)
+
+// ChunkIndexer 将长文档分块、嵌入后作为子文档写入分块索引
+type ChunkIndexer[D model.Document] interface {
+	IndexChunks(ctx context.Context, docs []D) error
+}
+
+type chunkIndexer[D model.Document] struct {
+	chunker    chunking.Chunker
+	chunkStore store.Store[*model.ChunkDoc]
+	pipeline   embedding.Pipeline[*model.ChunkDoc]
+}
+
+func InitChunkIndexer[D model.Document](
+	chunker chunking.Chunker,
+	chunkStore store.Store[*model.ChunkDoc],
+	embedder embedding.Embedder,
+) ChunkIndexer[D] {
+	// 分块在原文档重新爬取时会重新生成,失败的分块直接跳过,不需要暂存
+	cfg := embedding.DefaultPipelineConfig()
+	cfg.Policy = embedding.FailureSkip
+	return &chunkIndexer[D]{
+		chunker:    chunker,
+		chunkStore: chunkStore,
+		pipeline:   embedding.InitPipeline[*model.ChunkDoc](embedder, cfg),
+	}
+}
+
+// Writer 将分块索引器适配为Sink的写入阶段,每次写入使用独立的超时
+func Writer[D model.Document](chunkIndexer ChunkIndexer[D], timeout time.Duration) sink.Writer[D] {
+	return sink.WriterFunc[D](func(ctx context.Context, docs []D) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return chunkIndexer.IndexChunks(ctx, docs)
+	})
+}
+
+// ChunkDocs 按chunker切分文档的词嵌入字符串,生成关联到原文档的分块
+func ChunkDocs[D model.Document](chunker chunking.Chunker, docs []D) []*model.ChunkDoc {
+	chunks := make([]*model.ChunkDoc, 0, len(docs))
+	for _, doc := range docs {
+		for seq, content := range chunker.Split(doc.GetEmbeddingString()) {
+			chunks = append(chunks, &model.ChunkDoc{
+				ParentId:    doc.GetID(),
+				ParentIndex: doc.GetIndex(),
+				Seq:         seq,
+				Content:     content,
+			})
+		}
+	}
+	return chunks
+}
+
+func (ci *chunkIndexer[D]) IndexChunks(ctx context.Context, docs []D) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	chunks := ChunkDocs(ci.chunker, docs)
+	// 先嵌入并写入新分块,再删除旧分块;词嵌入失败(如服务不可用、限流)时保留旧分块,等下次爬取时更新
+	written := make(map[string]bool, len(docs))
+	if len(chunks) > 0 {
+		result := ci.pipeline.EmbedDocs(ctx, chunks)
+		if len(result.Ready) == 0 {
+			return fmt.Errorf("分块词嵌入全部失败: %w", result.Failed[0].Err)
+		}
+		embedding.LogFailures(result)
+
+		if err := ci.chunkStore.BulkPut(ctx, result.Ready); err != nil {
+			return fmt.Errorf("分块索引失败: %w", err)
+		}
+		for _, chunk := range result.Ready {
+			written[chunk.ParentId] = true
+		}
+		log.Printf("%d 个文档生成 %d 个分块, 词嵌入失败 %d 个", len(docs), len(chunks), len(result.Failed))
+	}
+
+	// 重新爬取时文档内容可能变短,删除序号超出新分块数量的旧分块,避免残留过期分块
+	if err := ci.deleteStaleChunks(ctx, docs, chunks, written); err != nil {
+		log.Printf("删除旧分块失败: %v", err)
+	}
+	return nil
+}
+
+// deleteStaleChunks 删除序号不小于新分块数量的旧分块,新分块按ID覆盖同序号的旧分块;
+// 分块全部嵌入失败的文档不删除,保留旧分块
+func (ci *chunkIndexer[D]) deleteStaleChunks(ctx context.Context, docs []D, chunks []*model.ChunkDoc, written map[string]bool) error {
+	counts := make(map[string]int, len(docs))
+	for _, chunk := range chunks {
+		counts[chunk.ParentId]++
+	}
+	// 分块数量相同的文档合并为一次删除
+	byCount := make(map[int][]string)
+	for _, doc := range docs {
+		count := counts[doc.GetID()]
+		if count > 0 && !written[doc.GetID()] {
+			continue
+		}
+		byCount[count] = append(byCount[count], doc.GetID())
+	}
+	// 所有类型文档的分块在同一个索引中,按原文档的索引过滤,避免删除其他索引中ID相同的文档的分块
+	parentIndex := store.Term{Field: "parentIndex", Values: []string{docs[0].GetIndex()}}
+	var errs []error
+	for count, parentIds := range byCount {
+		minSeq := float64(count)
+		err := ci.chunkStore.DeleteByTerm(ctx,
+			store.Term{Field: "parentId", Values: parentIds},
+			parentIndex,
+			store.RangeTerm("seq", &minSeq, nil),
+		)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
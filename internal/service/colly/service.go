@@ -11,42 +11,49 @@ import (
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/collector"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	chunk "github.com/LouYuanbo1/crawleragent/internal/service/chunk"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
 	"github.com/gocolly/colly/v2"
 )
 
 type CollyService[C entity.Crawlable[D], D model.Document] interface {
 	CollyCrawler() collector.CollyCrawler
-	TypedEsClient() es.TypedEsClient[D]
+	Store() store.Store[D]
 	Embedder() embedding.Embedder
+	// Sink 返回服务使用的文档处理流水线,可以添加转换、校验和写入阶段
+	Sink() sink.Sink[D]
 	Visit(url string) error
 	Wait()
 	RecursiveCrawling(hrefSelector string)
 	HandleResponse(ctx context.Context, toCrawlable func(body []byte) ([]C, error))
 	HandleHTML(ctx context.Context, selector string, toCrawlable func(r *colly.HTMLElement) ([]C, error))
+	SetChunkIndexer(chunkIndexer chunk.ChunkIndexer[D])
 }
 
 type collyService[C entity.Crawlable[D], D model.Document] struct {
-	collyCrawler  collector.CollyCrawler
-	typedEsClient es.TypedEsClient[D]
-	embedder      embedding.Embedder
-	processSem    chan struct{}
-	embedSem      chan struct{}
+	collyCrawler collector.CollyCrawler
+	docStore     store.Store[D]
+	embedder     embedding.Embedder
+	sink         sink.Sink[D]
+	processSem   chan struct{}
+	embedSem     chan struct{}
 }
 
 func InitCollyService[C entity.Crawlable[D], D model.Document](
 	collyCrawler collector.CollyCrawler,
-	typedEsClient es.TypedEsClient[D],
+	docStore store.Store[D],
 	embedder embedding.Embedder,
 	processSemSize int,
 	embedSemSize int,
 ) CollyService[C, D] {
 	return &collyService[C, D]{
-		collyCrawler:  collyCrawler,
-		typedEsClient: typedEsClient,
-		embedder:      embedder,
-		processSem:    make(chan struct{}, processSemSize),
-		embedSem:      make(chan struct{}, embedSemSize),
+		collyCrawler: collyCrawler,
+		docStore:     docStore,
+		embedder:     embedder,
+		sink:         sink.InitSink(embedder, docStore),
+		processSem:   make(chan struct{}, processSemSize),
+		embedSem:     make(chan struct{}, embedSemSize),
 	}
 }
 
@@ -54,20 +61,33 @@ func (cs *collyService[C, D]) CollyCrawler() collector.CollyCrawler {
 	return cs.collyCrawler
 }
 
-func (cs *collyService[C, D]) TypedEsClient() es.TypedEsClient[D] {
-	return cs.typedEsClient
+func (cs *collyService[C, D]) Store() store.Store[D] {
+	return cs.docStore
 }
 
 func (cs *collyService[C, D]) Embedder() embedding.Embedder {
 	return cs.embedder
 }
 
+func (cs *collyService[C, D]) Sink() sink.Sink[D] {
+	return cs.sink
+}
+
+// SetChunkIndexer 设置分块索引器,设置后长文档会额外分块写入分块索引,用于分块检索
+func (cs *collyService[C, D]) SetChunkIndexer(chunkIndexer chunk.ChunkIndexer[D]) {
+	cs.sink.AddWriter(chunk.Writer(chunkIndexer, 60*time.Second))
+}
+
 func (cs *collyService[C, D]) Visit(url string) error {
 	return cs.collyCrawler.Visit(url)
 }
 
+// Wait 等待所有请求完成,再写入词嵌入流水线中暂存的文档
 func (cs *collyService[C, D]) Wait() {
 	cs.collyCrawler.Wait()
+	if err := cs.sink.Flush(context.Background()); err != nil {
+		log.Printf("写入暂存文档失败: %v", err)
+	}
 }
 
 func (cs *collyService[C, D]) RecursiveCrawling(hrefSelector string) {
@@ -108,11 +128,7 @@ func (cs *collyService[C, D]) HandleResponse(ctx context.Context, toCrawlable fu
 		if len(data) == 0 {
 			return
 		}
-		docs := make([]D, 0, len(data))
-		for _, d := range data {
-			docs = append(docs, d.ToDocument())
-		}
-		cs.indexDocs(docs)
+		cs.putDocs(data)
 	})
 }
 
@@ -139,22 +155,16 @@ func (cs *collyService[C, D]) HandleHTML(ctx context.Context, selector string, t
 		if len(data) == 0 {
 			return
 		}
-		docs := make([]D, 0, len(data))
-		for _, d := range data {
-			docs = append(docs, d.ToDocument())
-		}
-		cs.indexDocs(docs)
+		cs.putDocs(data)
 	})
 }
 
-func (cs *collyService[C, D]) indexDocs(docs []D) {
-
-	reqCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
-	if err := cs.typedEsClient.BulkIndexDocsWithID(reqCtx, docs); err != nil {
-		log.Printf("Bulk index error: %v", err)
-		return
+// putDocs 将文档交给Sink处理,embedSem限制同时处理的回调数量,避免大量页面同时请求嵌入模型
+func (cs *collyService[C, D]) putDocs(data []C) {
+	cs.embedSem <- struct{}{}
+	defer func() { <-cs.embedSem }()
+	if err := cs.sink.Put(context.Background(), sink.ToDocuments[C](data)); err != nil {
+		log.Printf("写入文档失败: %v", err)
 	}
 }
 
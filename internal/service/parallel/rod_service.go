@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
@@ -9,26 +10,31 @@ import (
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
 
 	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/parallel"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
 	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
-	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/es"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+	chunk "github.com/LouYuanbo1/crawleragent/internal/service/chunk"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
 	"github.com/LouYuanbo1/crawleragent/param"
 )
 
 type rodParallelService[C entity.Crawlable[D], D model.Document] struct {
 	parallelCrawler parallel.ParallelCrawler
-	typedEsClient   es.TypedEsClient[D]
+	docStore        store.Store[D]
 	embedder        embedding.Embedder
+	sink            sink.Sink[D]
 }
 
 func InitRodParallelService[C entity.Crawlable[D], D model.Document](
 	parallelCrawler parallel.ParallelCrawler,
-	typedEsClient es.TypedEsClient[D],
+	docStore store.Store[D],
 	embedder embedding.Embedder,
 ) ParallelService[C, D] {
 	return &rodParallelService[C, D]{
 		parallelCrawler: parallelCrawler,
-		typedEsClient:   typedEsClient,
+		docStore:        docStore,
 		embedder:        embedder,
+		sink:            sink.InitSink(embedder, docStore),
 	}
 }
 
@@ -36,84 +42,35 @@ func (rps *rodParallelService[C, D]) PerformAllUrlOperations(ctx context.Context
 	return rps.parallelCrawler.PerformAllUrlOperations(ctx, options)
 }
 
-func (rps *rodParallelService[C, D]) embeddingDocs(docs []D) {
-	// 从配置中获取批量处理大小
-	batchSizeEmbedding := rps.embedder.BatchSize()
-	reqCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	embeddingStrings := make([]string, 0, len(docs))
-	for _, doc := range docs {
-		embeddingStrings = append(embeddingStrings, doc.GetEmbeddingString())
-	}
-	var embeddingVectors [][]float32
-	var err error
-	if len(embeddingStrings) < batchSizeEmbedding {
-		embeddingVectors, err = rps.embedder.Embed(reqCtx, embeddingStrings)
-		if err != nil {
-			log.Printf("Embed error: %v", err)
-		}
-		for i := range embeddingVectors {
-			docs[i].SetEmbedding(embeddingVectors[i])
-		}
-	} else {
-		for i := 0; i < len(embeddingStrings); i += batchSizeEmbedding {
-			end := i + batchSizeEmbedding
-			end = min(end, len(embeddingStrings))
-			embeddingVectors, err = rps.embedder.Embed(reqCtx, embeddingStrings[i:end])
-			if err != nil {
-				log.Printf("Embed error: %v", err)
-			}
-			for j := range embeddingVectors {
-				docs[i+j].SetEmbedding(embeddingVectors[j])
-				//log.Printf("Indexed doc %s with embedding len %d", docs[i+j].GetID(), len(docs[i+j].GetEmbedding()))
-			}
-		}
-	}
+func (rps *rodParallelService[C, D]) Sink() sink.Sink[D] {
+	return rps.sink
 }
 
-func (rps *rodParallelService[C, D]) indexDocs(docs []D) {
-
-	reqCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
-	if err := rps.typedEsClient.BulkIndexDocsWithID(reqCtx, docs); err != nil {
-		log.Printf("Bulk index error: %v", err)
-		return
-	}
+// SetChunkIndexer 设置分块索引器,设置后长文档会额外分块写入分块索引,用于分块检索
+func (rps *rodParallelService[C, D]) SetChunkIndexer(chunkIndexer chunk.ChunkIndexer[D]) {
+	rps.sink.AddWriter(chunk.Writer(chunkIndexer, 60*time.Second))
 }
 
 func (rps *rodParallelService[C, D]) ProcessRespChanWithIndexDocs(ctx context.Context, listener *param.ListenerConfig, toCrawlable func(body []byte) ([]C, error)) {
-	go func() {
-		for {
-			select {
-			case resp, ok := <-listener.ListenerCh:
-				if !ok {
-					log.Printf("响应通道已关闭,监听UrlPattern:%s\n", listener.UrlPatterns)
-					return
-				}
-				log.Printf("收到响应 (URL: %s,监听UrlPattern: %s,Length Body: %d)\n", resp.Url, resp.UrlPattern, len(resp.Body))
-				crawlables, err := toCrawlable(resp.Body)
-				if err != nil {
-					log.Printf("处理响应体失败 (URL: %s,监听UrlPattern:%s): %v\n",
-						resp.Url, resp.UrlPattern, err)
-					continue
-				}
-				if len(crawlables) == 0 {
-					continue
-				}
-				docs := make([]D, 0, len(crawlables))
-				for _, crawlable := range crawlables {
-					doc := crawlable.ToDocument()
-					docs = append(docs, doc)
-				}
-				rps.embeddingDocs(docs)
-				rps.indexDocs(docs)
-			case <-ctx.Done():
-				log.Printf("取消处理响应,监听UrlPattern:%s\n", listener.UrlPatterns)
-				return
-			}
+	go sink.Consume(ctx, rps.sink, listener.ListenerCh, fmt.Sprint(listener.UrlPatterns), func(resp *types.NetworkResponse) ([]C, error) {
+		log.Printf("收到响应 (URL: %s,监听UrlPattern: %s,Length Body: %d)\n", resp.Url, resp.UrlPattern, len(resp.Body))
+		crawlables, err := toCrawlable(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("处理响应体失败 (URL: %s,监听UrlPattern:%s): %w", resp.Url, resp.UrlPattern, err)
 		}
-	}()
+		return crawlables, nil
+	})
+}
+
+func (rps *rodParallelService[C, D]) ProcessHtmlContentChWithIndexDocs(ctx context.Context, htmlContent *param.HtmlContentConfig, toCrawlable func(content *types.HtmlContent) ([]C, error)) {
+	go sink.Consume(ctx, rps.sink, htmlContent.HtmlContentsCh, fmt.Sprint(htmlContent.ContentSelectors), func(content *types.HtmlContent) ([]C, error) {
+		log.Printf("收到HTML内容 (URL: %s,选择器: %s,片段数: %d)\n", content.Url, content.ContentSelector, len(content.Content))
+		crawlables, err := toCrawlable(content)
+		if err != nil {
+			return nil, fmt.Errorf("处理HTML内容失败 (URL: %s,选择器:%s): %w", content.Url, content.ContentSelector, err)
+		}
+		return crawlables, nil
+	})
 }
 
 func (rps *rodParallelService[C, D]) ProcessRespChan(ctx context.Context, listener *param.ListenerConfig) {
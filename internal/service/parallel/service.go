@@ -5,6 +5,9 @@ import (
 
 	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
 	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
+	chunk "github.com/LouYuanbo1/crawleragent/internal/service/chunk"
+	sink "github.com/LouYuanbo1/crawleragent/internal/service/sink"
 	"github.com/LouYuanbo1/crawleragent/param"
 )
 
@@ -12,4 +15,8 @@ type ParallelService[C entity.Crawlable[D], D model.Document] interface {
 	PerformAllUrlOperations(ctx context.Context, options []*param.UrlOperation) error
 	ProcessRespChan(ctx context.Context, listener *param.ListenerConfig)
 	ProcessRespChanWithIndexDocs(ctx context.Context, listener *param.ListenerConfig, toCrawlable func(body []byte) ([]C, error))
+	ProcessHtmlContentChWithIndexDocs(ctx context.Context, htmlContent *param.HtmlContentConfig, toCrawlable func(content *types.HtmlContent) ([]C, error))
+	// Sink 返回服务使用的文档处理流水线,可以添加转换、校验和写入阶段
+	Sink() sink.Sink[D]
+	SetChunkIndexer(chunkIndexer chunk.ChunkIndexer[D])
 }
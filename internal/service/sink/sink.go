@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/domain/entity"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/embedding"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+)
+
+// Transform 转换阶段,可以过滤、去重或补充文档,返回继续处理的文档
+type Transform[D model.Document] func(ctx context.Context, docs []D) ([]D, error)
+
+// Validator 校验阶段,返回错误的文档会被丢弃
+type Validator[D model.Document] func(doc D) error
+
+// Writer 写入阶段,接收已经完成词嵌入的文档
+type Writer[D model.Document] interface {
+	Write(ctx context.Context, docs []D) error
+}
+
+// WriterFunc 将普通函数适配为Writer
+type WriterFunc[D model.Document] func(ctx context.Context, docs []D) error
+
+func (f WriterFunc[D]) Write(ctx context.Context, docs []D) error {
+	return f(ctx, docs)
+}
+
+// Sink 爬虫服务共用的文档处理流水线: 转换 → 校验 → 词嵌入 → 写入
+// 去重、补充字段、额外的存储后端等功能只需要在这里添加对应的阶段
+type Sink[D model.Document] interface {
+	// Put 处理一批文档,转换失败时直接返回错误,写入阶段会尝试所有Writer后合并错误
+	Put(ctx context.Context, docs []D) error
+	// Flush 处理完最后一批后调用,写入词嵌入流水线中暂存的失败文档(仍然失败的不带向量写入)
+	Flush(ctx context.Context) error
+	AddTransform(transform Transform[D])
+	AddValidator(validator Validator[D])
+	AddWriter(writer Writer[D])
+	// ReuseEmbedding 设置判断文档是否已有可用向量的函数,返回true的文档不再嵌入,直接写入
+	ReuseEmbedding(reuse func(doc D) bool)
+}
+
+type sink[D model.Document] struct {
+	transforms []Transform[D]
+	validators []Validator[D]
+	pipeline   embedding.Pipeline[D]
+	writers    []Writer[D]
+	// reuse 为nil时所有文档都重新嵌入
+	reuse func(doc D) bool
+}
+
+// InitSink 创建默认的流水线: 校验文档ID非空,使用默认配置的词嵌入流水线,写入docStore
+func InitSink[D model.Document](embedder embedding.Embedder, docStore store.Store[D]) Sink[D] {
+	return InitSinkWithConfig(embedder, docStore, embedding.DefaultPipelineConfig())
+}
+
+// InitSinkWithConfig 与InitSink相同,词嵌入流水线使用指定的配置(如导入时失败的文档不带向量写入)
+func InitSinkWithConfig[D model.Document](embedder embedding.Embedder, docStore store.Store[D], pipelineCfg embedding.PipelineConfig) Sink[D] {
+	s := &sink[D]{
+		pipeline: embedding.InitPipeline[D](embedder, pipelineCfg),
+	}
+	s.AddValidator(RequireID[D])
+	s.AddWriter(StoreWriter(docStore, 20*time.Second))
+	return s
+}
+
+func (s *sink[D]) AddTransform(transform Transform[D]) {
+	s.transforms = append(s.transforms, transform)
+}
+
+func (s *sink[D]) AddValidator(validator Validator[D]) {
+	s.validators = append(s.validators, validator)
+}
+
+func (s *sink[D]) AddWriter(writer Writer[D]) {
+	s.writers = append(s.writers, writer)
+}
+
+func (s *sink[D]) ReuseEmbedding(reuse func(doc D) bool) {
+	s.reuse = reuse
+}
+
+func (s *sink[D]) Put(ctx context.Context, docs []D) error {
+	var err error
+	for _, transform := range s.transforms {
+		if docs, err = transform(ctx, docs); err != nil {
+			return fmt.Errorf("转换文档失败: %w", err)
+		}
+	}
+	docs = s.validate(docs)
+	ready, docs := s.split(docs)
+
+	// 词嵌入失败的文档按流水线的策略处理,默认暂存到下一批重新嵌入,
+	// 所以即使本批没有有效文档也要调用一次,让暂存的文档有机会写入
+	result := s.pipeline.EmbedDocs(ctx, docs)
+	embedding.LogFailures(result)
+	return s.write(ctx, append(ready, result.Ready...))
+}
+
+// split 分出已有可用向量的文档,其余文档需要嵌入
+func (s *sink[D]) split(docs []D) (ready, toEmbed []D) {
+	if s.reuse == nil {
+		return nil, docs
+	}
+	toEmbed = make([]D, 0, len(docs))
+	for _, doc := range docs {
+		if s.reuse(doc) {
+			ready = append(ready, doc)
+		} else {
+			toEmbed = append(toEmbed, doc)
+		}
+	}
+	return ready, toEmbed
+}
+
+func (s *sink[D]) Flush(ctx context.Context) error {
+	return s.write(ctx, s.pipeline.Flush(ctx).Ready)
+}
+
+// write 依次交给所有Writer写入,合并各Writer的错误
+func (s *sink[D]) write(ctx context.Context, docs []D) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(s.writers))
+	for _, writer := range s.writers {
+		if err := writer.Write(ctx, docs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *sink[D]) validate(docs []D) []D {
+	valid := make([]D, 0, len(docs))
+	for _, doc := range docs {
+		if err := s.check(doc); err != nil {
+			log.Printf("丢弃文档 %s: %v", doc.GetID(), err)
+			continue
+		}
+		valid = append(valid, doc)
+	}
+	return valid
+}
+
+func (s *sink[D]) check(doc D) error {
+	for _, validator := range s.validators {
+		if err := validator(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequireID 校验文档ID非空,ID为空的文档无法在重复爬取时覆盖
+func RequireID[D model.Document](doc D) error {
+	if doc.GetID() == "" {
+		return fmt.Errorf("文档ID为空")
+	}
+	return nil
+}
+
+// StoreWriter 将文档批量写入docStore,每次写入使用独立的超时
+func StoreWriter[D model.Document](docStore store.Store[D], timeout time.Duration) Writer[D] {
+	return WriterFunc[D](func(ctx context.Context, docs []D) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := docStore.BulkPut(ctx, docs); err != nil {
+			return fmt.Errorf("批量写入 %s 失败: %w", docStore.Name(), err)
+		}
+		return nil
+	})
+}
+
+// ToDocuments 将爬取到的数据转换为文档
+func ToDocuments[C entity.Crawlable[D], D model.Document](crawlables []C) []D {
+	docs := make([]D, 0, len(crawlables))
+	for _, crawlable := range crawlables {
+		docs = append(docs, crawlable.ToDocument())
+	}
+	return docs
+}
+
+// Consume 持续读取通道中的数据,转换为文档后交给Sink处理,直到通道关闭或ctx取消,
+// 通道关闭时调用Flush写入暂存的文档
+// source用于日志中标识数据来源(如监听的UrlPattern或内容选择器),
+// 单条数据处理失败只记录日志,不会中断消费
+func Consume[T any, C entity.Crawlable[D], D model.Document](
+	ctx context.Context,
+	s Sink[D],
+	ch <-chan T,
+	source string,
+	toCrawlable func(item T) ([]C, error),
+) {
+	for {
+		select {
+		case item, ok := <-ch:
+			if !ok {
+				log.Printf("通道已关闭: %s", source)
+				if err := s.Flush(context.Background()); err != nil {
+					log.Printf("写入暂存文档失败 (%s): %v", source, err)
+				}
+				return
+			}
+			crawlables, err := toCrawlable(item)
+			if err != nil {
+				log.Printf("处理数据失败 (%s): %v", source, err)
+				continue
+			}
+			if len(crawlables) == 0 {
+				continue
+			}
+			// 写入使用独立的上下文,取消监听时已经收到的数据仍然完整写入
+			if err := s.Put(context.Background(), ToDocuments[C](crawlables)); err != nil {
+				log.Printf("写入文档失败 (%s): %v", source, err)
+			}
+		case <-ctx.Done():
+			log.Printf("取消处理: %s", source)
+			return
+		}
+	}
+}
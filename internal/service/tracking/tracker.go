@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/LouYuanbo1/crawleragent/internal/config"
+	"github.com/LouYuanbo1/crawleragent/internal/domain/model"
+	"github.com/LouYuanbo1/crawleragent/internal/infra/persistence/store"
+)
+
+// Tracker 重复爬取时的变更跟踪
+// 作为Sink的转换阶段,与已有文档比较内容哈希,补充首次/最近出现和最近变化的时间,内容变化时把旧版本写入历史索引;
+// 爬取结束后调用Finish,把连续多次运行没有爬到的文档标记为过期,而不是删除
+type Tracker[D model.Document] interface {
+	// Transform 作为Sink的转换阶段使用: sink.AddTransform(tracker.Transform)
+	Transform(ctx context.Context, docs []D) ([]D, error)
+	// Run 本次运行的序号,为上次完成的运行序号加1
+	Run() int64
+	// Finish 标记过期文档并关闭历史存储,成功后才保存本次的运行序号,需要在爬取结束、关闭文档存储之前调用;
+	// 中途退出或只爬取部分数据(如智能体按需爬取)时不调用,不占用运行序号
+	Finish(ctx context.Context) error
+	// Close 只关闭历史存储,不标记过期文档也不保存运行序号,用于导入文件、按需爬取等只处理部分数据的场景
+	Close() error
+}
+
+type tracker[D model.Document] struct {
+	docStore store.Store[D]
+	// historyStore 为nil时不保存历史版本
+	historyStore    store.Store[*model.HistoryDoc]
+	expireAfterRuns int
+	run             int64
+	// runPath 运行序号文件,startedAt为本次运行开始的时间
+	runPath   string
+	startedAt time.Time
+
+	// seen 本次运行已经跟踪过的文档,同一文档在一次运行中多次出现(如列表页重叠)时,
+	// 与本次运行中上一次的结果比较;已处理的文档可能还在词嵌入或批量写入的队列中,从存储中查不到最新状态
+	mu   sync.Mutex
+	seen map[string]seenDoc
+}
+
+// seenDoc 本次运行中文档最近一次的跟踪信息,source为生成历史版本用的文档内容,不保存历史时为空
+type seenDoc struct {
+	tracking model.Tracking
+	source   []byte
+}
+
+// runState 保存在 "<storage.dir>/<索引名>.runs.json" 中的运行序号
+type runState struct {
+	Run       int64     `json:"run"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// InitTracker 按配置中的tracking初始化变更跟踪,未开启时返回不做任何处理的Tracker
+// 需要在docStore.EnsureIndex之后调用,运行序号按实际读写的索引名保存
+func InitTracker[D model.Document](ctx context.Context, cfg *config.Config, docStore store.Store[D]) (Tracker[D], error) {
+	if !cfg.Tracking.Enabled {
+		return noopTracker[D]{}, nil
+	}
+	var schemaDoc D
+	if _, ok := any(schemaDoc).(model.Trackable); !ok {
+		return nil, fmt.Errorf("%s 的文档不支持变更跟踪", schemaDoc.GetIndex())
+	}
+	runPath := filepath.Join(cfg.Storage.Dir, docStore.Name()+".runs.json")
+	run, err := nextRun(runPath)
+	if err != nil {
+		return nil, err
+	}
+	t := &tracker[D]{
+		docStore:        docStore,
+		expireAfterRuns: cfg.Tracking.ExpireAfterRuns,
+		run:             run,
+		runPath:         runPath,
+		startedAt:       time.Now(),
+		seen:            make(map[string]seenDoc),
+	}
+	if cfg.Tracking.History {
+		historyStore, err := store.InitStore[*model.HistoryDoc](cfg, 1)
+		if err != nil {
+			return nil, fmt.Errorf("初始化历史存储失败: %w", err)
+		}
+		// 历史索引没有向量字段,不需要维度
+		if err := historyStore.EnsureIndex(ctx, 0); err != nil {
+			historyStore.Close()
+			return nil, fmt.Errorf("创建历史索引失败: %w", err)
+		}
+		t.historyStore = historyStore
+	}
+	log.Printf("开启变更跟踪: %s 第 %d 次运行", docStore.Name(), run)
+	return t, nil
+}
+
+// nextRun 读取上次完成的运行序号并加1,不保存;运行序号在Finish成功后才由saveRun保存,
+// 爬取中途崩溃或被中断的运行不占用序号,不会导致之后的运行把仍然存在的文档误标为过期
+func nextRun(path string) (int64, error) {
+	var state runState
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return 0, fmt.Errorf("解析运行序号文件 %s 失败: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return 0, fmt.Errorf("读取运行序号文件失败: %w", err)
+	}
+	return state.Run + 1, nil
+}
+
+// saveRun 保存完成的运行序号
+func saveRun(path string, state runState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("保存运行序号失败: %w", err)
+	}
+	return nil
+}
+
+func (t *tracker[D]) Run() int64 {
+	return t.run
+}
+
+func (t *tracker[D]) Transform(ctx context.Context, docs []D) ([]D, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if _, ok := t.seen[doc.GetID()]; !ok {
+			ids = append(ids, doc.GetID())
+		}
+	}
+	previous := make(map[string]seenDoc, len(ids))
+	if len(ids) > 0 {
+		existing, err := t.docStore.MGet(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("查询已有文档失败: %w", err)
+		}
+		for _, doc := range existing {
+			previous[doc.GetID()] = t.record(doc)
+		}
+	}
+
+	now := time.Now()
+	history := make([]*model.HistoryDoc, 0)
+	created, changed := 0, 0
+	for _, doc := range docs {
+		trackable := any(doc).(model.Trackable)
+		current := trackable.GetTracking()
+		current.ContentHash = trackable.ContentHash()
+		current.LastSeen = now
+		current.LastSeenRun = t.run
+		current.Expired = false
+		current.ExpiredAt = time.Time{}
+
+		old, ok := t.seen[doc.GetID()]
+		if !ok {
+			old, ok = previous[doc.GetID()]
+		}
+		last := &old.tracking
+		switch {
+		case !ok || last.ContentHash == "":
+			// 新文档,或开启跟踪之前写入的文档,从本次开始记录
+			created++
+			current.Version = 1
+			current.FirstSeen = now
+			current.LastChanged = now
+		case last.ContentHash == current.ContentHash:
+			current.Version = last.Version
+			current.FirstSeen = last.FirstSeen
+			current.LastChanged = last.LastChanged
+		default:
+			changed++
+			current.Version = last.Version + 1
+			current.FirstSeen = last.FirstSeen
+			current.LastChanged = now
+			if t.historyStore != nil && old.source != nil {
+				history = append(history, toHistoryDoc(doc, old, now))
+			}
+		}
+		t.seen[doc.GetID()] = t.record(doc)
+	}
+
+	// 历史版本写入失败不影响文档本身的写入
+	if len(history) > 0 {
+		if err := t.historyStore.BulkPut(ctx, history); err != nil {
+			log.Printf("写入历史版本失败: %v", err)
+		}
+	}
+	if created > 0 || changed > 0 {
+		log.Printf("%s: 新增 %d 个文档, 内容变化 %d 个", t.docStore.Name(), created, changed)
+	}
+	return docs, nil
+}
+
+// record 复制文档当前的跟踪信息,保存历史时同时保存去掉向量的文档内容
+func (t *tracker[D]) record(doc D) seenDoc {
+	record := seenDoc{tracking: *any(doc).(model.Trackable).GetTracking()}
+	if t.historyStore != nil {
+		source, err := historySource(doc)
+		if err != nil {
+			log.Printf("生成文档 %s 的历史版本失败: %v", doc.GetID(), err)
+		}
+		record.source = source
+	}
+	return record
+}
+
+// historySource 将文档转换为JSON,去掉向量只保留内容
+func historySource[D model.Document](doc D) ([]byte, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "embedding")
+	return json.Marshal(fields)
+}
+
+// toHistoryDoc 将变化前的版本转换为历史版本
+func toHistoryDoc[D model.Document](doc D, old seenDoc, now time.Time) *model.HistoryDoc {
+	validFrom := old.tracking.LastChanged
+	if validFrom.IsZero() {
+		validFrom = old.tracking.FirstSeen
+	}
+	return &model.HistoryDoc{
+		DocId:       doc.GetID(),
+		Index:       doc.GetIndex(),
+		Version:     old.tracking.Version,
+		ContentHash: old.tracking.ContentHash,
+		ValidFrom:   validFrom,
+		ValidTo:     now,
+		Source:      old.source,
+	}
+}
+
+// Finish 遍历文档存储,最近expire_after_runs次运行都没有爬到的文档标记为过期
+func (t *tracker[D]) Finish(ctx context.Context) error {
+	defer t.Close()
+	if t.expireAfterRuns <= 0 {
+		return saveRun(t.runPath, runState{Run: t.run, StartedAt: t.startedAt})
+	}
+	// 最近一次出现的运行序号不大于threshold,说明之后的expireAfterRuns次运行都没有爬到
+	threshold := t.run - int64(t.expireAfterRuns)
+	now := time.Now()
+	expired := 0
+	err := t.docStore.Scan(ctx, 500, func(docs []D) error {
+		batch := make([]D, 0)
+		for _, doc := range docs {
+			tracking := any(doc).(model.Trackable).GetTracking()
+			if tracking.Expired || tracking.LastSeenRun > threshold {
+				continue
+			}
+			tracking.Expired = true
+			tracking.ExpiredAt = now
+			batch = append(batch, doc)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		expired += len(batch)
+		return t.docStore.BulkPut(ctx, batch)
+	})
+	if err != nil {
+		return fmt.Errorf("标记过期文档失败: %w", err)
+	}
+	if err := t.docStore.Flush(ctx); err != nil {
+		return fmt.Errorf("标记过期文档失败: %w", err)
+	}
+	log.Printf("%s: 第 %d 次运行结束, %d 个文档连续 %d 次运行未爬到, 标记为过期",
+		t.docStore.Name(), t.run, expired, t.expireAfterRuns)
+	return saveRun(t.runPath, runState{Run: t.run, StartedAt: t.startedAt})
+}
+
+func (t *tracker[D]) Close() error {
+	if t.historyStore == nil {
+		return nil
+	}
+	return t.historyStore.Close()
+}
+
+// noopTracker 未开启变更跟踪时使用,文档原样写入
+type noopTracker[D model.Document] struct{}
+
+func (noopTracker[D]) Transform(ctx context.Context, docs []D) ([]D, error) {
+	return docs, nil
+}
+
+func (noopTracker[D]) Run() int64 {
+	return 0
+}
+
+func (noopTracker[D]) Finish(ctx context.Context) error {
+	return nil
+}
+
+func (noopTracker[D]) Close() error {
+	return nil
+}
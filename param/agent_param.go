@@ -12,6 +12,9 @@ type PromptType string
 const (
 	PromptEsRAGMode PromptType = "EsRAGMode"
 	PromptChatMode  PromptType = "ChatMode"
+	// PromptHybridMode 同时使用知识库和网络搜索结果({referenceDocs}和{duckDuckGoResults})的提示,可选,
+	// 未配置时需要两者的请求只使用知识库
+	PromptHybridMode PromptType = "HybridMode"
 )
 
 type SearchConfig struct {
@@ -20,8 +23,78 @@ type SearchConfig struct {
 	Timeout    time.Duration
 }
 
+// Retrieval 知识库检索配置,零值字段使用默认值
+type Retrieval struct {
+	// K 返回给模型的文档数,默认5
+	K int
+	// MaxK 只检索接口(Search)一次最多返回的文档数,默认为K的10倍
+	MaxK int
+	// Candidates 全文检索和向量检索各自返回的候选数(融合前),默认20
+	Candidates int
+	// TextFields 全文检索(multi_match)的字段,可写为"字段^权重";为空时只做向量检索
+	TextFields []string
+	// Fusion 融合方式: "rrf"(默认)或"weighted"
+	Fusion string
+	// RankConstant RRF的常数,默认60
+	RankConstant int
+	// TextWeight、VectorWeight 全文检索和向量检索结果的权重,都为0时各为1
+	TextWeight   float64
+	VectorWeight float64
+	// ExtractFilters 检索前由模型从请求中抽取城市、薪资、经验、学历和技能,作为岗位检索的过滤条件
+	ExtractFilters bool
+	// FilterPrompt 抽取筛选条件的系统提示,为空时使用默认提示
+	FilterPrompt string
+}
+
+// Memory 多轮对话记录配置,零值字段使用默认值
+type Memory struct {
+	// MaxTurns 提示中保留原文的最近轮数,更早的轮次压缩为摘要,默认4
+	MaxTurns int
+	// SummaryMaxChars 摘要的最大字数,默认800
+	SummaryMaxChars int
+	// RewritePrompt 追问改写的系统提示,为空时使用默认提示
+	RewritePrompt string
+	// SummaryPrompt 压缩对话记录的系统提示,为空时使用默认提示
+	SummaryPrompt string
+}
+
+// Citation 回答的引用校验配置,检索到的文档按[文档N]编号提供给模型,模型需要在回答中按编号引用
+type Citation struct {
+	// Mode 回答引用了不存在的文档编号或检索结果之外的网址时的处理方式:
+	// "flag"(默认)在无效引用后标注并在回答末尾提示,"strip"删除包含无效引用的条目,"off"不校验
+	Mode string
+}
+
+// Tools 工具调用模式配置: 模型自行调用检索知识库、按ID获取文档和按需爬取的工具,多轮调用后再回答
+type Tools struct {
+	// Mode 使用工具调用模式的时机: ""或"off"不使用,"fallback"在知识库没有检索到文档或去掉了筛选条件时使用,
+	// "always"需要知识库的请求都使用;需要同时网络搜索的请求仍然使用混合模式
+	Mode string
+	// MaxStep 工具调用模式的最大步数,模型和工具各算一步,默认12
+	MaxStep int
+	// SystemPrompt 工具调用模式的系统提示,为空时使用默认提示
+	SystemPrompt string
+	// CrawlTemplates 可以按需爬取的网站,Crawler为nil或没有模板时不提供爬取工具
+	CrawlTemplates []*CrawlTemplate
+	Crawler        Crawler
+	// CrawlTimeout 等待一次爬取和写入完成的最长时间,默认3分钟,超时后爬取在后台继续
+	CrawlTimeout time.Duration
+}
+
 type Agent struct {
-	IndexName        string
 	Prompt           map[PromptType]*prompt.DefaultChatTemplate
 	DuckDuckGoSearch SearchConfig
+	// IntentPrompt 意图识别的系统提示,为空时使用默认提示
+	IntentPrompt string
+	// DefaultIntent 意图识别模型调用或解析失败时的路由: knowledge_base, web_search, both, none,
+	// 为空时使用knowledge_base
+	DefaultIntent string
+	// Retrieval 知识库检索配置,配置了TextFields时使用全文检索+向量检索的混合检索
+	Retrieval Retrieval
+	// Memory 多轮对话记录配置,提示模板中通过schema.MessagesPlaceholder("history", true)使用对话记录
+	Memory Memory
+	// Citation 回答的引用校验配置,只在查询了知识库时校验
+	Citation Citation
+	// Tools 工具调用模式配置,默认不使用
+	Tools Tools
 }
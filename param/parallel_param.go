@@ -1,6 +1,14 @@
 package param
 
-import "github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/LouYuanbo1/crawleragent/internal/infra/crawler/types"
+)
 
 type OperationType string
 
@@ -32,6 +40,14 @@ type UrlOperation struct {
 	HtmlContentConfig    *HtmlContentConfig `json:"html_content_config"`
 }
 
+// ListenerUrlPatterns 返回监听的url模式,未配置监听器时返回nil
+func (uo *UrlOperation) ListenerUrlPatterns() []string {
+	if uo.ListenerConfig == nil {
+		return nil
+	}
+	return uo.ListenerConfig.UrlPatterns
+}
+
 func (uo *UrlOperation) IsValid() bool {
 	if uo.Url == "" ||
 		uo.OperationType == "" ||
@@ -51,3 +67,58 @@ func (uo *UrlOperation) IsValid() bool {
 		return false
 	}
 }
+
+// Crawler 执行爬取操作,parallel.ParallelCrawler和并行爬虫服务都满足该接口,
+// 智能体按需爬取时只依赖这个接口
+type Crawler interface {
+	PerformAllUrlOperations(ctx context.Context, operations []*UrlOperation) error
+}
+
+// CrawlTemplate 按需爬取的网站模板,由用户的关键词和城市生成UrlOperation
+type CrawlTemplate struct {
+	// Name 网站名,工具调用时按名称选择模板,如"boss"
+	Name        string
+	Description string
+	// UrlTemplate 爬取的网址,{query}替换为转义后的关键词,{city}替换为城市代码
+	UrlTemplate string
+	// Cities 城市名到网站城市代码的映射,DefaultCity为未指定城市时使用的代码
+	Cities      map[string]string
+	DefaultCity string
+	// Operation 除Url外的爬取参数(操作类型、次数、监听器等),监听器的消费者需要在爬取前启动
+	Operation UrlOperation
+}
+
+// UrlOperation 按关键词和城市生成爬取操作,城市不在Cities中时返回错误
+func (ct *CrawlTemplate) UrlOperation(query, city string) (*UrlOperation, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("爬取关键词不能为空")
+	}
+	code := ct.DefaultCity
+	if city = strings.TrimSuffix(strings.TrimSpace(city), "市"); city != "" {
+		var ok bool
+		if code, ok = ct.Cities[city]; !ok {
+			return nil, fmt.Errorf("%s不支持城市: %s", ct.Name, city)
+		}
+	}
+	operation := ct.Operation
+	operation.Url = strings.NewReplacer("{query}", url.QueryEscape(query), "{city}", code).Replace(ct.UrlTemplate)
+	if !operation.IsValid() {
+		return nil, fmt.Errorf("%s的爬取参数无效", ct.Name)
+	}
+	return &operation, nil
+}
+
+// BossCities Boss直聘的城市代码,全国为100010000
+var BossCities = map[string]string{
+	"全国": "100010000",
+	"北京": "101010100",
+	"上海": "101020100",
+	"广州": "101280100",
+	"深圳": "101280600",
+	"杭州": "101210100",
+	"成都": "101270100",
+	"南京": "101190100",
+	"武汉": "101200100",
+	"西安": "101110100",
+}